@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -18,34 +19,75 @@ type Configs []Config
 
 type StrConfig map[string]string
 
+// Bool is a boolean which also accepts the YAML style yes/no values.
+type Bool bool
+
 // Output is a generic output.
 type Output any
 
-// TemplateResolver converts a template string to a resolved string.
-type TemplateResolver func(string) (string, error)
+// TemplateResolver converts a template string to a resolved value.
+// The value is always a string unless native is set and the template is a single expression.
+type TemplateResolver func(str string, native bool) (any, error)
 
 // YamlElement represents the configuration of a unit in the YAML file.
+// The fields tagged with template:"-" are not templated with the element,
+// but when they are evaluated.
 type YamlElement struct {
-	Block        YamlElements `json:"block"`
-	Name         *string      `json:"name"`
-	When         []string     `json:"when"`
-	Register     *string      `json:"register"`
-	Environ      StrConfig    `json:"environment"`
-	IgnoreErrors bool         `json:"ignore_errors"`
-	Loop         *YamlLoop    `json:"loop"`
-	Parent       *YamlElement
+	Block        YamlElements     `json:"block" template:"-"`
+	Name         *string          `json:"name" template:"-"`
+	When         []string         `json:"when" template:"-"`
+	Register     *string          `json:"register" template:"-"`
+	Environ      StrConfig        `json:"environment" template:"-"`
+	IgnoreErrors bool             `json:"ignore_errors"`
+	Loop         *YamlLoop        `json:"loop" template:"-"`
+	LoopControl  *YamlLoopControl `json:"loop_control" template:"-"`
+	Vars         Config           `json:"vars" template:"-"`
+	Become       *Bool            `json:"become" template:"-"`
+	BecomeUser   *string          `json:"become_user" template:"-"`
+	BecomeMethod *string          `json:"become_method" template:"-"`
+	BecomeFlags  *string          `json:"become_flags" template:"-"`
+	DelegateTo   *string          `json:"delegate_to" template:"-"`
+	RunOnce      *Bool            `json:"run_once" template:"-"`
+	Parent       *YamlElement     `template:"-"`
 	Task         *YamlTask
+	Pos          Position `template:"-"`
 }
 
 // YamlTask represents the configuration of a task in the YAML file.
 type YamlTask struct {
-	Name   string `json:"name"`
+	Name   string `json:"name" template:"-"`
 	Config Config `json:"config"`
 }
 
+// BecomeKeywords are the privilege escalation keywords. The nil fields are not set.
+type BecomeKeywords struct {
+	Become *Bool
+	User   *string
+	Method *string
+	Flags  *string
+}
+
+// YamlLoopControl is the loop_control keyword.
+type YamlLoopControl struct {
+	// LoopVar is the name of the item variable. It is item by default.
+	LoopVar string `json:"loop_var"`
+	// IndexVar is the name of the variable for the zero based index.
+	IndexVar string `json:"index_var"`
+	// Label is the template displayed for each item instead of the item.
+	Label string `json:"label"`
+	// Pause is the number of seconds to wait between the iterations.
+	Pause float64 `json:"pause"`
+	// Extended sets the ansible_loop variable with the details of the iteration.
+	Extended Bool `json:"extended"`
+}
+
+// YamlLoop is the loop keyword or a with_<lookup> keyword.
+// Var is a template string and Items are the inline items or the lookup terms.
 type YamlLoop struct {
 	Var   *string `json:"var"`
 	Items []any   `json:"items"`
+	// Lookup is the lookup of a with_<lookup> loop. It is empty for the loop keyword.
+	Lookup string `json:"lookup" yaml:"-"`
 }
 
 var (
@@ -67,7 +109,18 @@ type TaskRunner interface {
 type PlaybookExecutor interface {
 	ExecuteFile(context.Context, string) error
 	ApplyConfig(Config) error
+	ApplyScopedConfig(Config, func() error) error
 	CurrentConfig() Config
+	// ExtraVars returns the extra vars which take precedence over all the other variables.
+	ExtraVars() Config
+	FindRole(string) (*Role, error)
+	TemplateOptions() TemplateOptions
+	// Connection returns the connection to the host on which the task runs.
+	Connection(context.Context) (Connection, error)
+	// CachedFacts returns the cached facts of the host if they can be used instead of gathering them.
+	CachedFacts() (Config, bool, error)
+	// CacheFacts merges the facts into the cached facts of the host.
+	CacheFacts(Config) error
 }
 type taskRunner struct {
 	yamlElement *YamlElement
@@ -91,13 +144,18 @@ func (runner *taskRunner) Run(ctx context.Context, executor PlaybookExecutor) (O
 	fmt.Printf("\nRunning task %s\n", name)
 	err := runner.task.Init(runner.yamlElement)
 	if err != nil {
-		return nil, fmt.Errorf("Init failed for task %s", string(runner.task.Name()))
+		return nil, &TaskInitError{Position: runner.yamlElement.Pos, Task: runner.task.Name(), Err: err}
 	}
 	output, err := runner.task.Run(ctx, executor)
-	if err != nil && runner.yamlElement.IgnoreErrors {
-		err = nil
+	if err != nil {
+		// The executor decides whether the error is ignored. The errors of the nested tasks are kept.
+		var runErr *TaskRunError
+		if errors.As(err, &runErr) {
+			return output, err
+		}
+		return output, &TaskRunError{Position: runner.yamlElement.Pos, Task: runner.task.Name(), Output: output, Err: err}
 	}
-	return output, err
+	return output, nil
 }
 
 func (yamlTask *YamlTask) validate() error {
@@ -108,10 +166,10 @@ func (yamlTask *YamlTask) validate() error {
 }
 
 func (yamlLoop *YamlLoop) validate() error {
-	if yamlLoop.Var == nil && len(yamlLoop.Items) == 0 {
+	if yamlLoop.Var == nil && yamlLoop.Items == nil {
 		return errors.New("Either var or items must be set")
 	}
-	if yamlLoop.Var != nil && len(yamlLoop.Items) > 0 {
+	if yamlLoop.Var != nil && yamlLoop.Items != nil {
 		return errors.New("Loop var and items are both set")
 	}
 	return nil
@@ -125,7 +183,11 @@ func (yamlElement *YamlElement) MakeTask() (TaskRunner, error) {
 	}
 	task, ok := reflect.New(registeredTaskTypes[yamlTask.Name]).Interface().(Task)
 	if !ok {
-		return nil, fmt.Errorf("Cannot instantiate task %s", string(yamlTask.Name))
+		return nil, &TaskInitError{
+			Position: yamlElement.Pos,
+			Task:     yamlTask.Name,
+			Err:      errors.New("Cannot instantiate task"),
+		}
 	}
 	return &taskRunner{task: task, yamlElement: yamlElement}, nil
 }
@@ -135,13 +197,13 @@ func (yamlElements *YamlElements) UnmarshalYAML(value *yaml.Node) error {
 		return nil
 	}
 	if value.Kind != yaml.SequenceNode {
-		return fmt.Errorf("Sequence node is expected, but found %v", value.Kind)
+		return newParseError(value, fmt.Errorf("Sequence node is expected, but found %v", value.Kind))
 	}
 	for _, node := range value.Content {
 		yamlElement := &YamlElement{}
 		err := node.Decode(yamlElement)
 		if err != nil {
-			return err
+			return newParseError(node, err)
 		}
 		*yamlElements = append(*yamlElements, yamlElement)
 	}
@@ -152,8 +214,9 @@ func (yamlElement *YamlElement) UnmarshalYAML(value *yaml.Node) error {
 	if value == nil {
 		return nil
 	}
+	yamlElement.Pos = NodePosition(value)
 	if value.Kind != yaml.MappingNode {
-		return fmt.Errorf("Mapping node is expected, but found %v", value.Kind)
+		return newParseError(value, fmt.Errorf("Mapping node is expected, but found %v", value.Kind))
 	}
 	for i := 0; i < len(value.Content); i += 2 {
 		key := value.Content[i]
@@ -161,28 +224,28 @@ func (yamlElement *YamlElement) UnmarshalYAML(value *yaml.Node) error {
 		var strKey string
 		err := key.Decode(&strKey)
 		if err != nil {
-			return err
+			return newParseError(key, err)
 		}
 		if fieldParser, ok := yamlElementFieldParsers[strKey]; ok {
 			err := fieldParser(strKey, val, yamlElement)
 			if err != nil {
-				return err
+				return newParseError(val, err)
 			}
 		} else if _, ok := registeredTaskTypes[strKey]; ok {
 			if yamlElement.Task != nil {
-				return fmt.Errorf("Task is already configured for %s", yamlElement.Task.Name)
+				return newParseError(key, fmt.Errorf("Task is already configured for %s", yamlElement.Task.Name))
 			}
 			taskConfig := Config{}
 			err = val.Decode(&taskConfig)
 			if err != nil {
-				return err
+				return newParseError(val, err)
 			}
 			yamlElement.Task = &YamlTask{Name: strKey, Config: taskConfig}
 		} else {
-			return fmt.Errorf("Unknown field %s", strKey)
+			return newParseError(key, fmt.Errorf("Unknown field %s", strKey))
 		}
 	}
-	return yamlElement.validate()
+	return newParseError(value, yamlElement.validate())
 }
 
 func (yamlElement *YamlElement) ReadTaskConfig(receiver any) error {
@@ -196,6 +259,17 @@ func (yamlElement *YamlElement) ReadTaskConfig(receiver any) error {
 	if err != nil {
 		return err
 	}
+	// The config is decoded generically first, so that the native values of the templates
+	// can be converted to the types of the receiver fields.
+	var config any
+	err = json.Unmarshal(configJson, &config)
+	if err != nil {
+		return err
+	}
+	configJson, err = json.Marshal(convertScalars(config, reflect.TypeOf(receiver)))
+	if err != nil {
+		return err
+	}
 	return json.Unmarshal(configJson, receiver)
 }
 
@@ -214,6 +288,106 @@ func (yamlElement *YamlElement) environment(env *StrConfig) {
 	}
 }
 
+// BecomeKeywords returns the become keywords of the element inherited from the parents.
+func (yamlElement *YamlElement) BecomeKeywords() BecomeKeywords {
+	keywords := BecomeKeywords{
+		Become: yamlElement.Become,
+		User:   yamlElement.BecomeUser,
+		Method: yamlElement.BecomeMethod,
+		Flags:  yamlElement.BecomeFlags,
+	}
+	if yamlElement.Parent != nil {
+		keywords = keywords.Inherit(yamlElement.Parent.BecomeKeywords())
+	}
+	return keywords
+}
+
+// Inherit returns the keywords in which the fields not set are taken from the parent.
+func (keywords BecomeKeywords) Inherit(parent BecomeKeywords) BecomeKeywords {
+	if keywords.Become == nil {
+		keywords.Become = parent.Become
+	}
+	if keywords.User == nil {
+		keywords.User = parent.User
+	}
+	if keywords.Method == nil {
+		keywords.Method = parent.Method
+	}
+	if keywords.Flags == nil {
+		keywords.Flags = parent.Flags
+	}
+	return keywords
+}
+
+// Delegation returns the delegate_to keyword of the element inherited from the parents.
+// It returns nil if the task is not delegated.
+func (yamlElement *YamlElement) Delegation() *string {
+	if yamlElement.DelegateTo == nil && yamlElement.Parent != nil {
+		return yamlElement.Parent.Delegation()
+	}
+	return yamlElement.DelegateTo
+}
+
+// IsRunOnce returns the run_once keyword of the element inherited from the parents.
+func (yamlElement *YamlElement) IsRunOnce() bool {
+	if yamlElement.RunOnce == nil {
+		return yamlElement.Parent != nil && yamlElement.Parent.IsRunOnce()
+	}
+	return bool(*yamlElement.RunOnce)
+}
+
+// SetFile sets the source file in the position of the element and its children.
+func (yamlElement *YamlElement) SetFile(file string) {
+	yamlElement.Pos.File = file
+	for _, child := range yamlElement.Block {
+		child.SetFile(file)
+	}
+}
+
+// Variables returns the vars of the element merged with the vars of the parents.
+func (yamlElement *YamlElement) Variables() Config {
+	vars := Config{}
+	yamlElement.variables(&vars)
+	return vars
+}
+
+func (yamlElement *YamlElement) variables(vars *Config) {
+	if yamlElement.Parent != nil {
+		yamlElement.Parent.variables(vars)
+	}
+	for key, val := range yamlElement.Vars {
+		(*vars)[key] = val
+	}
+}
+
+func (b *Bool) UnmarshalJSON(data []byte) error {
+	var v any
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		return err
+	}
+	switch t := v.(type) {
+	case bool:
+		*b = Bool(t)
+	case float64:
+		*b = t != 0
+	case string:
+		switch strings.ToLower(t) {
+		case "yes", "y", "true", "on", "1":
+			*b = true
+		case "no", "n", "false", "off", "0", "":
+			*b = false
+		default:
+			return fmt.Errorf("Invalid boolean value %s", t)
+		}
+	case nil:
+		*b = false
+	default:
+		return fmt.Errorf("Invalid boolean value %v", t)
+	}
+	return nil
+}
+
 // TODO add more checks.
 func (yamlElement *YamlElement) validate() error {
 	if len(yamlElement.Block) > 0 {
@@ -0,0 +1,166 @@
+package defs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	fp "path/filepath"
+	"reflect"
+	"testing"
+)
+
+type testTaskConfig struct {
+	Name    string            `json:"name"`
+	Count   int               `json:"count"`
+	Enabled bool              `json:"enabled"`
+	Flag    Bool              `json:"flag"`
+	Args    []string          `json:"args"`
+	Env     map[string]string `json:"env"`
+	Value   any               `json:"value"`
+	Ignored string            `json:"-"`
+}
+
+type testEmbeddingTaskConfig struct {
+	testTaskConfig
+	Count string `json:"count"`
+}
+
+func TestReadTaskConfigConvertsScalars(t *testing.T) {
+	yamlElement := &YamlElement{Task: &YamlTask{Config: Config{
+		"name":    42,
+		"count":   "3",
+		"enabled": "true",
+		"flag":    "yes",
+		"args":    []any{"a", 1, 2.5, true},
+		"env":     map[string]any{"PORT": 8080},
+		"value":   7,
+	}}}
+	var got testTaskConfig
+	err := yamlElement.ReadTaskConfig(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := testTaskConfig{
+		Name:    "42",
+		Count:   3,
+		Enabled: true,
+		Flag:    true,
+		Args:    []string{"a", "1", "2.5", "true"},
+		Env:     map[string]string{"PORT": "8080"},
+		Value:   float64(7),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadTaskConfig = %#v, want %#v", got, want)
+	}
+}
+
+func TestReadTaskConfigEmbedded(t *testing.T) {
+	yamlElement := &YamlElement{Task: &YamlTask{Config: Config{"name": 1, "count": 2}}}
+	var got testEmbeddingTaskConfig
+	err := yamlElement.ReadTaskConfig(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "1" || got.Count != "2" {
+		t.Errorf("ReadTaskConfig = %#v", got)
+	}
+}
+
+func TestReadTaskConfigInvalid(t *testing.T) {
+	yamlElement := &YamlElement{Task: &YamlTask{Config: Config{"count": "three"}}}
+	var got testTaskConfig
+	if err := yamlElement.ReadTaskConfig(&got); err == nil {
+		t.Errorf("ReadTaskConfig = %#v, want an error", got)
+	}
+}
+
+// noopTask is the task named noop which does nothing.
+type noopTask struct{}
+
+func init() {
+	MustRegisterTask(&noopTask{})
+}
+
+func (task *noopTask) Name() string {
+	return "noop"
+}
+
+func (task *noopTask) Init(yamlElement *YamlElement) error {
+	return nil
+}
+
+func (task *noopTask) Run(ctx context.Context, executor PlaybookExecutor) (Output, error) {
+	return nil, nil
+}
+
+func TestBecomeKeywordsInherited(t *testing.T) {
+	dir := t.TempDir()
+	path := fp.Join(dir, "tasks.yaml")
+	err := os.WriteFile(path, []byte(`
+- block:
+    - block:
+        - noop: {}
+          become_method: su
+        - noop: {}
+          become: no
+          become_flags: -l
+      become_user: app
+    - noop: {}
+  become: yes
+  become_user: admin
+- noop: {}
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	processor := NewProcessor()
+	err = processor.ParseYaml(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outer := processor.YamlConfigs()[0]
+	inner := outer.Block[0]
+	yes, no := Bool(true), Bool(false)
+	tests := []struct {
+		name    string
+		element *YamlElement
+		want    BecomeKeywords
+	}{
+		{"inner block task", inner.Block[0], BecomeKeywords{Become: &yes, User: ptr("app"), Method: ptr("su")}},
+		{"inner block override", inner.Block[1], BecomeKeywords{Become: &no, User: ptr("app"), Flags: ptr("-l")}},
+		{"outer block task", outer.Block[1], BecomeKeywords{Become: &yes, User: ptr("admin")}},
+		{"top level task", processor.YamlConfigs()[1], BecomeKeywords{}},
+	}
+	for _, test := range tests {
+		if got := test.element.BecomeKeywords(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: BecomeKeywords = %s, want %s", test.name, formatBecome(got), formatBecome(test.want))
+		}
+	}
+	// The keywords of the tasks in a file included by a task are inherited from it.
+	included := BecomeKeywords{Method: ptr("doas")}.Inherit(outer.Block[1].BecomeKeywords())
+	if want := (BecomeKeywords{Become: &yes, User: ptr("admin"), Method: ptr("doas")}); !reflect.DeepEqual(included, want) {
+		t.Errorf("included task keywords = %s, want %s", formatBecome(included), formatBecome(want))
+	}
+}
+
+func ptr(value string) *string {
+	return &value
+}
+
+// formatBecome formats the keywords with the values of the pointers.
+func formatBecome(keywords BecomeKeywords) string {
+	value := func(v any) string {
+		switch v := v.(type) {
+		case *Bool:
+			if v != nil {
+				return fmt.Sprint(*v)
+			}
+		case *string:
+			if v != nil {
+				return *v
+			}
+		}
+		return "<nil>"
+	}
+	return fmt.Sprintf("{become=%s user=%s method=%s flags=%s}", value(keywords.Become), value(keywords.User), value(keywords.Method), value(keywords.Flags))
+}
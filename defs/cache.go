@@ -0,0 +1,93 @@
+package defs
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/noirbizarre/gonja/exec"
+)
+
+const (
+	// DefaultTemplateCacheSize is the number of the parsed templates kept by default.
+	DefaultTemplateCacheSize = 4096
+)
+
+var (
+	templateCache = newTemplateLRUCache(DefaultTemplateCacheSize)
+)
+
+// templateLRUCache keeps the most recently used parsed templates.
+// It is safe for concurrent use.
+type templateLRUCache struct {
+	mutex    sync.Mutex
+	capacity int
+	entries  map[templateCacheKey]*list.Element
+	// The most recently used entry is at the front.
+	order *list.List
+}
+
+type templateCacheKey struct {
+	name   string
+	source string
+}
+
+type templateCacheEntry struct {
+	key      templateCacheKey
+	template *exec.Template
+}
+
+func newTemplateLRUCache(capacity int) *templateLRUCache {
+	return &templateLRUCache{
+		capacity: capacity,
+		entries:  map[templateCacheKey]*list.Element{},
+		order:    list.New(),
+	}
+}
+
+// SetTemplateCacheSize sets the number of the parsed templates to keep.
+// Caching is disabled if the size is not positive.
+func SetTemplateCacheSize(size int) {
+	templateCache.resize(size)
+}
+
+func (cache *templateLRUCache) get(key templateCacheKey) (*exec.Template, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	element, ok := cache.entries[key]
+	if !ok {
+		return nil, false
+	}
+	cache.order.MoveToFront(element)
+	return element.Value.(*templateCacheEntry).template, true
+}
+
+func (cache *templateLRUCache) put(key templateCacheKey, template *exec.Template) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if cache.capacity <= 0 {
+		return
+	}
+	if element, ok := cache.entries[key]; ok {
+		element.Value.(*templateCacheEntry).template = template
+		cache.order.MoveToFront(element)
+		return
+	}
+	cache.entries[key] = cache.order.PushFront(&templateCacheEntry{key: key, template: template})
+	cache.evict()
+}
+
+func (cache *templateLRUCache) resize(capacity int) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.capacity = capacity
+	cache.evict()
+}
+
+// evict removes the least recently used entries exceeding the capacity.
+func (cache *templateLRUCache) evict() {
+	for cache.order.Len() > 0 && cache.order.Len() > cache.capacity {
+		element := cache.order.Back()
+		cache.order.Remove(element)
+		delete(cache.entries, element.Value.(*templateCacheEntry).key)
+	}
+}
@@ -0,0 +1,33 @@
+package defs
+
+import (
+	"testing"
+
+	"github.com/noirbizarre/gonja/exec"
+)
+
+func TestTemplateLRUCache(t *testing.T) {
+	cache := newTemplateLRUCache(2)
+	keys := []templateCacheKey{{name: "a"}, {name: "b"}, {name: "c"}}
+	templates := []*exec.Template{{}, {}, {}}
+	cache.put(keys[0], templates[0])
+	cache.put(keys[1], templates[1])
+	// a becomes the most recently used, so b is evicted.
+	if tpl, ok := cache.get(keys[0]); !ok || tpl != templates[0] {
+		t.Fatalf("get(a) = %v, %v", tpl, ok)
+	}
+	cache.put(keys[2], templates[2])
+	if _, ok := cache.get(keys[1]); ok {
+		t.Errorf("b is not evicted")
+	}
+	for _, i := range []int{0, 2} {
+		if tpl, ok := cache.get(keys[i]); !ok || tpl != templates[i] {
+			t.Errorf("get(%s) = %v, %v", keys[i].name, tpl, ok)
+		}
+	}
+	cache.resize(0)
+	cache.put(keys[1], templates[1])
+	if len(cache.entries) != 0 || cache.order.Len() != 0 {
+		t.Errorf("disabled cache has %d entries", len(cache.entries))
+	}
+}
@@ -0,0 +1,116 @@
+package defs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+var (
+	registeredConnections = map[string]ConnectionPlugin{}
+)
+
+// Connection runs the commands and transfers the files on a host.
+type Connection interface {
+	// Exec runs the command with the shell. An ExitError is returned with the result
+	// if the command exits with a non-zero status.
+	Exec(ctx context.Context, command string, options ExecOptions) (*ExecResult, error)
+	// Put writes the content to the file on the host. A zero mode is 0644.
+	Put(ctx context.Context, content []byte, path string, mode os.FileMode) error
+	// Fetch returns the content of the file on the host.
+	Fetch(ctx context.Context, path string) ([]byte, error)
+	// Stat returns the information of the file on the host which may not exist.
+	Stat(ctx context.Context, path string) (*FileStat, error)
+	// Close releases the connection.
+	Close() error
+}
+
+// ConnectionPlugin makes the connections of a type selected by the ansible_connection variable.
+type ConnectionPlugin interface {
+	Name() string
+	// Connect returns the connection to the host. Vars are the resolved ansible_* variables of the host.
+	Connect(ctx context.Context, host string, vars Config) (Connection, error)
+}
+
+// ExecOptions are the options of a command.
+type ExecOptions struct {
+	// Executable is the shell running the command. It is /bin/sh if it is empty.
+	Executable string
+	// Dir is the working directory of the command.
+	Dir string
+	// Env is added to the environment of the command.
+	Env StrConfig
+	// Stdin is the input of the command.
+	Stdin []byte
+	// Input is the input of the command if Stdin is nil. It is read while the command runs,
+	// so it may respond to the output. The command does not wait for its end.
+	Input io.Reader
+	// Stdout and Stderr receive the output of the command as it is written if they are set.
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// BecomeOptions are the options of running the commands as another user.
+type BecomeOptions struct {
+	// User is the user to become. It is root if it is empty.
+	User string
+	// Method is sudo, su, doas or runuser. It is sudo if it is empty.
+	Method string
+	// Flags are the flags of the method. The default flags of the method are used if it is empty.
+	Flags string
+	// Password is sent to the password prompt of sudo. It is not supported by su and doas
+	// and not needed by runuser.
+	Password string
+}
+
+// ExecResult is the result of a command.
+type ExecResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// FileStat is the information of a file on a host.
+type FileStat struct {
+	Path    string
+	Exists  bool
+	IsDir   bool
+	Mode    os.FileMode
+	Size    int64
+	ModTime time.Time
+}
+
+// ExitError is the error when a command exits with a non-zero status.
+// Err is the error of the underlying transport if there is any.
+type ExitError struct {
+	ExitCode int
+	Stderr   string
+	Err      error
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.ExitCode)
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// MustRegisterConnection registers the connection plugin.
+func MustRegisterConnection(plugin ConnectionPlugin) {
+	if _, ok := registeredConnections[plugin.Name()]; ok {
+		panic(fmt.Sprintf("Connection %s is already registered", plugin.Name()))
+	}
+	registeredConnections[plugin.Name()] = plugin
+}
+
+// Connect returns the connection of the type to the host.
+func Connect(ctx context.Context, connectionType string, host string, vars Config) (Connection, error) {
+	plugin, ok := registeredConnections[connectionType]
+	if !ok {
+		return nil, fmt.Errorf("Connection plugin %s is not found", connectionType)
+	}
+	return plugin.Connect(ctx, host, vars)
+}
@@ -0,0 +1,326 @@
+package connections
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"goparse/defs"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	// becomeMethods return the command line running the command line as the user.
+	// The prompt is the password prompt the method must print if the password is set.
+	// The connections have no terminal, so su and doas, which read the password from it,
+	// fail if the password is set.
+	becomeMethods = map[string]func(command string, options defs.BecomeOptions, prompt string) (string, error){
+		"sudo":    sudoCommand,
+		"su":      suCommand,
+		"doas":    doasCommand,
+		"runuser": runuserCommand,
+	}
+)
+
+// becomeConnection runs the commands and accesses the files as another user.
+type becomeConnection struct {
+	defs.Connection
+	options defs.BecomeOptions
+	method  func(command string, options defs.BecomeOptions, prompt string) (string, error)
+}
+
+// Become returns the connection which runs the commands and accesses the files
+// as the user of the options.
+func Become(conn defs.Connection, options defs.BecomeOptions) (defs.Connection, error) {
+	if options.User == "" {
+		options.User = "root"
+	}
+	if options.Method == "" {
+		options.Method = "sudo"
+	}
+	method, ok := becomeMethods[options.Method]
+	if !ok {
+		return nil, fmt.Errorf("Become method %s is not supported", options.Method)
+	}
+	return &becomeConnection{Connection: conn, options: options, method: method}, nil
+}
+
+func sudoCommand(command string, options defs.BecomeOptions, prompt string) (string, error) {
+	flags := options.Flags
+	if flags == "" {
+		flags = "-H -S -n"
+		if options.Password != "" {
+			flags = "-H"
+		}
+	}
+	if options.Password != "" {
+		// The password is read from the standard input when the prompt is printed.
+		fields := strings.Fields(flags)
+		flags = ""
+		for _, flag := range fields {
+			if flag != "-S" && flag != "-n" && flag != "--non-interactive" && flag != "--stdin" {
+				flags += flag + " "
+			}
+		}
+		flags += "-S -p " + shellQuote(prompt)
+	}
+	return fmt.Sprintf("sudo %s -u %s -- %s", flags, shellQuote(options.User), command), nil
+}
+
+func suCommand(command string, options defs.BecomeOptions, prompt string) (string, error) {
+	if options.Password != "" {
+		return "", fmt.Errorf("Become password is not supported by su since it reads the password from a terminal")
+	}
+	return fmt.Sprintf("su %s -c %s", becomeArgs(options.Flags, shellQuote(options.User)), shellQuote(command)), nil
+}
+
+func doasCommand(command string, options defs.BecomeOptions, prompt string) (string, error) {
+	if options.Password != "" {
+		return "", fmt.Errorf("Become password is not supported by doas since it reads the password from a terminal")
+	}
+	flags := options.Flags
+	if flags == "" {
+		flags = "-n"
+	}
+	return fmt.Sprintf("doas %s -u %s %s", flags, shellQuote(options.User), command), nil
+}
+
+// runuserCommand ignores the password since runuser is run by root and never prompts for it.
+func runuserCommand(command string, options defs.BecomeOptions, prompt string) (string, error) {
+	return fmt.Sprintf("runuser %s -- %s", becomeArgs(options.Flags, "-u", shellQuote(options.User)), command), nil
+}
+
+// becomeArgs returns the flags followed by the arguments. Only the flags are split since the command may have spaces and newlines.
+func becomeArgs(flags string, args ...string) string {
+	return strings.Join(append(strings.Fields(flags), args...), " ")
+}
+
+func (conn *becomeConnection) Exec(ctx context.Context, command string, options defs.ExecOptions) (*defs.ExecResult, error) {
+	// The environment and the directory are set by the shell of the user since the methods may reset them.
+	command = shellCommand(command, options)
+	if conn.options.Password == "" {
+		becomeCommand, err := conn.method(command, conn.options, "")
+		if err != nil {
+			return nil, err
+		}
+		return conn.Connection.Exec(ctx, becomeCommand, defs.ExecOptions{Stdin: options.Stdin, Input: options.Input})
+	}
+	// The password is sent only when the method prompts for it, and the input of the command
+	// only after the success marker is printed, so that neither is read by the other.
+	key, err := becomeKey()
+	if err != nil {
+		return nil, err
+	}
+	session := newBecomeSession(conn.options.Password, key, options)
+	becomeCommand, err := conn.method(fmt.Sprintf("/bin/sh -c %s", shellQuote("echo "+session.marker+"; "+command)), conn.options, session.prompt)
+	if err != nil {
+		return nil, err
+	}
+	defer session.input.close()
+	result, err := conn.Connection.Exec(ctx, becomeCommand, defs.ExecOptions{Input: session.input, Stdout: session.stdout(), Stderr: session.stderr()})
+	return session.result(result, err)
+}
+
+// becomeKey returns a random key which makes the prompt and the success marker unique.
+func becomeKey() (string, error) {
+	key := make([]byte, 16)
+	_, err := rand.Read(key)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
+
+// becomeSession responds to the password prompt and the success marker of a become command.
+type becomeSession struct {
+	mutex     sync.Mutex
+	password  string
+	prompt    string
+	marker    string
+	stdin     []byte
+	streaming bool
+	input     *becomeInput
+	stdoutBuf bytes.Buffer
+	stderrBuf bytes.Buffer
+	prompts   int
+	succeeded bool
+}
+
+func newBecomeSession(password string, key string, options defs.ExecOptions) *becomeSession {
+	session := &becomeSession{
+		password: password,
+		prompt:   fmt.Sprintf("[sudo via goparse, key=%s] password:", key),
+		marker:   "BECOME-SUCCESS-" + key,
+		stdin:    options.Stdin,
+		input:    newBecomeInput(),
+	}
+	if options.Stdin == nil && options.Input != nil {
+		session.streaming = true
+		go func() {
+			// The input of the command is read only after the success marker.
+			select {
+			case <-session.input.started:
+				data, _ := io.ReadAll(options.Input)
+				session.input.send(data)
+				session.input.close()
+			case <-session.input.done:
+			}
+		}()
+	}
+	return session
+}
+
+func (session *becomeSession) stdout() io.Writer {
+	return writerFunc(func(p []byte) {
+		session.mutex.Lock()
+		defer session.mutex.Unlock()
+		if session.succeeded {
+			return
+		}
+		session.stdoutBuf.Write(p)
+		if !strings.Contains(session.stdoutBuf.String(), session.marker+"\n") {
+			return
+		}
+		session.succeeded = true
+		if session.streaming {
+			close(session.input.started)
+			return
+		}
+		session.input.send(session.stdin)
+		session.input.close()
+	})
+}
+
+func (session *becomeSession) stderr() io.Writer {
+	return writerFunc(func(p []byte) {
+		session.mutex.Lock()
+		defer session.mutex.Unlock()
+		if session.succeeded {
+			return
+		}
+		session.stderrBuf.Write(p)
+		prompts := strings.Count(session.stderrBuf.String(), session.prompt)
+		for ; session.prompts < prompts; session.prompts++ {
+			if session.prompts == 0 {
+				session.input.send([]byte(session.password + "\n"))
+			} else {
+				// The password is incorrect and prompted again.
+				session.input.close()
+			}
+		}
+	})
+}
+
+// result removes the prompts and the success marker from the result of the command.
+func (session *becomeSession) result(result *defs.ExecResult, err error) (*defs.ExecResult, error) {
+	if result == nil {
+		return nil, err
+	}
+	session.mutex.Lock()
+	succeeded, prompts := session.succeeded, session.prompts
+	session.mutex.Unlock()
+	if _, after, ok := strings.Cut(result.Stdout, session.marker+"\n"); ok {
+		result.Stdout = after
+	}
+	result.Stderr = strings.TrimLeft(strings.ReplaceAll(result.Stderr, session.prompt, ""), "\n")
+	var exitErr *defs.ExitError
+	if errors.As(err, &exitErr) {
+		if !succeeded && prompts > 1 {
+			err = &defs.ExitError{ExitCode: exitErr.ExitCode, Stderr: result.Stderr, Err: errors.New("Incorrect become password")}
+		} else {
+			err = &defs.ExitError{ExitCode: exitErr.ExitCode, Stderr: result.Stderr, Err: exitErr.Err}
+		}
+	}
+	return result, err
+}
+
+// becomeInput is the input of a become command which is sent in chunks.
+// Sending never blocks, and reading ends when it is closed.
+type becomeInput struct {
+	mutex  sync.Mutex
+	chunks chan []byte
+	closed bool
+	buffer []byte
+	// started is closed when the command starts after the password.
+	started chan struct{}
+	// done is closed when the input is closed.
+	done chan struct{}
+}
+
+func newBecomeInput() *becomeInput {
+	// The chunks are the password and the input of the command.
+	return &becomeInput{chunks: make(chan []byte, 2), started: make(chan struct{}), done: make(chan struct{})}
+}
+
+func (input *becomeInput) send(data []byte) {
+	input.mutex.Lock()
+	defer input.mutex.Unlock()
+	if !input.closed && len(data) > 0 {
+		input.chunks <- data
+	}
+}
+
+func (input *becomeInput) close() {
+	input.mutex.Lock()
+	defer input.mutex.Unlock()
+	if !input.closed {
+		input.closed = true
+		close(input.chunks)
+		close(input.done)
+	}
+}
+
+func (input *becomeInput) Read(p []byte) (int, error) {
+	if len(input.buffer) == 0 {
+		chunk, ok := <-input.chunks
+		if !ok {
+			return 0, io.EOF
+		}
+		input.buffer = chunk
+	}
+	n := copy(p, input.buffer)
+	input.buffer = input.buffer[n:]
+	return n, nil
+}
+
+// writerFunc is a writer which never fails.
+type writerFunc func(p []byte)
+
+func (fn writerFunc) Write(p []byte) (int, error) {
+	fn(p)
+	return len(p), nil
+}
+
+// Put writes the content to the file as the become user. The content is the input of the command,
+// so that it is not readable by the other users on the way.
+func (conn *becomeConnection) Put(ctx context.Context, content []byte, path string, mode os.FileMode) error {
+	if content == nil {
+		content = []byte{}
+	}
+	_, err := conn.Exec(ctx, putCommand(path, mode), defs.ExecOptions{Stdin: content})
+	if err != nil {
+		return fileCommandError("put", path, err)
+	}
+	return nil
+}
+
+func (conn *becomeConnection) Fetch(ctx context.Context, path string) ([]byte, error) {
+	result, err := conn.Exec(ctx, "cat -- "+shellQuote(path), defs.ExecOptions{})
+	if err != nil {
+		return nil, fileCommandError("fetch", path, err)
+	}
+	return []byte(result.Stdout), nil
+}
+
+func (conn *becomeConnection) Stat(ctx context.Context, path string) (*defs.FileStat, error) {
+	result, err := conn.Exec(ctx, statCommand(path), defs.ExecOptions{})
+	if err != nil {
+		return nil, fileCommandError("stat", path, err)
+	}
+	return parseStat(path, result.Stdout)
+}
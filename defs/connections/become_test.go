@@ -0,0 +1,157 @@
+package connections
+
+import (
+	"context"
+	"errors"
+	"goparse/defs"
+	"os"
+	fp "path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeSudo puts the fake sudo of the testdata on the path. It requires the password if it is set.
+func fakeSudo(t *testing.T, password string) {
+	t.Helper()
+	bin, err := fp.Abs(fp.Join("testdata", "bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_SUDO_PASSWORD", password)
+}
+
+func becomeLocal(t *testing.T, options defs.BecomeOptions) defs.Connection {
+	t.Helper()
+	conn, err := Become(&localConnection{}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestSudoCommand(t *testing.T) {
+	tests := []struct {
+		options defs.BecomeOptions
+		want    string
+	}{
+		{defs.BecomeOptions{User: "root"}, "sudo -H -S -n -u 'root' -- id"},
+		{defs.BecomeOptions{User: "root", Flags: "-E"}, "sudo -E -u 'root' -- id"},
+		{defs.BecomeOptions{User: "root", Password: "secret"}, "sudo -H -S -p 'prompt:' -u 'root' -- id"},
+		// The password is always read from the standard input.
+		{defs.BecomeOptions{User: "root", Flags: "-E -n", Password: "secret"}, "sudo -E -S -p 'prompt:' -u 'root' -- id"},
+	}
+	for _, test := range tests {
+		got, err := sudoCommand("id", test.options, "prompt:")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("sudoCommand(%+v) = %q, want %q", test.options, got, test.want)
+		}
+	}
+}
+
+func TestBecomeMethodCommands(t *testing.T) {
+	tests := []struct {
+		options defs.BecomeOptions
+		want    string
+		err     string
+	}{
+		{defs.BecomeOptions{Method: "su", User: "app"}, "su 'app' -c 'id'", ""},
+		{defs.BecomeOptions{Method: "su", User: "app", Flags: "-l"}, "su -l 'app' -c 'id'", ""},
+		{defs.BecomeOptions{Method: "su", User: "app", Password: "secret"}, "", "reads the password from a terminal"},
+		{defs.BecomeOptions{Method: "doas", User: "app"}, "doas -n -u 'app' id", ""},
+		{defs.BecomeOptions{Method: "doas", User: "app", Password: "secret"}, "", "reads the password from a terminal"},
+		{defs.BecomeOptions{Method: "runuser", User: "app"}, "runuser -u 'app' -- id", ""},
+		// runuser never prompts for the password.
+		{defs.BecomeOptions{Method: "runuser", User: "app", Password: "secret"}, "runuser -u 'app' -- id", ""},
+	}
+	for _, test := range tests {
+		got, err := becomeMethods[test.options.Method]("id", test.options, "prompt:")
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s(%+v) error = %v, want %q", test.options.Method, test.options, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("%s(%+v) = %q, want %q", test.options.Method, test.options, got, test.want)
+		}
+	}
+}
+
+func TestBecomePassword(t *testing.T) {
+	fakeSudo(t, "secret")
+	conn := becomeLocal(t, defs.BecomeOptions{Password: "secret"})
+	result, err := conn.Exec(context.Background(), "cat; echo done >&2", defs.ExecOptions{Stdin: []byte("input\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Stdout != "input\n" {
+		t.Errorf("stdout = %q, want the input", result.Stdout)
+	}
+	if result.Stderr != "done\n" {
+		t.Errorf("stderr = %q, want no prompt", result.Stderr)
+	}
+	result, err = conn.Exec(context.Background(), "cat", defs.ExecOptions{Input: strings.NewReader("streamed\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Stdout != "streamed\n" {
+		t.Errorf("stdout = %q, want the streamed input", result.Stdout)
+	}
+}
+
+func TestBecomePasswordNotPrompted(t *testing.T) {
+	// The password must not be read by the command if sudo does not prompt for it.
+	fakeSudo(t, "")
+	conn := becomeLocal(t, defs.BecomeOptions{Password: "secret"})
+	result, err := conn.Exec(context.Background(), "cat", defs.ExecOptions{Stdin: []byte("input\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Stdout != "input\n" {
+		t.Errorf("stdout = %q, want only the input", result.Stdout)
+	}
+	result, err = conn.Exec(context.Background(), "cat", defs.ExecOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Stdout != "" {
+		t.Errorf("stdout = %q, want no input", result.Stdout)
+	}
+}
+
+func TestBecomeIncorrectPassword(t *testing.T) {
+	fakeSudo(t, "secret")
+	conn := becomeLocal(t, defs.BecomeOptions{Password: "wrong"})
+	_, err := conn.Exec(context.Background(), "true", defs.ExecOptions{})
+	var exitErr *defs.ExitError
+	if !errors.As(err, &exitErr) || !strings.Contains(exitErr.Err.Error(), "Incorrect become password") {
+		t.Errorf("Exec = %v, want an incorrect password error", err)
+	}
+}
+
+func TestBecomeFiles(t *testing.T) {
+	for _, password := range []string{"", "secret"} {
+		fakeSudo(t, password)
+		conn := becomeLocal(t, defs.BecomeOptions{Password: password})
+		path := fp.Join(t.TempDir(), "file")
+		err := conn.Put(context.Background(), []byte("content\n"), path, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := conn.Fetch(context.Background(), path)
+		if err != nil || string(content) != "content\n" {
+			t.Errorf("Fetch = %q, %v", content, err)
+		}
+		stat, err := conn.Stat(context.Background(), path)
+		if err != nil || !stat.Exists || stat.Mode != 0600 || stat.Size != 8 {
+			t.Errorf("Stat = %+v, %v", stat, err)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package connections
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"goparse/defs"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stringVar returns the first variable which is set.
+func stringVar(vars defs.Config, defaultValue string, names ...string) string {
+	for _, name := range names {
+		if value, ok := vars[name]; ok && value != nil {
+			if str := fmt.Sprint(value); str != "" {
+				return str
+			}
+		}
+	}
+	return defaultValue
+}
+
+func intVar(vars defs.Config, defaultValue int, names ...string) (int, error) {
+	str := stringVar(vars, "", names...)
+	if str == "" {
+		return defaultValue, nil
+	}
+	value, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid integer %s for %s", str, strings.Join(names, " or "))
+	}
+	return value, nil
+}
+
+func boolVar(vars defs.Config, defaultValue bool, names ...string) (bool, error) {
+	str := stringVar(vars, "", names...)
+	if str == "" {
+		return defaultValue, nil
+	}
+	switch strings.ToLower(str) {
+	case "yes", "y", "true", "on", "1":
+		return true, nil
+	case "no", "n", "false", "off", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("Invalid boolean %s for %s", str, strings.Join(names, " or "))
+}
+
+// shellQuote quotes the string for a POSIX shell.
+func shellQuote(str string) string {
+	return "'" + strings.ReplaceAll(str, "'", `'"'"'`) + "'"
+}
+
+// shellCommand returns the command line running the command with the shell in the directory
+// with the environment.
+func shellCommand(command string, options defs.ExecOptions) string {
+	return fmt.Sprintf("%s -c %s", executable(options), shellQuote(shellScript(command, options)))
+}
+
+// shellScript returns the script which runs the command in the directory with the environment.
+func shellScript(command string, options defs.ExecOptions) string {
+	var sb strings.Builder
+	keys := make([]string, 0, len(options.Env))
+	for key := range options.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		sb.WriteString(fmt.Sprintf("export %s=%s; ", key, shellQuote(options.Env[key])))
+	}
+	if options.Dir != "" {
+		sb.WriteString(fmt.Sprintf("cd %s && ", shellQuote(options.Dir)))
+	}
+	sb.WriteString(command)
+	return sb.String()
+}
+
+// runCommand runs the command on the controller. An ExitError is returned with the result
+// if the command exits with a non-zero status. The directory and the environment of the options are not used.
+func runCommand(ctx context.Context, name string, args []string, dir string, env []string, options defs.ExecOptions) (*defs.ExecResult, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	cmd.Env = env
+	if options.Stdin != nil {
+		cmd.Stdin = bytes.NewReader(options.Stdin)
+	} else if options.Input != nil {
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		go copyInput(stdin, options.Input)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = outputWriter(&stdout, options.Stdout)
+	cmd.Stderr = outputWriter(&stderr, options.Stderr)
+	err := cmd.Run()
+	result := &defs.ExecResult{Stdout: stdout.String(), Stderr: stderr.String()}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		result.ExitCode = exitErr.ExitCode()
+		return result, &defs.ExitError{ExitCode: result.ExitCode, Stderr: result.Stderr, Err: err}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// copyInput copies the input to the standard input of a command, which is closed at the end.
+// It stops when the command exits as the standard input is closed.
+func copyInput(stdin io.WriteCloser, input io.Reader) {
+	io.Copy(stdin, input)
+	stdin.Close()
+}
+
+// outputWriter returns the writer to the buffer which also writes to the writer of the options if it is set.
+func outputWriter(buffer *bytes.Buffer, writer io.Writer) io.Writer {
+	if writer == nil {
+		return buffer
+	}
+	return io.MultiWriter(buffer, writer)
+}
+
+func executable(options defs.ExecOptions) string {
+	if options.Executable == "" {
+		return "/bin/sh"
+	}
+	return options.Executable
+}
+
+// putCommand returns the command which writes the standard input to the file atomically.
+func putCommand(path string, mode os.FileMode) string {
+	if mode == 0 {
+		mode = 0644
+	}
+	return fmt.Sprintf(`tmp=$(mktemp "$(dirname -- %[1]s)/.goparse.XXXXXX") && cat > "$tmp" && chmod %04[2]o "$tmp" && mv -f -- "$tmp" %[1]s || { rm -f -- "$tmp"; exit 1; }`,
+		shellQuote(path), uint32(mode.Perm()))
+}
+
+// statCommand returns the command which prints the raw mode in hex, the size and the modification time of the file.
+func statCommand(path string) string {
+	return fmt.Sprintf(`if [ -e %[1]s ]; then stat -L -c '%%f %%s %%Y' -- %[1]s; else echo missing; fi`, shellQuote(path))
+}
+
+// parseStat parses the output of the stat command.
+func parseStat(path string, output string) (*defs.FileStat, error) {
+	fields := strings.Fields(output)
+	if len(fields) == 1 && fields[0] == "missing" {
+		return &defs.FileStat{Path: path}, nil
+	}
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("Unexpected stat output %q", output)
+	}
+	rawMode, err1 := strconv.ParseUint(fields[0], 16, 32)
+	size, err2 := strconv.ParseInt(fields[1], 10, 64)
+	modTime, err3 := strconv.ParseInt(fields[2], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return nil, fmt.Errorf("Unexpected stat output %q", output)
+	}
+	isDir := rawMode&0170000 == 0040000
+	mode := os.FileMode(rawMode & 0777)
+	if isDir {
+		mode |= os.ModeDir
+	}
+	return &defs.FileStat{
+		Path:    path,
+		Exists:  true,
+		IsDir:   isDir,
+		Mode:    mode,
+		Size:    size,
+		ModTime: time.Unix(modTime, 0),
+	}, nil
+}
+
+// fileCommandError returns the error of a file operation with the standard error of the command.
+func fileCommandError(operation, path string, err error) error {
+	var exitErr *defs.ExitError
+	if errors.As(err, &exitErr) && exitErr.Stderr != "" {
+		return fmt.Errorf("Failed to %s %s: %w: %s", operation, path, err, strings.TrimSpace(exitErr.Stderr))
+	}
+	return fmt.Errorf("Failed to %s %s: %w", operation, path, err)
+}
@@ -0,0 +1,172 @@
+package connections
+
+import (
+	"context"
+	"fmt"
+	"goparse/defs"
+	"os"
+	fp "path/filepath"
+	"strings"
+)
+
+func init() {
+	defs.MustRegisterConnection(&Container{name: "docker"})
+	defs.MustRegisterConnection(&Container{name: "podman"})
+	defs.MustRegisterConnection(&Container{name: "kubectl", kubectl: true})
+}
+
+// Container runs the tasks in a container with the exec and cp commands of a container CLI.
+// The CLI is set by ansible_<name>_executable and the extra arguments before the command
+// are set by ansible_<name>_extra_args. The container is ansible_host or the host name.
+//
+// The docker and podman connections run as ansible_user if it is set. The kubectl connection
+// uses the pod ansible_kubectl_pod, the container ansible_kubectl_container and the namespace
+// ansible_kubectl_namespace if they are set.
+type Container struct {
+	name    string
+	kubectl bool
+}
+
+type containerConnection struct {
+	plugin     *Container
+	executable string
+	extraArgs  []string
+	container  string
+	user       string
+	// The pod and the namespace of kubectl.
+	pod       string
+	namespace string
+}
+
+func (plugin *Container) Name() string {
+	return plugin.name
+}
+
+func (plugin *Container) Connect(ctx context.Context, host string, vars defs.Config) (defs.Connection, error) {
+	conn := &containerConnection{
+		plugin:     plugin,
+		executable: stringVar(vars, plugin.name, "ansible_"+plugin.name+"_executable"),
+		extraArgs:  strings.Fields(stringVar(vars, "", "ansible_"+plugin.name+"_extra_args")),
+	}
+	if plugin.kubectl {
+		conn.pod = stringVar(vars, host, "ansible_kubectl_pod", "ansible_host")
+		conn.container = stringVar(vars, "", "ansible_kubectl_container")
+		conn.namespace = stringVar(vars, "", "ansible_kubectl_namespace")
+	} else {
+		conn.container = stringVar(vars, host, "ansible_host")
+		conn.user = stringVar(vars, "", "ansible_user")
+	}
+	return conn, nil
+}
+
+// execArgs returns the arguments of the CLI running the command in the container as the user.
+// The user is not supported by kubectl.
+func (conn *containerConnection) execArgs(user string, command []string) []string {
+	args := append([]string{}, conn.extraArgs...)
+	args = append(args, "exec", "-i")
+	if conn.plugin.kubectl {
+		if conn.namespace != "" {
+			args = append(args, "-n", conn.namespace)
+		}
+		if conn.container != "" {
+			args = append(args, "-c", conn.container)
+		}
+		args = append(args, conn.pod, "--")
+	} else {
+		if user != "" {
+			args = append(args, "-u", user)
+		}
+		args = append(args, conn.container)
+	}
+	return append(args, command...)
+}
+
+// cpArgs returns the arguments of the CLI copying the file. The path in the container has the prefix
+// returned by remotePath.
+func (conn *containerConnection) cpArgs(src, dest string) []string {
+	args := append([]string{}, conn.extraArgs...)
+	args = append(args, "cp", src, dest)
+	if conn.plugin.kubectl && conn.container != "" {
+		args = append(args, "-c", conn.container)
+	}
+	return args
+}
+
+// remotePath returns the path in the container for the cp command.
+func (conn *containerConnection) remotePath(path string) string {
+	if !conn.plugin.kubectl {
+		return conn.container + ":" + path
+	}
+	if conn.namespace != "" {
+		return conn.namespace + "/" + conn.pod + ":" + path
+	}
+	return conn.pod + ":" + path
+}
+
+func (conn *containerConnection) run(ctx context.Context, args []string, options defs.ExecOptions) (*defs.ExecResult, error) {
+	return runCommand(ctx, conn.executable, args, "", nil, options)
+}
+
+func (conn *containerConnection) Exec(ctx context.Context, command string, options defs.ExecOptions) (*defs.ExecResult, error) {
+	args := conn.execArgs(conn.user, []string{executable(options), "-c", shellScript(command, options)})
+	return conn.run(ctx, args, options)
+}
+
+func (conn *containerConnection) Put(ctx context.Context, content []byte, path string, mode os.FileMode) error {
+	if mode == 0 {
+		mode = 0644
+	}
+	file, err := os.CreateTemp("", "goparse-put-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	_, err = conn.run(ctx, conn.cpArgs(file.Name(), conn.remotePath(path)), defs.ExecOptions{})
+	if err != nil {
+		return fileCommandError("put", path, err)
+	}
+	// The mode is set in the container since the CLIs copy the mode and the owner differently.
+	// It is set as root since docker and podman copy the file as root.
+	user := ""
+	if !conn.plugin.kubectl {
+		user = "0"
+	}
+	_, err = conn.run(ctx, conn.execArgs(user, []string{"chmod", fmt.Sprintf("%04o", uint32(mode.Perm())), "--", path}), defs.ExecOptions{})
+	if err != nil {
+		return fileCommandError("put", path, err)
+	}
+	return nil
+}
+
+func (conn *containerConnection) Fetch(ctx context.Context, path string) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "goparse-fetch-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	dest := fp.Join(dir, fp.Base(path))
+	_, err = conn.run(ctx, conn.cpArgs(conn.remotePath(path), dest), defs.ExecOptions{})
+	if err != nil {
+		return nil, fileCommandError("fetch", path, err)
+	}
+	return os.ReadFile(dest)
+}
+
+func (conn *containerConnection) Stat(ctx context.Context, path string) (*defs.FileStat, error) {
+	result, err := conn.Exec(ctx, statCommand(path), defs.ExecOptions{})
+	if err != nil {
+		return nil, fileCommandError("stat", path, err)
+	}
+	return parseStat(path, result.Stdout)
+}
+
+func (conn *containerConnection) Close() error {
+	return nil
+}
@@ -0,0 +1,103 @@
+package connections
+
+import (
+	"context"
+	"goparse/defs"
+	"os"
+	fp "path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// connectFakeCLI connects to the container with the fake CLI of the testdata.
+// It returns the function which returns the logged arguments of the runs since the last call.
+func connectFakeCLI(t *testing.T, name string, vars defs.Config) (defs.Connection, func() []string) {
+	t.Helper()
+	executable, err := fp.Abs(fp.Join("testdata", "bin", "fakecli"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := fp.Join(t.TempDir(), "log")
+	t.Setenv("FAKE_CLI_LOG", log)
+	vars["ansible_"+name+"_executable"] = executable
+	conn, err := defs.Connect(context.Background(), name, "web", vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := func() []string {
+		data, _ := os.ReadFile(log)
+		os.Remove(log)
+		return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+	return conn, runs
+}
+
+func TestDockerConnection(t *testing.T) {
+	conn, runs := connectFakeCLI(t, "docker", defs.Config{
+		"ansible_user":              "app",
+		"ansible_docker_extra_args": "--context test",
+	})
+	ctx := context.Background()
+	result, err := conn.Exec(ctx, "cat", defs.ExecOptions{Stdin: []byte("input\n"), Dir: "/"})
+	if err != nil || result.Stdout != "input\n" {
+		t.Fatalf("Exec = %+v, %v", result, err)
+	}
+	want := []string{"--context|test|exec|-i|-u|app|web|/bin/sh|-c|cd '/' && cat|"}
+	if got := runs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("exec runs = %q, want %q", got, want)
+	}
+	path := fp.Join(t.TempDir(), "file")
+	err = conn.Put(ctx, []byte("content\n"), path, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := runs()
+	if len(got) != 2 || !strings.HasPrefix(got[0], "--context|test|cp|") || !strings.HasSuffix(got[0], "|web:"+path+"|") {
+		t.Errorf("cp run = %q", got)
+	}
+	// The mode is set as root regardless of ansible_user.
+	if want := "--context|test|exec|-i|-u|0|web|chmod|0600|--|" + path + "|"; len(got) != 2 || got[1] != want {
+		t.Errorf("chmod run = %q, want %q", got, want)
+	}
+	content, err := conn.Fetch(ctx, path)
+	if err != nil || string(content) != "content\n" {
+		t.Errorf("Fetch = %q, %v", content, err)
+	}
+	if got := runs(); len(got) != 1 || !strings.HasPrefix(got[0], "--context|test|cp|web:"+path+"|") {
+		t.Errorf("fetch runs = %q", got)
+	}
+	stat, err := conn.Stat(ctx, path)
+	if err != nil || !stat.Exists || stat.Mode != 0600 {
+		t.Errorf("Stat = %+v, %v", stat, err)
+	}
+}
+
+func TestKubectlConnection(t *testing.T) {
+	conn, runs := connectFakeCLI(t, "kubectl", defs.Config{
+		"ansible_kubectl_pod":       "pod",
+		"ansible_kubectl_container": "main",
+		"ansible_kubectl_namespace": "apps",
+	})
+	ctx := context.Background()
+	result, err := conn.Exec(ctx, "echo hello", defs.ExecOptions{})
+	if err != nil || result.Stdout != "hello\n" {
+		t.Fatalf("Exec = %+v, %v", result, err)
+	}
+	want := []string{"exec|-i|-n|apps|-c|main|pod|--|/bin/sh|-c|echo hello|"}
+	if got := runs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("exec runs = %q, want %q", got, want)
+	}
+	path := fp.Join(t.TempDir(), "file")
+	err = conn.Put(ctx, []byte("content\n"), path, 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := runs()
+	if len(got) != 2 || !strings.HasSuffix(got[0], "|apps/pod:"+path+"|-c|main|") {
+		t.Errorf("cp run = %q", got)
+	}
+	if want := "exec|-i|-n|apps|-c|main|pod|--|chmod|0640|--|" + path + "|"; len(got) != 2 || got[1] != want {
+		t.Errorf("chmod run = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,74 @@
+package connections
+
+import (
+	"context"
+	"errors"
+	"goparse/defs"
+	"os"
+)
+
+func init() {
+	defs.MustRegisterConnection(&Local{})
+}
+
+// Local runs the tasks on the controller.
+type Local struct{}
+
+type localConnection struct{}
+
+func (plugin *Local) Name() string {
+	return "local"
+}
+
+func (plugin *Local) Connect(ctx context.Context, host string, vars defs.Config) (defs.Connection, error) {
+	return &localConnection{}, nil
+}
+
+func (conn *localConnection) Exec(ctx context.Context, command string, options defs.ExecOptions) (*defs.ExecResult, error) {
+	var env []string
+	if len(options.Env) > 0 {
+		env = os.Environ()
+		for key, value := range options.Env {
+			env = append(env, key+"="+value)
+		}
+	}
+	return runCommand(ctx, executable(options), []string{"-c", command}, options.Dir, env, options)
+}
+
+func (conn *localConnection) Put(ctx context.Context, content []byte, path string, mode os.FileMode) error {
+	if mode == 0 {
+		mode = 0644
+	}
+	err := os.WriteFile(path, content, mode)
+	if err != nil {
+		return err
+	}
+	// The mode of an existing file is not changed by WriteFile.
+	return os.Chmod(path, mode)
+}
+
+func (conn *localConnection) Fetch(ctx context.Context, path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+func (conn *localConnection) Stat(ctx context.Context, path string) (*defs.FileStat, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &defs.FileStat{Path: path}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &defs.FileStat{
+		Path:    path,
+		Exists:  true,
+		IsDir:   info.IsDir(),
+		Mode:    info.Mode() & (os.ModeDir | os.ModePerm),
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}, nil
+}
+
+func (conn *localConnection) Close() error {
+	return nil
+}
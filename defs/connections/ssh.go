@@ -0,0 +1,377 @@
+package connections
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"goparse/defs"
+	"net"
+	"os"
+	"os/user"
+	fp "path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	// DefaultSSHControlPersist is how long an idle SSH client is kept for reuse.
+	DefaultSSHControlPersist = 60 * time.Second
+	// DefaultSSHTimeout is the timeout of establishing an SSH connection.
+	DefaultSSHTimeout = 10 * time.Second
+)
+
+var (
+	defaultIdentityFiles  = []string{"id_rsa", "id_ecdsa", "id_ed25519"}
+	defaultKnownHostFiles = []string{"~/.ssh/known_hosts", "/etc/ssh/ssh_known_hosts"}
+)
+
+func init() {
+	defs.MustRegisterConnection(&SSH{ControlPersist: DefaultSSHControlPersist})
+}
+
+// SSH runs the tasks on the remote hosts over SSH. It uses the variables
+//
+//	ansible_host, ansible_port, ansible_user, ansible_password,
+//	ansible_ssh_private_key_file, ansible_host_key_checking,
+//	ansible_ssh_known_hosts_file and ansible_ssh_timeout.
+//
+// The keys in the SSH agent and the default identity files are used if no key file is set.
+// The clients are shared by the connections with the same parameters and an idle client
+// is kept for ControlPersist.
+type SSH struct {
+	ControlPersist time.Duration
+	mutex          sync.Mutex
+	clients        map[sshClientKey]*sshClient
+}
+
+// sshClientKey is the parameters of an SSH client.
+type sshClientKey struct {
+	address         string
+	user            string
+	password        string
+	keyFile         string
+	hostKeyChecking bool
+	knownHostsFile  string
+}
+
+// sshClient is a shared SSH client. It is closed after ControlPersist when it has no references.
+type sshClient struct {
+	client *ssh.Client
+	refs   int
+	timer  *time.Timer
+}
+
+type sshConnection struct {
+	plugin *SSH
+	key    sshClientKey
+	client *sshClient
+	once   sync.Once
+}
+
+func (plugin *SSH) Name() string {
+	return "ssh"
+}
+
+func (plugin *SSH) Connect(ctx context.Context, host string, vars defs.Config) (defs.Connection, error) {
+	key, timeout, err := sshParams(host, vars)
+	if err != nil {
+		return nil, err
+	}
+	if client := plugin.acquire(key); client != nil {
+		return &sshConnection{plugin: plugin, key: key, client: client}, nil
+	}
+	// The lock is not held while dialing so that the hosts are connected in parallel.
+	sshClient, err := dialSSH(ctx, key, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to connect to %s: %w", key.address, err)
+	}
+	client := plugin.add(key, sshClient)
+	return &sshConnection{plugin: plugin, key: key, client: client}, nil
+}
+
+func sshParams(host string, vars defs.Config) (sshClientKey, time.Duration, error) {
+	key := sshClientKey{}
+	port, err := intVar(vars, 22, "ansible_port", "ansible_ssh_port")
+	if err != nil {
+		return key, 0, err
+	}
+	key.address = net.JoinHostPort(stringVar(vars, host, "ansible_host", "ansible_ssh_host"), strconv.Itoa(port))
+	key.user = stringVar(vars, "", "ansible_user", "ansible_ssh_user")
+	if key.user == "" {
+		current, err := user.Current()
+		if err != nil {
+			return key, 0, err
+		}
+		key.user = current.Username
+	}
+	key.password = stringVar(vars, "", "ansible_password", "ansible_ssh_pass", "ansible_ssh_password")
+	key.keyFile = stringVar(vars, "", "ansible_ssh_private_key_file", "ansible_private_key_file")
+	// The environment variable is the default of the host variables.
+	hostKeyChecking, err := boolVar(defs.Config{"ANSIBLE_HOST_KEY_CHECKING": os.Getenv("ANSIBLE_HOST_KEY_CHECKING")}, true, "ANSIBLE_HOST_KEY_CHECKING")
+	if err != nil {
+		return key, 0, err
+	}
+	key.hostKeyChecking, err = boolVar(vars, hostKeyChecking, "ansible_host_key_checking", "ansible_ssh_host_key_checking")
+	if err != nil {
+		return key, 0, err
+	}
+	key.knownHostsFile = stringVar(vars, "", "ansible_ssh_known_hosts_file")
+	seconds, err := intVar(vars, int(DefaultSSHTimeout/time.Second), "ansible_ssh_timeout", "ansible_timeout")
+	if err != nil {
+		return key, 0, err
+	}
+	return key, time.Duration(seconds) * time.Second, nil
+}
+
+func dialSSH(ctx context.Context, key sshClientKey, timeout time.Duration) (*ssh.Client, error) {
+	hostKeyCallback := ssh.InsecureIgnoreHostKey()
+	if key.hostKeyChecking {
+		var err error
+		hostKeyCallback, err = knownHostsCallback(key.knownHostsFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	auth, closeAgent := sshAuthMethods(key)
+	defer closeAgent()
+	config := &ssh.ClientConfig{
+		User:            key.user,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         timeout,
+	}
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", key.address)
+	if err != nil {
+		return nil, err
+	}
+	// The deadline covers the handshake and the authentication.
+	conn.SetDeadline(time.Now().Add(timeout))
+	clientConn, channels, requests, err := ssh.NewClientConn(conn, key.address, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return ssh.NewClient(clientConn, channels, requests), nil
+}
+
+func knownHostsCallback(file string) (ssh.HostKeyCallback, error) {
+	candidates := defaultKnownHostFiles
+	if file != "" {
+		candidates = []string{file}
+	}
+	files := []string{}
+	for _, candidate := range candidates {
+		path := expandHome(candidate)
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, path)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("Host key checking is enabled, but no known hosts file is found in %v", candidates)
+	}
+	return knownhosts.New(files...)
+}
+
+// sshAuthMethods returns the authentication methods and the function closing the agent connection.
+func sshAuthMethods(key sshClientKey) ([]ssh.AuthMethod, func()) {
+	methods := []ssh.AuthMethod{}
+	closeAgent := func() {}
+	signers := []ssh.Signer{}
+	keyFiles := []string{}
+	if key.keyFile != "" {
+		keyFiles = append(keyFiles, expandHome(key.keyFile))
+	} else {
+		for _, name := range defaultIdentityFiles {
+			keyFiles = append(keyFiles, expandHome(fp.Join("~/.ssh", name)))
+		}
+	}
+	for _, keyFile := range keyFiles {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			continue
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" && key.keyFile == "" {
+		if conn, err := net.Dial("unix", socket); err == nil {
+			closeAgent = func() { conn.Close() }
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	if key.password != "" {
+		methods = append(methods, ssh.Password(key.password))
+	}
+	return methods, closeAgent
+}
+
+func expandHome(path string) string {
+	if len(path) < 2 || path[:2] != "~/" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return fp.Join(home, path[2:])
+}
+
+// acquire returns the shared client with a new reference if it exists.
+func (plugin *SSH) acquire(key sshClientKey) *sshClient {
+	plugin.mutex.Lock()
+	defer plugin.mutex.Unlock()
+	client, ok := plugin.clients[key]
+	if !ok {
+		return nil
+	}
+	client.refs++
+	if client.timer != nil {
+		client.timer.Stop()
+		client.timer = nil
+	}
+	return client
+}
+
+// add shares the new client unless another one is added while dialing.
+func (plugin *SSH) add(key sshClientKey, newClient *ssh.Client) *sshClient {
+	if client := plugin.acquire(key); client != nil {
+		newClient.Close()
+		return client
+	}
+	plugin.mutex.Lock()
+	defer plugin.mutex.Unlock()
+	if plugin.clients == nil {
+		plugin.clients = map[sshClientKey]*sshClient{}
+	}
+	client := &sshClient{client: newClient, refs: 1}
+	plugin.clients[key] = client
+	go func() {
+		// The client is removed when the server closes the connection.
+		newClient.Wait()
+		plugin.remove(key, client)
+	}()
+	return client
+}
+
+func (plugin *SSH) remove(key sshClientKey, client *sshClient) {
+	plugin.mutex.Lock()
+	defer plugin.mutex.Unlock()
+	if plugin.clients[key] == client {
+		delete(plugin.clients, key)
+	}
+}
+
+// release removes a reference. The client is closed after ControlPersist without references.
+func (plugin *SSH) release(key sshClientKey, client *sshClient) {
+	plugin.mutex.Lock()
+	defer plugin.mutex.Unlock()
+	client.refs--
+	if client.refs > 0 {
+		return
+	}
+	if plugin.clients[key] != client || plugin.ControlPersist <= 0 {
+		delete(plugin.clients, key)
+		client.client.Close()
+		return
+	}
+	client.timer = time.AfterFunc(plugin.ControlPersist, func() {
+		plugin.mutex.Lock()
+		defer plugin.mutex.Unlock()
+		if client.refs == 0 && plugin.clients[key] == client {
+			delete(plugin.clients, key)
+			client.client.Close()
+		}
+	})
+}
+
+func (conn *sshConnection) Exec(ctx context.Context, command string, options defs.ExecOptions) (*defs.ExecResult, error) {
+	session, err := conn.client.client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	if options.Stdin != nil {
+		session.Stdin = bytes.NewReader(options.Stdin)
+	} else if options.Input != nil {
+		stdin, err := session.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		go copyInput(stdin, options.Input)
+	}
+	var stdout, stderr bytes.Buffer
+	session.Stdout = outputWriter(&stdout, options.Stdout)
+	session.Stderr = outputWriter(&stderr, options.Stderr)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			session.Signal(ssh.SIGKILL)
+			session.Close()
+		case <-done:
+		}
+	}()
+	err = session.Run(shellCommand(command, options))
+	result := &defs.ExecResult{Stdout: stdout.String(), Stderr: stderr.String()}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		result.ExitCode = exitErr.ExitStatus()
+		return result, &defs.ExitError{ExitCode: result.ExitCode, Stderr: result.Stderr, Err: err}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (conn *sshConnection) Put(ctx context.Context, content []byte, path string, mode os.FileMode) error {
+	if content == nil {
+		content = []byte{}
+	}
+	_, err := conn.Exec(ctx, putCommand(path, mode), defs.ExecOptions{Stdin: content})
+	if err != nil {
+		return fileCommandError("put", path, err)
+	}
+	return nil
+}
+
+func (conn *sshConnection) Fetch(ctx context.Context, path string) ([]byte, error) {
+	result, err := conn.Exec(ctx, "cat -- "+shellQuote(path), defs.ExecOptions{})
+	if err != nil {
+		return nil, fileCommandError("fetch", path, err)
+	}
+	return []byte(result.Stdout), nil
+}
+
+func (conn *sshConnection) Stat(ctx context.Context, path string) (*defs.FileStat, error) {
+	result, err := conn.Exec(ctx, statCommand(path), defs.ExecOptions{})
+	if err != nil {
+		return nil, fileCommandError("stat", path, err)
+	}
+	return parseStat(path, result.Stdout)
+}
+
+func (conn *sshConnection) Close() error {
+	conn.once.Do(func() {
+		conn.plugin.release(conn.key, conn.client)
+	})
+	return nil
+}
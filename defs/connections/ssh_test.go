@@ -0,0 +1,293 @@
+package connections
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"goparse/defs"
+	"net"
+	"os"
+	"os/exec"
+	fp "path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testSSHServer runs the commands of the sessions on the controller.
+type testSSHServer struct {
+	address     string
+	hostKey     ssh.Signer
+	connections atomic.Int32
+}
+
+func newTestSSHServer(t *testing.T) *testSSHServer {
+	t.Helper()
+	hostKey := newTestSigner(t)
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if meta.User() == "tester" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, errors.New("Access denied")
+		},
+	}
+	config.AddHostKey(hostKey)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	server := &testSSHServer{address: listener.Addr().String(), hostKey: hostKey}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			server.connections.Add(1)
+			go server.serve(conn, config)
+		}
+	}()
+	return server
+}
+
+func newTestSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func (server *testSSHServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "Only sessions are supported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go server.session(channel, requests)
+	}
+}
+
+func (server *testSSHServer) session(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+	for request := range requests {
+		if request.Type != "exec" {
+			request.Reply(false, nil)
+			continue
+		}
+		var payload struct{ Command string }
+		err := ssh.Unmarshal(request.Payload, &payload)
+		request.Reply(err == nil, nil)
+		if err != nil {
+			return
+		}
+		cmd := exec.Command("/bin/sh", "-c", payload.Command)
+		cmd.Stdin = channel
+		cmd.Stdout = channel
+		cmd.Stderr = channel.Stderr()
+		status := 0
+		err = cmd.Run()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			status = exitErr.ExitCode()
+		} else if err != nil {
+			status = 255
+		}
+		channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(status)}))
+		return
+	}
+}
+
+// vars returns the variables connecting to the server.
+func (server *testSSHServer) vars(hostKeyChecking bool) defs.Config {
+	host, port, _ := net.SplitHostPort(server.address)
+	return defs.Config{
+		"ansible_host":              host,
+		"ansible_port":              port,
+		"ansible_user":              "tester",
+		"ansible_password":          "secret",
+		"ansible_host_key_checking": hostKeyChecking,
+	}
+}
+
+func connectTestSSH(t *testing.T, plugin *SSH, vars defs.Config) defs.Connection {
+	t.Helper()
+	// The keys of the agent and the user are not used.
+	t.Setenv("SSH_AUTH_SOCK", "")
+	t.Setenv("HOME", t.TempDir())
+	conn, err := plugin.Connect(context.Background(), "test", vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestSSHExec(t *testing.T) {
+	server := newTestSSHServer(t)
+	plugin := &SSH{}
+	conn := connectTestSSH(t, plugin, server.vars(false))
+	defer conn.Close()
+	ctx := context.Background()
+	result, err := conn.Exec(ctx, `cat; echo "$GREETING" >&2`, defs.ExecOptions{Stdin: []byte("input\n"), Env: defs.StrConfig{"GREETING": "hello"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Stdout != "input\n" || result.Stderr != "hello\n" || result.ExitCode != 0 {
+		t.Errorf("Exec = %+v", result)
+	}
+	result, err = conn.Exec(ctx, "echo failed >&2; exit 3", defs.ExecOptions{})
+	var exitErr *defs.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode != 3 || exitErr.Stderr != "failed\n" {
+		t.Errorf("Exec = %v, want exit status 3", err)
+	}
+	if result == nil || result.ExitCode != 3 {
+		t.Errorf("Exec = %+v, want the result with exit code 3", result)
+	}
+}
+
+func TestSSHFiles(t *testing.T) {
+	server := newTestSSHServer(t)
+	conn := connectTestSSH(t, &SSH{}, server.vars(false))
+	defer conn.Close()
+	ctx := context.Background()
+	path := fp.Join(t.TempDir(), "file")
+	stat, err := conn.Stat(ctx, path)
+	if err != nil || stat.Exists {
+		t.Fatalf("Stat = %+v, %v, want a missing file", stat, err)
+	}
+	err = conn.Put(ctx, []byte("content\n"), path, 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := conn.Fetch(ctx, path)
+	if err != nil || string(content) != "content\n" {
+		t.Errorf("Fetch = %q, %v", content, err)
+	}
+	stat, err = conn.Stat(ctx, path)
+	if err != nil || !stat.Exists || stat.IsDir || stat.Mode != 0640 || stat.Size != 8 {
+		t.Errorf("Stat = %+v, %v", stat, err)
+	}
+	_, err = conn.Fetch(ctx, fp.Join(path, "missing"))
+	if err == nil {
+		t.Errorf("Fetch of a missing file succeeded")
+	}
+}
+
+func TestSSHClientReuse(t *testing.T) {
+	server := newTestSSHServer(t)
+	plugin := &SSH{ControlPersist: 200 * time.Millisecond}
+	vars := server.vars(false)
+	first := connectTestSSH(t, plugin, vars)
+	second := connectTestSSH(t, plugin, vars)
+	if got := server.connections.Load(); got != 1 {
+		t.Errorf("connections = %d, want 1 shared", got)
+	}
+	first.Close()
+	second.Close()
+	// The idle client is kept for ControlPersist.
+	third := connectTestSSH(t, plugin, vars)
+	if _, err := third.Exec(context.Background(), "true", defs.ExecOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.connections.Load(); got != 1 {
+		t.Errorf("connections = %d, want 1 persisted", got)
+	}
+	third.Close()
+	time.Sleep(500 * time.Millisecond)
+	fourth := connectTestSSH(t, plugin, vars)
+	defer fourth.Close()
+	if got := server.connections.Load(); got != 2 {
+		t.Errorf("connections = %d, want 2 after ControlPersist", got)
+	}
+}
+
+func TestSSHHostKeyChecking(t *testing.T) {
+	server := newTestSSHServer(t)
+	dir := t.TempDir()
+	for _, test := range []struct {
+		name    string
+		hostKey ssh.PublicKey
+		ok      bool
+	}{
+		{"known", server.hostKey.PublicKey(), true},
+		{"changed", newTestSigner(t).PublicKey(), false},
+	} {
+		knownHosts := fp.Join(dir, test.name)
+		line := knownhosts.Line([]string{server.address}, test.hostKey) + "\n"
+		err := os.WriteFile(knownHosts, []byte(line), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vars := server.vars(true)
+		vars["ansible_ssh_known_hosts_file"] = knownHosts
+		t.Setenv("SSH_AUTH_SOCK", "")
+		conn, err := (&SSH{}).Connect(context.Background(), "test", vars)
+		if (err == nil) != test.ok {
+			t.Errorf("%s host key: Connect = %v, want ok %v", test.name, err, test.ok)
+		}
+		var keyErr *knownhosts.KeyError
+		if !test.ok && (!errors.As(err, &keyErr) || len(keyErr.Want) == 0) {
+			t.Errorf("%s host key: Connect = %v, want a key mismatch", test.name, err)
+		}
+		if conn != nil {
+			conn.Close()
+		}
+	}
+}
+
+func TestSSHHostKeyCheckingEnvironment(t *testing.T) {
+	tests := []struct {
+		env  string
+		vars defs.Config
+		want bool
+		err  bool
+	}{
+		{env: "", want: true},
+		{env: "False", want: false},
+		{env: "false", want: false},
+		{env: "no", want: false},
+		{env: "0", want: false},
+		{env: "True", want: true},
+		{env: "False", vars: defs.Config{"ansible_host_key_checking": true}, want: true},
+		{env: "yes", vars: defs.Config{"ansible_ssh_host_key_checking": "no"}, want: false},
+		{env: "maybe", err: true},
+	}
+	for _, test := range tests {
+		t.Setenv("ANSIBLE_HOST_KEY_CHECKING", test.env)
+		vars := defs.Config{"ansible_user": "tester", "ansible_port": strconv.Itoa(22)}
+		for key, value := range test.vars {
+			vars[key] = value
+		}
+		key, _, err := sshParams("test", vars)
+		if (err != nil) != test.err {
+			t.Errorf("ANSIBLE_HOST_KEY_CHECKING=%s: sshParams = %v", test.env, err)
+			continue
+		}
+		if err == nil && key.hostKeyChecking != test.want {
+			t.Errorf("ANSIBLE_HOST_KEY_CHECKING=%s %v: hostKeyChecking = %v, want %v", test.env, test.vars, key.hostKeyChecking, test.want)
+		}
+	}
+}
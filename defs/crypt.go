@@ -0,0 +1,168 @@
+package defs
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"math/big"
+	"strings"
+)
+
+const (
+	cryptAlphabet      = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	cryptDefaultRounds = 5000
+	cryptMinRounds     = 1000
+	cryptMaxRounds     = 999999999
+	cryptMaxSaltLength = 16
+)
+
+var (
+	// Byte triplets in the order of the output encoding of the SHA-256 crypt.
+	sha256CryptOrder = [][3]int{
+		{0, 10, 20}, {21, 1, 11}, {12, 22, 2}, {3, 13, 23}, {24, 4, 14},
+		{15, 25, 5}, {6, 16, 26}, {27, 7, 17}, {18, 28, 8}, {9, 19, 29},
+	}
+	// Byte triplets in the order of the output encoding of the SHA-512 crypt.
+	sha512CryptOrder = [][3]int{
+		{0, 21, 42}, {22, 43, 1}, {44, 2, 23}, {3, 24, 45}, {25, 46, 4},
+		{47, 5, 26}, {6, 27, 48}, {28, 49, 7}, {50, 8, 29}, {9, 30, 51},
+		{31, 52, 10}, {53, 11, 32}, {12, 33, 54}, {34, 55, 13}, {56, 14, 35},
+		{15, 36, 57}, {37, 58, 16}, {59, 17, 38}, {18, 39, 60}, {40, 61, 19},
+		{62, 20, 41},
+	}
+)
+
+// randomSalt returns a random salt made of the crypt alphabet.
+func randomSalt(length int) (string, error) {
+	var sb strings.Builder
+	max := big.NewInt(int64(len(cryptAlphabet)))
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(cryptAlphabet[n.Int64()])
+	}
+	return sb.String(), nil
+}
+
+// shaCrypt implements the SHA-256 and SHA-512 based crypt(3) of glibc.
+// Rounds is the default if it is not positive.
+func shaCrypt(hashType string, password, salt string, rounds int) (string, error) {
+	var newHash func() hash.Hash
+	var prefix string
+	var order [][3]int
+	switch hashType {
+	case "sha256":
+		newHash, prefix, order = sha256.New, "$5$", sha256CryptOrder
+	case "sha512":
+		newHash, prefix, order = sha512.New, "$6$", sha512CryptOrder
+	default:
+		return "", fmt.Errorf("Unsupported crypt hash type %s", hashType)
+	}
+	customRounds := rounds > 0
+	if !customRounds {
+		rounds = cryptDefaultRounds
+	} else if rounds < cryptMinRounds {
+		rounds = cryptMinRounds
+	} else if rounds > cryptMaxRounds {
+		rounds = cryptMaxRounds
+	}
+	if len(salt) > cryptMaxSaltLength {
+		salt = salt[:cryptMaxSaltLength]
+	}
+	p, s := []byte(password), []byte(salt)
+
+	b := newHash()
+	b.Write(p)
+	b.Write(s)
+	b.Write(p)
+	digestB := b.Sum(nil)
+
+	a := newHash()
+	a.Write(p)
+	a.Write(s)
+	a.Write(repeatBytes(digestB, len(p)))
+	for n := len(p); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			a.Write(digestB)
+		} else {
+			a.Write(p)
+		}
+	}
+	digestA := a.Sum(nil)
+
+	dp := newHash()
+	for i := 0; i < len(p); i++ {
+		dp.Write(p)
+	}
+	seqP := repeatBytes(dp.Sum(nil), len(p))
+
+	ds := newHash()
+	for i := 0; i < 16+int(digestA[0]); i++ {
+		ds.Write(s)
+	}
+	seqS := repeatBytes(ds.Sum(nil), len(s))
+
+	digest := digestA
+	for i := 0; i < rounds; i++ {
+		c := newHash()
+		if i&1 != 0 {
+			c.Write(seqP)
+		} else {
+			c.Write(digest)
+		}
+		if i%3 != 0 {
+			c.Write(seqS)
+		}
+		if i%7 != 0 {
+			c.Write(seqP)
+		}
+		if i&1 != 0 {
+			c.Write(digest)
+		} else {
+			c.Write(seqP)
+		}
+		digest = c.Sum(nil)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(prefix)
+	if customRounds {
+		sb.WriteString(fmt.Sprintf("rounds=%d$", rounds))
+	}
+	sb.WriteString(salt)
+	sb.WriteByte('$')
+	for _, triplet := range order {
+		encodeCrypt64(&sb, digest[triplet[0]], digest[triplet[1]], digest[triplet[2]], 4)
+	}
+	if len(digest) == sha256.Size {
+		encodeCrypt64(&sb, 0, digest[31], digest[30], 3)
+	} else {
+		encodeCrypt64(&sb, 0, 0, digest[63], 2)
+	}
+	return sb.String(), nil
+}
+
+// repeatBytes repeats the bytes to the length.
+func repeatBytes(data []byte, length int) []byte {
+	out := make([]byte, 0, length)
+	for len(out) < length {
+		n := length - len(out)
+		if n > len(data) {
+			n = len(data)
+		}
+		out = append(out, data[:n]...)
+	}
+	return out
+}
+
+func encodeCrypt64(sb *strings.Builder, b2, b1, b0 byte, n int) {
+	w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+	for i := 0; i < n; i++ {
+		sb.WriteByte(cryptAlphabet[w&0x3f])
+		w >>= 6
+	}
+}
@@ -0,0 +1,236 @@
+package defs
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Position is the location of an element in a YAML file.
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+type positioned interface {
+	position() *Position
+}
+
+// ParseError is the error in parsing or validating a YAML file.
+type ParseError struct {
+	Position
+	Err error
+}
+
+// TemplateError is the error in rendering a template.
+type TemplateError struct {
+	Position
+	Template string
+	Err      error
+}
+
+// TaskInitError is the error in initializing a task from the config.
+type TaskInitError struct {
+	Position
+	Task string
+	Err  error
+}
+
+// TaskRunError is the error returned by a task. Output is the output of the task if there is any.
+type TaskRunError struct {
+	Position
+	Task   string
+	Output Output
+	Err    error
+}
+
+// UndefinedVariableError is the error when a variable is referenced without being defined.
+type UndefinedVariableError struct {
+	Position
+	Name string
+}
+
+// ConditionError is the error in evaluating a when condition.
+type ConditionError struct {
+	Position
+	Condition string
+	Err       error
+}
+
+// IncludeError is the error from a file in a chain of included files.
+type IncludeError struct {
+	Chain []string
+	Err   error
+}
+
+// IncludeCycleError is the error when a file includes itself directly or indirectly.
+type IncludeCycleError struct {
+	Chain []string
+}
+
+// PlayAbortedError is the error when a play stops for the failed hosts. Hosts are the failed hosts of the batch.
+type PlayAbortedError struct {
+	Position
+	Play   string
+	Reason string
+	Hosts  []string
+}
+
+// HostsFailedError is the error when a playbook fails on some of the hosts.
+// Errors are the errors by the host names.
+type HostsFailedError struct {
+	Errors map[string]error
+}
+
+func (pos Position) String() string {
+	if pos.Line == 0 {
+		return pos.File
+	}
+	str := strconv.Itoa(pos.Line)
+	if pos.Column != 0 {
+		// The YAML syntax errors have no column.
+		str += ":" + strconv.Itoa(pos.Column)
+	}
+	if pos.File == "" {
+		return str
+	}
+	return pos.File + ":" + str
+}
+
+// NodePosition returns the position of the YAML node.
+func NodePosition(node *yaml.Node) Position {
+	return Position{Line: node.Line, Column: node.Column}
+}
+
+func (pos *Position) position() *Position {
+	return pos
+}
+
+func (pos *Position) format(msg string) string {
+	if str := pos.String(); str != "" {
+		return fmt.Sprintf("%s: %s", str, msg)
+	}
+	return msg
+}
+
+func (e *ParseError) Error() string {
+	return e.Position.format(e.Err.Error())
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+func (e *TemplateError) Error() string {
+	return e.Position.format(fmt.Sprintf("Failed to render template %q: %s", e.Template, e.Err))
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+func (e *TaskInitError) Error() string {
+	return e.Position.format(fmt.Sprintf("Init failed for task %s: %s", e.Task, e.Err))
+}
+
+func (e *TaskInitError) Unwrap() error {
+	return e.Err
+}
+
+func (e *TaskRunError) Error() string {
+	return e.Position.format(fmt.Sprintf("Task %s failed: %s", e.Task, e.Err))
+}
+
+func (e *TaskRunError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the exit code of the command which failed the task if there is any.
+func (e *TaskRunError) ExitCode() (int, bool) {
+	var exitErr *ExitError
+	if errors.As(e.Err, &exitErr) {
+		return exitErr.ExitCode, true
+	}
+	return 0, false
+}
+
+func (e *UndefinedVariableError) Error() string {
+	return e.Position.format(fmt.Sprintf("Variable %s is undefined", e.Name))
+}
+
+func (e *ConditionError) Error() string {
+	return e.Position.format(fmt.Sprintf("Failed to evaluate condition %q: %s", e.Condition, e.Err))
+}
+
+func (e *ConditionError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorPosition returns the position of the first error in the chain which carries a position.
+// The position can be updated if it is not set.
+func ErrorPosition(err error) (*Position, bool) {
+	var p positioned
+	if errors.As(err, &p) {
+		return p.position(), true
+	}
+	return nil, false
+}
+
+// newParseError wraps the error with the position of the node unless it is already a ParseError.
+func newParseError(node *yaml.Node, err error) error {
+	if err == nil {
+		return nil
+	}
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) {
+		return err
+	}
+	return &ParseError{Position: NodePosition(node), Err: err}
+}
+
+func (e *IncludeError) Error() string {
+	return fmt.Sprintf("%s (include chain: %s)", e.Err, strings.Join(e.Chain, " -> "))
+}
+
+func (e *IncludeError) Unwrap() error {
+	return e.Err
+}
+
+func (e *IncludeCycleError) Error() string {
+	return fmt.Sprintf("Include cycle detected: %s", strings.Join(e.Chain, " -> "))
+}
+
+func (e *PlayAbortedError) Error() string {
+	return e.Position.format(fmt.Sprintf("Play %s aborted: %s: %s", e.Play, e.Reason, strings.Join(e.Hosts, ", ")))
+}
+
+// Hosts returns the failed hosts sorted.
+func (e *HostsFailedError) Hosts() []string {
+	hosts := make([]string, 0, len(e.Errors))
+	for host := range e.Errors {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+func (e *HostsFailedError) Error() string {
+	msgs := []string{}
+	for _, host := range e.Hosts() {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", host, e.Errors[host]))
+	}
+	return fmt.Sprintf("Failed on %d hosts: %s", len(msgs), strings.Join(msgs, "; "))
+}
+
+func (e *HostsFailedError) Unwrap() []error {
+	errs := []error{}
+	for _, host := range e.Hosts() {
+		errs = append(errs, e.Errors[host])
+	}
+	return errs
+}
@@ -0,0 +1,172 @@
+package defs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	fp "path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// factCacheBackends create the fact caches by the backend names.
+	factCacheBackends = map[string]func(connection string, timeout time.Duration) (FactCache, error){
+		"memory":   newMemoryFactCache,
+		"jsonfile": newJSONFileFactCache,
+	}
+	// memoryFacts are the facts of the memory backend. They are shared by the caches in the process.
+	memoryFacts = &memoryFactStore{entries: map[string]memoryFactEntry{}}
+)
+
+// FactCache keeps the facts of the hosts across the plays and the runs.
+// The facts are the variables like ansible_distribution and the cacheable facts set by set_fact.
+// It must be safe for concurrent use.
+type FactCache interface {
+	// Get returns the facts of the host. It returns false if they are not cached or expired.
+	Get(host string) (Config, bool, error)
+	// Set replaces the facts of the host.
+	Set(host string, facts Config) error
+}
+
+// NewFactCache returns the fact cache of the backend which is memory or jsonfile.
+// The connection is the directory of the jsonfile backend. The facts never expire if the timeout is zero.
+func NewFactCache(backend string, connection string, timeout time.Duration) (FactCache, error) {
+	newCache, ok := factCacheBackends[backend]
+	if !ok {
+		return nil, fmt.Errorf("Fact cache %s is not supported", backend)
+	}
+	return newCache(connection, timeout)
+}
+
+// expired returns true if the facts cached at the time are expired.
+func expired(cachedAt time.Time, timeout time.Duration) bool {
+	return timeout > 0 && time.Since(cachedAt) > timeout
+}
+
+type memoryFactStore struct {
+	mutex   sync.Mutex
+	entries map[string]memoryFactEntry
+}
+
+type memoryFactEntry struct {
+	facts    Config
+	cachedAt time.Time
+}
+
+// memoryFactCache keeps the facts in the memory of the process.
+type memoryFactCache struct {
+	store   *memoryFactStore
+	timeout time.Duration
+}
+
+func newMemoryFactCache(connection string, timeout time.Duration) (FactCache, error) {
+	return &memoryFactCache{store: memoryFacts, timeout: timeout}, nil
+}
+
+func (cache *memoryFactCache) Get(host string) (Config, bool, error) {
+	cache.store.mutex.Lock()
+	defer cache.store.mutex.Unlock()
+	entry, ok := cache.store.entries[host]
+	if !ok || expired(entry.cachedAt, cache.timeout) {
+		return nil, false, nil
+	}
+	facts := make(Config, len(entry.facts))
+	for key, value := range entry.facts {
+		facts[key] = value
+	}
+	return facts, true, nil
+}
+
+func (cache *memoryFactCache) Set(host string, facts Config) error {
+	cache.store.mutex.Lock()
+	defer cache.store.mutex.Unlock()
+	entry := memoryFactEntry{facts: make(Config, len(facts)), cachedAt: time.Now()}
+	for key, value := range facts {
+		entry.facts[key] = value
+	}
+	cache.store.entries[host] = entry
+	return nil
+}
+
+// jsonFileFactCache keeps the facts of each host in a JSON file named by the host in the directory.
+// The modification time of the file is the time when the facts are cached.
+type jsonFileFactCache struct {
+	dir     string
+	timeout time.Duration
+}
+
+func newJSONFileFactCache(connection string, timeout time.Duration) (FactCache, error) {
+	if connection == "" {
+		return nil, errors.New("Directory of the jsonfile fact cache is not set")
+	}
+	return &jsonFileFactCache{dir: connection, timeout: timeout}, nil
+}
+
+func (cache *jsonFileFactCache) path(host string) (string, error) {
+	if host == "" || host == "." || host == ".." || strings.ContainsAny(host, `/\`) {
+		return "", fmt.Errorf("Invalid host name %s for the fact cache", host)
+	}
+	return fp.Join(cache.dir, host), nil
+}
+
+func (cache *jsonFileFactCache) Get(host string) (Config, bool, error) {
+	path, err := cache.path(host)
+	if err != nil {
+		return nil, false, err
+	}
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if expired(info.ModTime(), cache.timeout) {
+		return nil, false, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false, err
+	}
+	// The JSON is parsed as YAML to keep the integers.
+	facts := Config{}
+	err = yaml.Unmarshal(data, &facts)
+	if err != nil {
+		return nil, false, fmt.Errorf("Invalid fact cache file %s: %w", path, err)
+	}
+	return facts, true, nil
+}
+
+func (cache *jsonFileFactCache) Set(host string, facts Config) error {
+	path, err := cache.path(host)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(facts, "", "    ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(cache.dir, 0755)
+	if err != nil {
+		return err
+	}
+	// The file is replaced atomically so that a concurrent Get does not read a partial file.
+	tmp, err := os.CreateTemp(cache.dir, "."+host+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
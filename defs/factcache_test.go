@@ -0,0 +1,133 @@
+package defs
+
+import (
+	"os"
+	fp "path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// clearMemoryFacts removes the facts of the host from the memory backend shared by the tests.
+func clearMemoryFacts(host string) {
+	memoryFacts.mutex.Lock()
+	defer memoryFacts.mutex.Unlock()
+	delete(memoryFacts.entries, host)
+}
+
+func TestFactCacheBackends(t *testing.T) {
+	for _, backend := range []string{"memory", "jsonfile"} {
+		cache, err := NewFactCache(backend, t.TempDir(), time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		host := "cache-" + backend
+		clearMemoryFacts(host)
+		if _, ok, err := cache.Get(host); ok || err != nil {
+			t.Errorf("%s: Get before Set = %v, %v", backend, ok, err)
+		}
+		facts := Config{"ansible_processor_count": 4, "ansible_distribution": "Debian", "mounts": []any{"/"}}
+		err = cache.Set(host, facts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok, err := cache.Get(host)
+		if !ok || err != nil || !reflect.DeepEqual(got, facts) {
+			t.Errorf("%s: Get = %#v, %v, %v, want %#v", backend, got, ok, err, facts)
+		}
+		// The returned facts are a copy.
+		got["ansible_distribution"] = "changed"
+		again, _, _ := cache.Get(host)
+		if again["ansible_distribution"] != "Debian" {
+			t.Errorf("%s: cached facts are changed by the caller", backend)
+		}
+		// Set replaces the facts.
+		err = cache.Set(host, Config{"only": true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _, _ = cache.Get(host)
+		if !reflect.DeepEqual(got, Config{"only": true}) {
+			t.Errorf("%s: Get after replacing = %v", backend, got)
+		}
+	}
+}
+
+func TestMemoryFactCacheExpiry(t *testing.T) {
+	cache, err := NewFactCache("memory", "", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearMemoryFacts("expiring")
+	err = cache.Set("expiring", Config{"a": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	memoryFacts.mutex.Lock()
+	entry := memoryFacts.entries["expiring"]
+	entry.cachedAt = time.Now().Add(-2 * time.Minute)
+	memoryFacts.entries["expiring"] = entry
+	memoryFacts.mutex.Unlock()
+	if _, ok, _ := cache.Get("expiring"); ok {
+		t.Errorf("expired facts are returned")
+	}
+	// The facts never expire without the timeout, and the store is shared.
+	forever, _ := NewFactCache("memory", "", 0)
+	if _, ok, _ := forever.Get("expiring"); !ok {
+		t.Errorf("facts expired without the timeout")
+	}
+}
+
+func TestJSONFileFactCacheExpiry(t *testing.T) {
+	dir := fp.Join(t.TempDir(), "facts")
+	cache, err := NewFactCache("jsonfile", dir, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cache.Set("node01", Config{"a": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-2 * time.Minute)
+	err = os.Chtimes(fp.Join(dir, "node01"), past, past)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := cache.Get("node01"); ok {
+		t.Errorf("expired facts are returned")
+	}
+	forever, _ := NewFactCache("jsonfile", dir, 0)
+	if facts, ok, _ := forever.Get("node01"); !ok || facts["a"] != 1 {
+		t.Errorf("facts = %v, %v without the timeout, want the integer 1", facts, ok)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Errorf("cache directory has %v, %v, want only the facts file", entries, err)
+	}
+}
+
+func TestFactCacheErrors(t *testing.T) {
+	if _, err := NewFactCache("redis", "", 0); err == nil {
+		t.Errorf("unsupported backend succeeded")
+	}
+	if _, err := NewFactCache("jsonfile", "", 0); err == nil {
+		t.Errorf("jsonfile without the directory succeeded")
+	}
+	dir := t.TempDir()
+	cache, _ := NewFactCache("jsonfile", dir, 0)
+	for _, host := range []string{"", ".", "..", "../escape", `a\b`} {
+		if err := cache.Set(host, Config{}); err == nil {
+			t.Errorf("Set(%q) succeeded", host)
+		}
+		if _, _, err := cache.Get(host); err == nil {
+			t.Errorf("Get(%q) succeeded", host)
+		}
+	}
+	err := os.WriteFile(fp.Join(dir, "broken"), []byte("{"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := cache.Get("broken"); err == nil {
+		t.Errorf("Get of an invalid file succeeded")
+	}
+}
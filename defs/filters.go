@@ -0,0 +1,985 @@
+package defs
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"net"
+	"os"
+	fp "path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/noirbizarre/gonja/exec"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// Namespace used by Ansible for to_uuid.
+	ansibleUUIDNamespace = "361E6D51-FAEC-444A-9079-341386DA8E2E"
+)
+
+var (
+	ansibleFilters = exec.FilterSet{
+		"b64decode":            filterB64Decode,
+		"b64encode":            filterB64Encode,
+		"basename":             filterBasename,
+		"bool":                 filterBool,
+		"checksum":             filterChecksum,
+		"combine":              filterCombine,
+		"dict2items":           filterDict2Items,
+		"difference":           filterDifference,
+		"dirname":              filterDirname,
+		"expanduser":           filterExpandUser,
+		"flatten":              filterFlatten,
+		"from_json":            filterFromJSON,
+		"from_yaml":            filterFromYAML,
+		"hash":                 filterHash,
+		"intersect":            filterIntersect,
+		"ipaddr":               filterIPAddr,
+		"ipv4":                 filterIPv4,
+		"ipv6":                 filterIPv6,
+		"items2dict":           filterItems2Dict,
+		"map":                  filterMap,
+		"mandatory":            filterMandatory,
+		"password_hash":        filterPasswordHash,
+		"quote":                filterQuote,
+		"regex_findall":        filterRegexFindAll,
+		"regex_replace":        filterRegexReplace,
+		"regex_search":         filterRegexSearch,
+		"rejectattr":           filterRejectAttr,
+		"selectattr":           filterSelectAttr,
+		"symmetric_difference": filterSymmetricDifference,
+		"ternary":              filterTernary,
+		"to_json":              filterToJSON,
+		"to_nice_json":         filterToNiceJSON,
+		"to_nice_yaml":         filterToNiceYAML,
+		"to_uuid":              filterToUUID,
+		"to_yaml":              filterToYAML,
+		"union":                filterUnion,
+		"unique":               filterUnique,
+	}
+
+	// Python style group references in the replacement of regex_replace.
+	regexGroupRef      = regexp.MustCompile(`\\(\d+)`)
+	regexNamedGroupRef = regexp.MustCompile(`\\g<(\w+)>`)
+	shellSafe          = regexp.MustCompile(`^[\w@%+=:,./-]+$`)
+)
+
+// toNative converts the gonja values in the input to the plain Go values.
+func toNative(input any) any {
+	switch v := input.(type) {
+	case *exec.Value:
+		if v.IsNil() {
+			return nil
+		}
+		return toNative(v.Interface())
+	case exec.ValuesList:
+		return toNative([]*exec.Value(v))
+	case []*exec.Value:
+		list := make([]any, len(v))
+		for i, item := range v {
+			list[i] = toNative(item)
+		}
+		return list
+	case *exec.Dict:
+		dict := make(map[string]any, len(v.Pairs))
+		for _, pair := range v.Pairs {
+			dict[pair.Key.String()] = toNative(pair.Value)
+		}
+		return dict
+	case exec.Dict:
+		return toNative(&v)
+	case []any:
+		list := make([]any, len(v))
+		for i, item := range v {
+			list[i] = toNative(item)
+		}
+		return list
+	case map[string]any:
+		dict := make(map[string]any, len(v))
+		for key, item := range v {
+			dict[key] = toNative(item)
+		}
+		return dict
+	case Config:
+		return toNative(map[string]any(v))
+	}
+	return input
+}
+
+// toList converts the input to a list if it is a slice or an array.
+func toList(input any) ([]any, bool) {
+	input = toNative(input)
+	if list, ok := input.([]any); ok {
+		return list, true
+	}
+	value := reflect.ValueOf(input)
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		return nil, false
+	}
+	list := make([]any, value.Len())
+	for i := range list {
+		list[i] = value.Index(i).Interface()
+	}
+	return list, true
+}
+
+// toDict converts the input to a map if it is a map with string keys.
+func toDict(input any) (map[string]any, bool) {
+	input = toNative(input)
+	if dict, ok := input.(map[string]any); ok {
+		return dict, true
+	}
+	value := reflect.ValueOf(input)
+	if value.Kind() != reflect.Map {
+		return nil, false
+	}
+	dict := make(map[string]any, value.Len())
+	iter := value.MapRange()
+	for iter.Next() {
+		dict[fmt.Sprint(iter.Key().Interface())] = iter.Value().Interface()
+	}
+	return dict, true
+}
+
+// toBool converts the input to a boolean in the same way as the bool filter of Ansible.
+func toBool(input any) bool {
+	switch v := toNative(input).(type) {
+	case bool:
+		return v
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "yes", "y", "on", "true", "1":
+			return true
+		}
+		return false
+	case nil:
+		return false
+	default:
+		value := reflect.ValueOf(v)
+		switch value.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return value.Int() == 1
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return value.Uint() == 1
+		case reflect.Float32, reflect.Float64:
+			return value.Float() == 1
+		}
+	}
+	return false
+}
+
+func filterError(name string, err error) *exec.Value {
+	return exec.AsValue(fmt.Errorf("Filter %s failed: %w", name, err))
+}
+
+func filterMandatory(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	if in.IsNil() {
+		msg := "Mandatory variable is not defined"
+		if len(params.Args) > 0 {
+			msg = params.First().String()
+		}
+		return exec.AsValue(errors.New(msg))
+	}
+	return in
+}
+
+func filterBool(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	return exec.AsValue(toBool(in))
+}
+
+func filterToJSON(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	data, err := json.Marshal(toNative(in))
+	if err != nil {
+		return filterError("to_json", err)
+	}
+	return exec.AsValue(string(data))
+}
+
+func filterToNiceJSON(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	p := params.Expect(0, []*exec.KwArg{{Name: "indent", Default: 4}})
+	if p.IsError() {
+		return filterError("to_nice_json", p)
+	}
+	data, err := json.MarshalIndent(toNative(in), "", strings.Repeat(" ", p.KwArgs["indent"].Integer()))
+	if err != nil {
+		return filterError("to_nice_json", err)
+	}
+	return exec.AsValue(string(data))
+}
+
+func filterFromJSON(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	var out any
+	decoder := json.NewDecoder(strings.NewReader(in.String()))
+	decoder.UseNumber()
+	err := decoder.Decode(&out)
+	if err != nil {
+		return filterError("from_json", err)
+	}
+	return exec.AsValue(jsonNumbers(out))
+}
+
+// jsonNumbers replaces the decoded numbers with integers if they are integral and floats otherwise,
+// so that the integers are not rendered as floats.
+func jsonNumbers(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return int(i)
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		for key, item := range v {
+			v[key] = jsonNumbers(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = jsonNumbers(item)
+		}
+	}
+	return value
+}
+
+func filterToYAML(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	data, err := yaml.Marshal(toNative(in))
+	if err != nil {
+		return filterError("to_yaml", err)
+	}
+	return exec.AsValue(string(data))
+}
+
+func filterToNiceYAML(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	p := params.Expect(0, []*exec.KwArg{{Name: "indent", Default: 4}})
+	if p.IsError() {
+		return filterError("to_nice_yaml", p)
+	}
+	var sb strings.Builder
+	encoder := yaml.NewEncoder(&sb)
+	encoder.SetIndent(p.KwArgs["indent"].Integer())
+	err := encoder.Encode(toNative(in))
+	if err != nil {
+		return filterError("to_nice_yaml", err)
+	}
+	err = encoder.Close()
+	if err != nil {
+		return filterError("to_nice_yaml", err)
+	}
+	return exec.AsValue(sb.String())
+}
+
+func filterFromYAML(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	var out any
+	err := yaml.Unmarshal([]byte(in.String()), &out)
+	if err != nil {
+		return filterError("from_yaml", err)
+	}
+	return exec.AsValue(out)
+}
+
+// compileRegex compiles the pattern with the Python style flags.
+func compileRegex(pattern string, ignoreCase, multiline bool) (*regexp.Regexp, error) {
+	flags := ""
+	if ignoreCase {
+		flags += "i"
+	}
+	if multiline {
+		flags += "m"
+	}
+	if flags != "" {
+		pattern = fmt.Sprintf("(?%s)%s", flags, pattern)
+	}
+	return regexp.Compile(pattern)
+}
+
+func filterRegexReplace(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	p := params.Expect(1, []*exec.KwArg{
+		{Name: "replacement", Default: ""},
+		{Name: "ignorecase", Default: false},
+		{Name: "multiline", Default: false},
+	})
+	if p.IsError() {
+		return filterError("regex_replace", p)
+	}
+	re, err := compileRegex(p.First().String(), p.KwArgs["ignorecase"].Bool(), p.KwArgs["multiline"].Bool())
+	if err != nil {
+		return filterError("regex_replace", err)
+	}
+	replacement := p.KwArgs["replacement"].String()
+	replacement = regexGroupRef.ReplaceAllString(replacement, "$${$1}")
+	replacement = regexNamedGroupRef.ReplaceAllString(replacement, "$${$1}")
+	return exec.AsValue(re.ReplaceAllString(in.String(), replacement))
+}
+
+func filterRegexSearch(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	if len(params.Args) < 1 {
+		return filterError("regex_search", errors.New("Pattern is required"))
+	}
+	re, err := compileRegex(params.First().String(),
+		params.GetKwarg("ignorecase", false).Bool(), params.GetKwarg("multiline", false).Bool())
+	if err != nil {
+		return filterError("regex_search", err)
+	}
+	match := re.FindStringSubmatch(in.String())
+	if match == nil {
+		return exec.AsValue(nil)
+	}
+	if len(params.Args) == 1 {
+		return exec.AsValue(match[0])
+	}
+	// The other arguments are the references to the groups to be returned.
+	groups := []any{}
+	for _, arg := range params.Args[1:] {
+		ref := arg.String()
+		if m := regexGroupRef.FindStringSubmatch(ref); m != nil {
+			var idx int
+			fmt.Sscanf(m[1], "%d", &idx)
+			if idx < len(match) {
+				groups = append(groups, match[idx])
+			}
+		} else if m := regexNamedGroupRef.FindStringSubmatch(ref); m != nil {
+			if idx := re.SubexpIndex(m[1]); idx >= 0 {
+				groups = append(groups, match[idx])
+			}
+		}
+	}
+	return exec.AsValue(groups)
+}
+
+func filterRegexFindAll(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	p := params.Expect(1, []*exec.KwArg{
+		{Name: "ignorecase", Default: false},
+		{Name: "multiline", Default: false},
+	})
+	if p.IsError() {
+		return filterError("regex_findall", p)
+	}
+	re, err := compileRegex(p.First().String(), p.KwArgs["ignorecase"].Bool(), p.KwArgs["multiline"].Bool())
+	if err != nil {
+		return filterError("regex_findall", err)
+	}
+	out := []any{}
+	for _, match := range re.FindAllStringSubmatch(in.String(), -1) {
+		// Same as re.findall of Python.
+		switch len(match) {
+		case 1:
+			out = append(out, match[0])
+		case 2:
+			out = append(out, match[1])
+		default:
+			groups := make([]any, len(match)-1)
+			for i, group := range match[1:] {
+				groups[i] = group
+			}
+			out = append(out, groups)
+		}
+	}
+	return exec.AsValue(out)
+}
+
+func filterB64Encode(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	return exec.AsValue(base64.StdEncoding.EncodeToString([]byte(in.String())))
+}
+
+func filterB64Decode(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(in.String()))
+	if err != nil {
+		return filterError("b64decode", err)
+	}
+	return exec.AsValue(string(data))
+}
+
+func newHash(name string) (hash.Hash, error) {
+	switch strings.ToLower(name) {
+	case "md5":
+		return md5.New(), nil
+	case "sha1":
+		return sha1.New(), nil
+	case "sha224":
+		return sha256.New224(), nil
+	case "sha256":
+		return sha256.New(), nil
+	case "sha384":
+		return sha512.New384(), nil
+	case "sha512":
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("Unsupported hash type %s", name)
+}
+
+func filterHash(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	p := params.Expect(0, []*exec.KwArg{{Name: "hashtype", Default: "sha1"}})
+	if p.IsError() {
+		return filterError("hash", p)
+	}
+	h, err := newHash(p.KwArgs["hashtype"].String())
+	if err != nil {
+		return filterError("hash", err)
+	}
+	h.Write([]byte(in.String()))
+	return exec.AsValue(hex.EncodeToString(h.Sum(nil)))
+}
+
+func filterChecksum(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	sum := sha1.Sum([]byte(in.String()))
+	return exec.AsValue(hex.EncodeToString(sum[:]))
+}
+
+func filterPasswordHash(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	p := params.Expect(0, []*exec.KwArg{
+		{Name: "hashtype", Default: "sha512"},
+		{Name: "salt", Default: nil},
+		{Name: "rounds", Default: nil},
+	})
+	if p.IsError() {
+		return filterError("password_hash", p)
+	}
+	hashType := p.KwArgs["hashtype"].String()
+	rounds := 0
+	if !p.KwArgs["rounds"].IsNil() {
+		rounds = p.KwArgs["rounds"].Integer()
+	}
+	if hashType == "bcrypt" || hashType == "blowfish" {
+		cost := bcrypt.DefaultCost
+		if rounds > 0 {
+			cost = rounds
+		}
+		data, err := bcrypt.GenerateFromPassword([]byte(in.String()), cost)
+		if err != nil {
+			return filterError("password_hash", err)
+		}
+		return exec.AsValue(string(data))
+	}
+	salt := ""
+	if p.KwArgs["salt"].IsNil() {
+		var err error
+		salt, err = randomSalt(cryptMaxSaltLength)
+		if err != nil {
+			return filterError("password_hash", err)
+		}
+	} else {
+		salt = p.KwArgs["salt"].String()
+	}
+	out, err := shaCrypt(hashType, in.String(), salt, rounds)
+	if err != nil {
+		return filterError("password_hash", err)
+	}
+	return exec.AsValue(out)
+}
+
+// combineDicts merges the dicts, the latter ones taking precedence.
+func combineDicts(base, other map[string]any, recursive bool) map[string]any {
+	out := make(map[string]any, len(base)+len(other))
+	for key, value := range base {
+		out[key] = value
+	}
+	for key, value := range other {
+		if recursive {
+			baseDict, ok1 := toDict(out[key])
+			otherDict, ok2 := toDict(value)
+			if ok1 && ok2 {
+				out[key] = combineDicts(baseDict, otherDict, recursive)
+				continue
+			}
+		}
+		out[key] = value
+	}
+	return out
+}
+
+func filterCombine(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	recursive := params.GetKwarg("recursive", false).Bool()
+	dicts := []*exec.Value{in}
+	dicts = append(dicts, params.Args...)
+	out := map[string]any{}
+	for _, dict := range dicts {
+		// The dicts can also be passed as a list.
+		items := []any{dict}
+		if list, ok := toList(dict); ok {
+			items = list
+		}
+		for _, item := range items {
+			d, ok := toDict(item)
+			if !ok {
+				return filterError("combine", fmt.Errorf("Dict is expected, but found %T", toNative(item)))
+			}
+			out = combineDicts(out, d, recursive)
+		}
+	}
+	return exec.AsValue(out)
+}
+
+func filterDict2Items(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	p := params.Expect(0, []*exec.KwArg{{Name: "key_name", Default: "key"}, {Name: "value_name", Default: "value"}})
+	if p.IsError() {
+		return filterError("dict2items", p)
+	}
+	dict, ok := toDict(in)
+	if !ok {
+		return filterError("dict2items", fmt.Errorf("Dict is expected, but found %T", toNative(in)))
+	}
+	keyName, valueName := p.KwArgs["key_name"].String(), p.KwArgs["value_name"].String()
+	keys := make([]string, 0, len(dict))
+	for key := range dict {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	out := make([]any, 0, len(dict))
+	for _, key := range keys {
+		out = append(out, map[string]any{keyName: key, valueName: dict[key]})
+	}
+	return exec.AsValue(out)
+}
+
+func filterItems2Dict(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	p := params.Expect(0, []*exec.KwArg{{Name: "key_name", Default: "key"}, {Name: "value_name", Default: "value"}})
+	if p.IsError() {
+		return filterError("items2dict", p)
+	}
+	list, ok := toList(in)
+	if !ok {
+		return filterError("items2dict", fmt.Errorf("List is expected, but found %T", toNative(in)))
+	}
+	keyName, valueName := p.KwArgs["key_name"].String(), p.KwArgs["value_name"].String()
+	out := make(map[string]any, len(list))
+	for _, item := range list {
+		dict, ok := toDict(item)
+		if !ok {
+			return filterError("items2dict", fmt.Errorf("Dict is expected, but found %T", item))
+		}
+		key, ok := dict[keyName]
+		if !ok {
+			return filterError("items2dict", fmt.Errorf("Key %s is not found in %v", keyName, dict))
+		}
+		out[fmt.Sprint(key)] = dict[valueName]
+	}
+	return exec.AsValue(out)
+}
+
+// attribute returns the value of the dotted attribute of the item.
+func attribute(item *exec.Value, name string) (*exec.Value, bool) {
+	for _, part := range strings.Split(name, ".") {
+		value, found := item.Getitem(part)
+		if !found {
+			value, found = item.Getattr(part)
+		}
+		if !found {
+			return exec.AsValue(nil), false
+		}
+		item = value
+	}
+	return item, true
+}
+
+func filterMap(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	attr, hasAttr := params.KwArgs["attribute"]
+	defaultVal, hasDefault := params.KwArgs["default"]
+	var filter string
+	filterParams := exec.NewVarArgs()
+	if len(params.Args) > 0 {
+		// The rest of the arguments are passed to the filter.
+		filter = params.First().String()
+		filterParams.Args = params.Args[1:]
+		for key, value := range params.KwArgs {
+			if key != "attribute" && key != "default" {
+				filterParams.KwArgs[key] = value
+			}
+		}
+	}
+	out := []*exec.Value{}
+	in.Iterate(func(idx, count int, key, value *exec.Value) bool {
+		val := key
+		if hasAttr {
+			var found bool
+			val, found = attribute(key, attr.String())
+			if !found && hasDefault {
+				val = defaultVal
+			}
+		}
+		if filter != "" {
+			val = e.ExecuteFilterByName(filter, val, filterParams)
+		}
+		out = append(out, val)
+		return true
+	}, func() {})
+	for _, val := range out {
+		if val.IsError() {
+			return val
+		}
+	}
+	return exec.AsValue(out)
+}
+
+// selectAttr selects the items for which the test on the attribute returns the expected result.
+func selectAttr(name string, e *exec.Evaluator, in *exec.Value, params *exec.VarArgs, expected bool) *exec.Value {
+	if len(params.Args) < 1 {
+		return filterError(name, errors.New("Attribute name is required"))
+	}
+	attr := params.First().String()
+	out := []*exec.Value{}
+	var err *exec.Value
+	in.Iterate(func(idx, count int, key, value *exec.Value) bool {
+		val, _ := attribute(key, attr)
+		var result bool
+		if len(params.Args) == 1 {
+			result = val.IsTrue()
+		} else {
+			testParams := &exec.VarArgs{Args: params.Args[2:], KwArgs: params.KwArgs}
+			res := e.ExecuteTestByName(params.Args[1].String(), val, testParams)
+			if res.IsError() {
+				err = res
+				return false
+			}
+			result = res.IsTrue()
+		}
+		if result == expected {
+			out = append(out, key)
+		}
+		return true
+	}, func() {})
+	if err != nil {
+		return err
+	}
+	return exec.AsValue(out)
+}
+
+func filterSelectAttr(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	return selectAttr("selectattr", e, in, params, true)
+}
+
+func filterRejectAttr(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	return selectAttr("rejectattr", e, in, params, false)
+}
+
+func flatten(list []any, levels int) []any {
+	out := []any{}
+	for _, item := range list {
+		if inner, ok := toList(item); ok && levels != 0 {
+			out = append(out, flatten(inner, levels-1)...)
+		} else if item != nil {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func filterFlatten(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	p := params.Expect(0, []*exec.KwArg{{Name: "levels", Default: nil}})
+	if p.IsError() {
+		return filterError("flatten", p)
+	}
+	list, ok := toList(in)
+	if !ok {
+		return filterError("flatten", fmt.Errorf("List is expected, but found %T", toNative(in)))
+	}
+	levels := -1
+	if !p.KwArgs["levels"].IsNil() {
+		levels = p.KwArgs["levels"].Integer()
+	}
+	return exec.AsValue(flatten(list, levels))
+}
+
+// uniqueItems returns the items without the duplicates keeping the order.
+func uniqueItems(lists ...[]any) []any {
+	out := []any{}
+	for _, list := range lists {
+		for _, item := range list {
+			if !containsItem(out, item) {
+				out = append(out, item)
+			}
+		}
+	}
+	return out
+}
+
+func containsItem(list []any, item any) bool {
+	for _, other := range list {
+		if reflect.DeepEqual(other, item) {
+			return true
+		}
+	}
+	return false
+}
+
+func filterUnique(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	list, ok := toList(in)
+	if !ok {
+		return filterError("unique", fmt.Errorf("List is expected, but found %T", toNative(in)))
+	}
+	return exec.AsValue(uniqueItems(list))
+}
+
+// setFilter applies the set operation on the input list and the list argument.
+func setFilter(name string, in *exec.Value, params *exec.VarArgs, op func(a, b []any) []any) *exec.Value {
+	p := params.ExpectArgs(1)
+	if p.IsError() {
+		return filterError(name, p)
+	}
+	a, ok1 := toList(in)
+	b, ok2 := toList(p.First())
+	if !ok1 || !ok2 {
+		return filterError(name, errors.New("Lists are expected"))
+	}
+	return exec.AsValue(op(a, b))
+}
+
+func filterUnion(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	return setFilter("union", in, params, func(a, b []any) []any {
+		return uniqueItems(a, b)
+	})
+}
+
+func filterDifference(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	return setFilter("difference", in, params, func(a, b []any) []any {
+		out := []any{}
+		for _, item := range uniqueItems(a) {
+			if !containsItem(b, item) {
+				out = append(out, item)
+			}
+		}
+		return out
+	})
+}
+
+func filterIntersect(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	return setFilter("intersect", in, params, func(a, b []any) []any {
+		out := []any{}
+		for _, item := range uniqueItems(a) {
+			if containsItem(b, item) {
+				out = append(out, item)
+			}
+		}
+		return out
+	})
+}
+
+func filterSymmetricDifference(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	return setFilter("symmetric_difference", in, params, func(a, b []any) []any {
+		out := []any{}
+		for _, item := range uniqueItems(a, b) {
+			if containsItem(a, item) != containsItem(b, item) {
+				out = append(out, item)
+			}
+		}
+		return out
+	})
+}
+
+func filterBasename(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	path := in.String()
+	if strings.HasSuffix(path, "/") {
+		// Same as os.path.basename of Python.
+		return exec.AsValue("")
+	}
+	return exec.AsValue(fp.Base(path))
+}
+
+func filterDirname(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	path := in.String()
+	idx := strings.LastIndex(path, "/")
+	if idx < 0 {
+		return exec.AsValue("")
+	}
+	dir := path[:idx]
+	if strings.Trim(dir, "/") != "" {
+		dir = strings.TrimRight(dir, "/")
+	} else {
+		dir = path[:idx+1]
+	}
+	return exec.AsValue(dir)
+}
+
+func filterExpandUser(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	path := in.String()
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return exec.AsValue(path)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filterError("expanduser", err)
+	}
+	return exec.AsValue(home + path[1:])
+}
+
+func filterQuote(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	str := in.String()
+	if str == "" {
+		return exec.AsValue("''")
+	}
+	if shellSafe.MatchString(str) {
+		return exec.AsValue(str)
+	}
+	return exec.AsValue("'" + strings.ReplaceAll(str, "'", `'"'"'`) + "'")
+}
+
+func filterTernary(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	p := params.Expect(2, []*exec.KwArg{{Name: "none_val", Default: nil}})
+	if p.IsError() {
+		return filterError("ternary", p)
+	}
+	if in.IsNil() && !p.KwArgs["none_val"].IsNil() {
+		return p.KwArgs["none_val"]
+	}
+	if in.IsTrue() {
+		return p.Args[0]
+	}
+	return p.Args[1]
+}
+
+func filterToUUID(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	p := params.Expect(0, []*exec.KwArg{{Name: "namespace", Default: ansibleUUIDNamespace}})
+	if p.IsError() {
+		return filterError("to_uuid", p)
+	}
+	namespace, err := hex.DecodeString(strings.ReplaceAll(p.KwArgs["namespace"].String(), "-", ""))
+	if err != nil || len(namespace) != 16 {
+		return filterError("to_uuid", fmt.Errorf("Invalid namespace %s", p.KwArgs["namespace"].String()))
+	}
+	// Version 5 UUID as defined in RFC 4122.
+	h := sha1.New()
+	h.Write(namespace)
+	h.Write([]byte(in.String()))
+	sum := h.Sum(nil)[:16]
+	sum[6] = (sum[6] & 0x0f) | 0x50
+	sum[8] = (sum[8] & 0x3f) | 0x80
+	str := hex.EncodeToString(sum)
+	return exec.AsValue(fmt.Sprintf("%s-%s-%s-%s-%s", str[0:8], str[8:12], str[12:16], str[16:20], str[20:32]))
+}
+
+// parseIPAddr parses an address with an optional prefix length.
+func parseIPAddr(str string) (net.IP, *net.IPNet, bool) {
+	if strings.Contains(str, "/") {
+		ip, ipNet, err := net.ParseCIDR(str)
+		if err != nil {
+			return nil, nil, false
+		}
+		return ip, ipNet, true
+	}
+	ip := net.ParseIP(str)
+	if ip == nil {
+		return nil, nil, false
+	}
+	bits := 8 * net.IPv6len
+	if ip.To4() != nil {
+		ip = ip.To4()
+		bits = 8 * net.IPv4len
+	}
+	return ip, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, true
+}
+
+// ipAddrQuery implements a subset of the queries of the ipaddr filter.
+// It returns false if the value does not match.
+func ipAddrQuery(str, query string) any {
+	ip, ipNet, ok := parseIPAddr(strings.TrimSpace(str))
+	if !ok {
+		return false
+	}
+	ones, bits := ipNet.Mask.Size()
+	switch query {
+	case "":
+		return str
+	case "address":
+		return ip.String()
+	case "ipv4":
+		if ip.To4() == nil {
+			return false
+		}
+		return str
+	case "ipv6":
+		if ip.To4() != nil {
+			return false
+		}
+		return str
+	case "network":
+		return ipNet.IP.String()
+	case "netmask":
+		return net.IP(ipNet.Mask).String()
+	case "prefix":
+		return ones
+	case "size":
+		return new(big.Int).Lsh(big.NewInt(1), uint(bits-ones)).String()
+	case "broadcast":
+		broadcast := make(net.IP, len(ipNet.IP))
+		for i := range ipNet.IP {
+			broadcast[i] = ipNet.IP[i] | ^ipNet.Mask[i]
+		}
+		return broadcast.String()
+	case "net", "subnet", "cidr":
+		return ipNet.String()
+	case "host":
+		if !strings.Contains(str, "/") {
+			return fmt.Sprintf("%s/%d", ip, bits)
+		}
+		if !ip.Equal(ipNet.IP) || ones == bits {
+			return fmt.Sprintf("%s/%d", ip, ones)
+		}
+		return false
+	case "private":
+		if ip.IsPrivate() {
+			return str
+		}
+		return false
+	case "public":
+		if ip.IsGlobalUnicast() && !ip.IsPrivate() {
+			return str
+		}
+		return false
+	case "loopback":
+		if ip.IsLoopback() {
+			return str
+		}
+		return false
+	}
+	return false
+}
+
+// ipAddrFilter applies the query to the value or to each item of the list.
+// The items which do not match are dropped from the list.
+func ipAddrFilter(in *exec.Value, query string) *exec.Value {
+	if list, ok := toList(in); ok {
+		out := []any{}
+		for _, item := range list {
+			if result := ipAddrQuery(fmt.Sprint(item), query); result != false {
+				out = append(out, result)
+			}
+		}
+		return exec.AsValue(out)
+	}
+	return exec.AsValue(ipAddrQuery(in.String(), query))
+}
+
+func filterIPAddr(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	query := ""
+	if len(params.Args) > 0 {
+		query = params.First().String()
+	}
+	return ipAddrFilter(in, query)
+}
+
+func filterIPv4(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	value := ipAddrFilter(in, "ipv4")
+	if len(params.Args) == 0 || value.Interface() == false {
+		return value
+	}
+	return ipAddrFilter(value, params.First().String())
+}
+
+func filterIPv6(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+	value := ipAddrFilter(in, "ipv6")
+	if len(params.Args) == 0 || value.Interface() == false {
+		return value
+	}
+	return ipAddrFilter(value, params.First().String())
+}
@@ -0,0 +1,89 @@
+package defs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAnsibleFilters(t *testing.T) {
+	values := Config{
+		"users": []any{
+			map[string]any{"name": "alice", "admin": true, "shell": "/bin/zsh"},
+			map[string]any{"name": "bob", "admin": false},
+		},
+		"base":  map[string]any{"a": 1, "nested": map[string]any{"x": 1, "y": 2}},
+		"other": map[string]any{"b": 2, "nested": map[string]any{"y": 3}},
+	}
+	tests := map[string]any{
+		"{{ 'aGVsbG8=' | b64decode }}":                                                      "hello",
+		"{{ 'hello' | b64encode }}":                                                         "aGVsbG8=",
+		"{{ '/etc/hosts' | basename }}":                                                     "hosts",
+		"{{ '/etc/hosts' | dirname }}":                                                      "/etc",
+		"{{ 'yes' | bool }}":                                                                true,
+		"{{ 'off' | bool }}":                                                                false,
+		"{{ 'abc' | checksum }}":                                                            "a9993e364706816aba3e25717850c26c9cd0d89d",
+		"{{ 'abc' | hash('md5') }}":                                                         "900150983cd24fb0d6963f7d28e17f72",
+		"{{ base | combine(other) }}":                                                       map[string]any{"a": 1, "b": 2, "nested": map[string]any{"y": 3}},
+		"{{ base | combine(other, recursive=true) }}":                                       map[string]any{"a": 1, "b": 2, "nested": map[string]any{"x": 1, "y": 3}},
+		"{{ {'a': 1} | dict2items }}":                                                       []any{map[string]any{"key": "a", "value": 1}},
+		"{{ [{'key': 'a', 'value': 1}] | items2dict }}":                                     map[string]any{"a": 1},
+		"{{ [1, 2, 3] | difference([2]) }}":                                                 []any{1, 3},
+		"{{ [1, 2, 3] | intersect([3, 2, 5]) }}":                                            []any{2, 3},
+		"{{ [1, 2] | union([2, 3]) }}":                                                      []any{1, 2, 3},
+		"{{ [1, 2] | symmetric_difference([2, 3]) }}":                                       []any{1, 3},
+		"{{ [1, 2, 1, 3] | unique }}":                                                       []any{1, 2, 3},
+		"{{ [1, [2, [3]]] | flatten }}":                                                     []any{1, 2, 3},
+		"{{ [1, [2, [3]]] | flatten(levels=1) }}":                                           []any{1, 2, []any{3}},
+		"{{ '{\"a\": [1, 1.5]}' | from_json }}":                                             map[string]any{"a": []any{1, 1.5}},
+		"{{ 'a: [1]' | from_yaml }}":                                                        map[string]any{"a": []any{1}},
+		"{{ {'a': [1]} | to_json }}":                                                        `{"a":[1]}`,
+		"{{ {'a': 1} | to_nice_json(indent=2) }}":                                           "{\n  \"a\": 1\n}",
+		"{{ {'a': [1]} | to_yaml | from_yaml }}":                                            map[string]any{"a": []any{1}},
+		"{{ users | map(attribute='name') | list }}":                                        []any{"alice", "bob"},
+		"{{ users | map(attribute='shell', default='sh') | list }}":                         []any{"/bin/zsh", "sh"},
+		"{{ ['a', 'b'] | map('upper') | list }}":                                            []any{"A", "B"},
+		"{{ users | selectattr('admin') | map(attribute='name') | list }}":                  []any{"alice"},
+		"{{ users | rejectattr('admin') | map(attribute='name') | list }}":                  []any{"bob"},
+		"{{ users | selectattr('name', 'equalto', 'bob') | map(attribute='name') | list }}": []any{"bob"},
+		"{{ \"it's\" | quote }}":                                                            `'it'"'"'s'`,
+		"{{ 'plain' | quote }}":                                                             "plain",
+		"{{ '' | quote }}":                                                                  "''",
+		"{{ true | ternary('yes', 'no') }}":                                                 "yes",
+		"{{ none | ternary('yes', 'no', 'null') }}":                                         "null",
+		"{{ 'example.com' | to_uuid }}":                                                     "ae780c3a-a3ab-53c2-bfb4-098da300b3fe",
+		"{{ 'abc123' | regex_replace('\\\\d+', 'X') }}":                                     "abcX",
+		"{{ 'a1b22' | regex_findall('\\\\d+') }}":                                           []any{"1", "22"},
+		"{{ 'ver 1.2' | regex_search('\\\\d+\\\\.\\\\d+') }}":                               "1.2",
+		"{{ '192.168.1.10/24' | ipaddr('network') }}":                                       "192.168.1.0",
+		"{{ ['10.0.0.1', 'x', '::1'] | ipv4 }}":                                             []any{"10.0.0.1"},
+		"{{ ['10.0.0.1', '::1'] | ipv6 }}":                                                  []any{"::1"},
+		"{{ 'secret' | password_hash('sha512', 'saltsalt') }}":                              "$6$saltsalt$TVLlQcbpFVof5W3Yz4DTP6gRstiNuHwwTt6GLc1E5n0U0aDehy0S5knV8wiOQSpT0Y77vwPZN.Pq.H91p5hVO1",
+	}
+	for source, want := range tests {
+		got, err := evaluateTemplate(source, values, TemplateOptions{})
+		if err != nil {
+			t.Errorf("evaluateTemplate(%q) failed: %v", source, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("evaluateTemplate(%q) = %#v, want %#v", source, got, want)
+		}
+	}
+}
+
+func TestAnsibleFilterErrors(t *testing.T) {
+	tests := map[string]string{
+		"{{ missing | mandatory }}":            "Mandatory variable is not defined",
+		"{{ missing | mandatory('Set it') }}":  "Set it",
+		"{{ 'x' | hash('nope') }}":             "nope",
+		"{{ 'x' | to_uuid(namespace='bad') }}": "Invalid namespace bad",
+		"{{ '{' | from_json }}":                "from_json",
+	}
+	for source, want := range tests {
+		_, err := evaluateTemplate(source, Config{}, TemplateOptions{})
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("evaluateTemplate(%q) = %v, want an error containing %q", source, err, want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package defs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	fp "path/filepath"
+	"strings"
+
+	"github.com/noirbizarre/gonja/exec"
+)
+
+var (
+	registeredLookups = map[string]Lookup{}
+)
+
+// Lookup is a plugin called by lookup and query in the templates.
+type Lookup interface {
+	Name() string
+	// Run returns the values for the terms.
+	// Options are the keyword arguments of the call.
+	Run(lookupContext *LookupContext, terms []any, options Config) ([]any, error)
+}
+
+// LookupContext is the environment in which a lookup plugin runs.
+type LookupContext struct {
+	// Variables are the variables of the template calling the lookup.
+	Variables Config
+	Options   TemplateOptions
+}
+
+// MustRegisterLookup registers the lookup plugin.
+func MustRegisterLookup(lookup Lookup) {
+	if _, ok := registeredLookups[lookup.Name()]; ok {
+		panic(fmt.Sprintf("Lookup %s is already registered", lookup.Name()))
+	}
+	registeredLookups[lookup.Name()] = lookup
+}
+
+// Path returns the path relative to the first search path if it is not absolute.
+func (lookupContext *LookupContext) Path(path string) string {
+	if fp.IsAbs(path) || len(lookupContext.Options.SearchPaths) == 0 {
+		return path
+	}
+	return fp.Join(lookupContext.Options.SearchPaths[0], path)
+}
+
+// FindFile returns the path of an existing file.
+// A relative path is searched in the subdir of each search path and then in the search path itself.
+func (lookupContext *LookupContext) FindFile(subdir, path string) (string, error) {
+	if fp.IsAbs(path) || len(lookupContext.Options.SearchPaths) == 0 {
+		if _, err := os.Stat(path); err != nil {
+			return "", err
+		}
+		return path, nil
+	}
+	for _, searchPath := range lookupContext.Options.SearchPaths {
+		for _, candidate := range []string{fp.Join(searchPath, subdir, path), fp.Join(searchPath, path)} {
+			if _, err := os.Stat(candidate); err == nil {
+				return candidate, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("Could not locate file %s in search paths %v", path, lookupContext.Options.SearchPaths)
+}
+
+// RenderTemplateFile renders the template file with the variables.
+func (lookupContext *LookupContext) RenderTemplateFile(path string, values Config) (string, error) {
+	return RenderTemplateFile(path, values, lookupContext.Options)
+}
+
+// Run runs the lookup plugin.
+func (lookupContext *LookupContext) Run(name string, terms []any, options Config) ([]any, error) {
+	lookup, ok := registeredLookups[name]
+	if !ok {
+		return nil, fmt.Errorf("Lookup plugin %s is not found", name)
+	}
+	return lookup.Run(lookupContext, terms, options)
+}
+
+// lookupFunction returns the lookup or the query function for the templates.
+// The results of lookup are joined with commas unless wantlist is set.
+func (lookupContext *LookupContext) lookupFunction(query bool) func(*exec.VarArgs) (any, error) {
+	return func(params *exec.VarArgs) (any, error) {
+		wantList := query
+		if len(params.Args) == 0 {
+			return nil, errors.New("Lookup plugin name is missing")
+		}
+		for _, arg := range params.Args {
+			if arg.IsError() {
+				return nil, templateErrorCause(arg)
+			}
+		}
+		name := params.Args[0].String()
+		terms := []any{}
+		for _, arg := range params.Args[1:] {
+			terms = append(terms, toNative(arg))
+		}
+		if len(terms) == 1 {
+			// A single list is the list of the terms.
+			if list, ok := terms[0].([]any); ok {
+				terms = list
+			}
+		}
+		options := Config{}
+		errorsOption := "strict"
+		for key, value := range params.KwArgs {
+			switch key {
+			case "wantlist":
+				wantList = wantList || value.Bool()
+			case "errors":
+				errorsOption = value.String()
+			default:
+				options[key] = toNative(value)
+			}
+		}
+		results, err := lookupContext.Run(name, terms, options)
+		if err != nil {
+			switch errorsOption {
+			case "warn":
+				fmt.Printf("\nLookup %s failed: %s\n", name, err.Error())
+			case "ignore":
+			default:
+				return nil, fmt.Errorf("Lookup %s failed: %w", name, err)
+			}
+			if wantList {
+				return []any{}, nil
+			}
+			return nil, nil
+		}
+		if results == nil {
+			results = []any{}
+		}
+		if wantList {
+			return results, nil
+		}
+		strs := make([]string, 0, len(results))
+		for _, result := range results {
+			str, ok := result.(string)
+			if !ok {
+				if len(results) == 1 {
+					return results[0], nil
+				}
+				return results, nil
+			}
+			strs = append(strs, str)
+		}
+		return strings.Join(strs, ","), nil
+	}
+}
@@ -0,0 +1,96 @@
+package lookups
+
+import (
+	"fmt"
+	"goparse/defs"
+	"strings"
+)
+
+// parseTerm splits a term like "name key1=value1 key2='value 2'" into the name and the parameters.
+func parseTerm(term string) (string, map[string]string, error) {
+	words, err := splitWords(term)
+	if err != nil {
+		return "", nil, err
+	}
+	name := ""
+	params := map[string]string{}
+	for _, word := range words {
+		key, value, ok := strings.Cut(word, "=")
+		if !ok {
+			if name != "" {
+				name += " "
+			}
+			name += word
+			continue
+		}
+		params[key] = value
+	}
+	return name, params, nil
+}
+
+// splitWords splits the string by spaces except the ones in quotes.
+func splitWords(str string) ([]string, error) {
+	words := []string{}
+	var sb strings.Builder
+	var quote rune
+	inWord := false
+	for _, r := range str {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				sb.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, sb.String())
+				sb.Reset()
+				inWord = false
+			}
+		default:
+			sb.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("Unbalanced quote in %s", str)
+	}
+	if inWord {
+		words = append(words, sb.String())
+	}
+	return words, nil
+}
+
+// option returns the option from the keyword arguments or the term parameters.
+func option(options map[string]any, params map[string]string, name string, defaultValue string) string {
+	if value, ok := params[name]; ok {
+		return value
+	}
+	if value, ok := options[name]; ok && value != nil {
+		return fmt.Sprint(value)
+	}
+	return defaultValue
+}
+
+// toStrings converts the terms to strings.
+func toStrings(terms []any) []string {
+	strs := make([]string, 0, len(terms))
+	for _, term := range terms {
+		strs = append(strs, fmt.Sprint(term))
+	}
+	return strs
+}
+
+// toMap returns the dictionary in the term.
+func toMap(term any) (map[string]any, bool) {
+	switch v := term.(type) {
+	case map[string]any:
+		return v, true
+	case defs.Config:
+		return v, true
+	}
+	return nil, false
+}
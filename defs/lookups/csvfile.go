@@ -0,0 +1,80 @@
+package lookups
+
+import (
+	"encoding/csv"
+	"fmt"
+	"goparse/defs"
+	"os"
+	"strconv"
+)
+
+func init() {
+	defs.MustRegisterLookup(&CsvFile{})
+}
+
+// CsvFile returns the values in a column of the rows whose first column is the key.
+// The terms are in the form of "key file=ansible.csv col=1 delimiter=TAB default=".
+type CsvFile struct{}
+
+func (lookup *CsvFile) Name() string {
+	return "csvfile"
+}
+
+func (lookup *CsvFile) Run(lookupContext *defs.LookupContext, terms []any, options defs.Config) ([]any, error) {
+	results := []any{}
+	for _, term := range toStrings(terms) {
+		key, params, err := parseTerm(term)
+		if err != nil {
+			return nil, err
+		}
+		col, err := strconv.Atoi(option(options, params, "col", "1"))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid column: %w", err)
+		}
+		delimiter := option(options, params, "delimiter", "TAB")
+		if delimiter == "TAB" || delimiter == "\\t" {
+			delimiter = "\t"
+		}
+		if len([]rune(delimiter)) != 1 {
+			return nil, fmt.Errorf("Delimiter must be a single character, but found %s", delimiter)
+		}
+		path, err := lookupContext.FindFile("files", option(options, params, "file", "ansible.csv"))
+		if err != nil {
+			return nil, err
+		}
+		value, found, err := readCsvColumn(path, []rune(delimiter)[0], key, col)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			value = option(options, params, "default", "")
+		}
+		results = append(results, value)
+	}
+	return results, nil
+}
+
+func readCsvColumn(path string, delimiter rune, key string, col int) (string, bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", false, err
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return "", false, err
+	}
+	for _, record := range records {
+		if len(record) == 0 || record[0] != key {
+			continue
+		}
+		if col < 0 || col >= len(record) {
+			return "", false, fmt.Errorf("Column %d is out of range in %s", col, path)
+		}
+		return record[col], true, nil
+	}
+	return "", false, nil
+}
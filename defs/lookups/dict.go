@@ -0,0 +1,37 @@
+package lookups
+
+import (
+	"fmt"
+	"goparse/defs"
+	"sort"
+)
+
+func init() {
+	defs.MustRegisterLookup(&Dict{})
+}
+
+// Dict returns the key and value pairs of the dictionaries sorted by the keys.
+type Dict struct{}
+
+func (lookup *Dict) Name() string {
+	return "dict"
+}
+
+func (lookup *Dict) Run(lookupContext *defs.LookupContext, terms []any, options defs.Config) ([]any, error) {
+	results := []any{}
+	for _, term := range terms {
+		dict, ok := toMap(term)
+		if !ok {
+			return nil, fmt.Errorf("Dict lookup expects a dictionary, but found %T", term)
+		}
+		keys := make([]string, 0, len(dict))
+		for key := range dict {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			results = append(results, map[string]any{"key": key, "value": dict[key]})
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,29 @@
+package lookups
+
+import (
+	"goparse/defs"
+	"os"
+)
+
+func init() {
+	defs.MustRegisterLookup(&Env{})
+}
+
+// Env returns the values of the environment variables of the controller.
+type Env struct{}
+
+func (lookup *Env) Name() string {
+	return "env"
+}
+
+func (lookup *Env) Run(lookupContext *defs.LookupContext, terms []any, options defs.Config) ([]any, error) {
+	results := []any{}
+	for _, name := range toStrings(terms) {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			value = option(options, nil, "default", "")
+		}
+		results = append(results, value)
+	}
+	return results, nil
+}
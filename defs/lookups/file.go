@@ -0,0 +1,41 @@
+package lookups
+
+import (
+	"goparse/defs"
+	"os"
+	"strings"
+)
+
+func init() {
+	defs.MustRegisterLookup(&File{})
+}
+
+// File returns the contents of the files.
+type File struct{}
+
+func (lookup *File) Name() string {
+	return "file"
+}
+
+func (lookup *File) Run(lookupContext *defs.LookupContext, terms []any, options defs.Config) ([]any, error) {
+	results := []any{}
+	for _, term := range toStrings(terms) {
+		path, err := lookupContext.FindFile("files", term)
+		if err != nil {
+			return nil, err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		value := string(content)
+		if option(options, nil, "lstrip", "false") == "true" {
+			value = strings.TrimLeft(value, " \t\r\n")
+		}
+		if option(options, nil, "rstrip", "true") == "true" {
+			value = strings.TrimRight(value, " \t\r\n")
+		}
+		results = append(results, value)
+	}
+	return results, nil
+}
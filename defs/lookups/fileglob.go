@@ -0,0 +1,41 @@
+package lookups
+
+import (
+	"goparse/defs"
+	"os"
+	fp "path/filepath"
+)
+
+func init() {
+	defs.MustRegisterLookup(&Fileglob{})
+}
+
+// Fileglob returns the files matching the patterns.
+// The directory of a relative pattern is searched like a file.
+type Fileglob struct{}
+
+func (lookup *Fileglob) Name() string {
+	return "fileglob"
+}
+
+func (lookup *Fileglob) Run(lookupContext *defs.LookupContext, terms []any, options defs.Config) ([]any, error) {
+	results := []any{}
+	for _, pattern := range toStrings(terms) {
+		dir, err := lookupContext.FindFile("files", fp.Dir(pattern))
+		if err != nil {
+			// Nothing matches in a missing directory.
+			continue
+		}
+		pattern = fp.Join(dir, fp.Base(pattern))
+		matches, err := fp.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil && info.Mode().IsRegular() {
+				results = append(results, match)
+			}
+		}
+	}
+	return results, nil
+}
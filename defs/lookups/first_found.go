@@ -0,0 +1,80 @@
+package lookups
+
+import (
+	"errors"
+	"fmt"
+	"goparse/defs"
+	fp "path/filepath"
+	"strings"
+)
+
+func init() {
+	defs.MustRegisterLookup(&FirstFound{})
+}
+
+// FirstFound returns the first existing file.
+// The terms are files or dictionaries with files, paths and skip.
+type FirstFound struct{}
+
+func (lookup *FirstFound) Name() string {
+	return "first_found"
+}
+
+func (lookup *FirstFound) Run(lookupContext *defs.LookupContext, terms []any, options defs.Config) ([]any, error) {
+	files := splitPaths(options["files"])
+	paths := splitPaths(options["paths"])
+	skip := option(options, nil, "skip", "false") == "true"
+	for _, term := range terms {
+		if params, ok := term.(map[string]any); ok {
+			files = append(files, splitPaths(params["files"])...)
+			paths = append(paths, splitPaths(params["paths"])...)
+			if value, ok := params["skip"]; ok {
+				skip = fmt.Sprint(value) == "true"
+			}
+			continue
+		}
+		files = append(files, splitPaths(term)...)
+	}
+	candidates := files
+	if len(paths) > 0 {
+		candidates = []string{}
+		for _, file := range files {
+			for _, path := range paths {
+				candidates = append(candidates, fp.Join(path, file))
+			}
+		}
+	}
+	for _, candidate := range candidates {
+		path, err := lookupContext.FindFile("files", candidate)
+		if err == nil {
+			return []any{path}, nil
+		}
+	}
+	if skip {
+		return []any{}, nil
+	}
+	return nil, errors.New("No file was found when using first_found")
+}
+
+// splitPaths returns the paths in a list or in a string separated by commas or semicolons.
+func splitPaths(value any) []string {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []any:
+		paths := []string{}
+		for _, item := range v {
+			paths = append(paths, splitPaths(item)...)
+		}
+		return paths
+	case string:
+		paths := []string{}
+		for _, path := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ';' }) {
+			if path = strings.TrimSpace(path); path != "" {
+				paths = append(paths, path)
+			}
+		}
+		return paths
+	}
+	return []string{fmt.Sprint(value)}
+}
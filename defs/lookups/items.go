@@ -0,0 +1,28 @@
+package lookups
+
+import (
+	"goparse/defs"
+)
+
+func init() {
+	defs.MustRegisterLookup(&Items{})
+}
+
+// Items returns the terms with the lists flattened by one level.
+type Items struct{}
+
+func (lookup *Items) Name() string {
+	return "items"
+}
+
+func (lookup *Items) Run(lookupContext *defs.LookupContext, terms []any, options defs.Config) ([]any, error) {
+	results := []any{}
+	for _, term := range terms {
+		if list, ok := term.([]any); ok {
+			results = append(results, list...)
+		} else {
+			results = append(results, term)
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,35 @@
+package lookups
+
+import (
+	"goparse/defs"
+	"strings"
+)
+
+func init() {
+	defs.MustRegisterLookup(&Lines{})
+}
+
+// Lines returns the output lines of the commands.
+type Lines struct{}
+
+func (lookup *Lines) Name() string {
+	return "lines"
+}
+
+func (lookup *Lines) Run(lookupContext *defs.LookupContext, terms []any, options defs.Config) ([]any, error) {
+	results := []any{}
+	for _, command := range toStrings(terms) {
+		output, err := runCommand(lookupContext, command)
+		if err != nil {
+			return nil, err
+		}
+		output = strings.TrimRight(output, "\n")
+		if output == "" {
+			continue
+		}
+		for _, line := range strings.Split(output, "\n") {
+			results = append(results, line)
+		}
+	}
+	return results, nil
+}
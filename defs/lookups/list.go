@@ -0,0 +1,20 @@
+package lookups
+
+import (
+	"goparse/defs"
+)
+
+func init() {
+	defs.MustRegisterLookup(&List{})
+}
+
+// List returns the terms as they are.
+type List struct{}
+
+func (lookup *List) Name() string {
+	return "list"
+}
+
+func (lookup *List) Run(lookupContext *defs.LookupContext, terms []any, options defs.Config) ([]any, error) {
+	return append([]any{}, terms...), nil
+}
@@ -0,0 +1,159 @@
+package lookups
+
+import (
+	"goparse/defs"
+	"os"
+	fp "path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes the files in a temporary directory and returns the directory.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := fp.Join(dir, name)
+		err := os.MkdirAll(fp.Dir(path), 0755)
+		if err == nil {
+			err = os.WriteFile(path, []byte(content), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// evaluate evaluates the template with the directory as the search path.
+func evaluate(dir string, template string, values defs.Config) (any, error) {
+	resolver := defs.NewTemplateResolver(values, defs.TemplateOptions{Native: true, SearchPaths: []string{dir}})
+	return defs.ResolveVars[any](template, resolver)
+}
+
+func TestLookups(t *testing.T) {
+	t.Setenv("GOPARSE_LOOKUP_TEST", "from env")
+	dir := writeFiles(t, map[string]string{
+		"files/key.pub":        "ssh-ed25519 AAAA\n",
+		"top.txt":              "  top  \n",
+		"files/a.conf":         "",
+		"files/b.conf":         "",
+		"files/b.txt":          "",
+		"templates/motd.j2":    "Hello {{ name }} from {{ site }}",
+		"files/users.csv":      "alice,1000,admin\nbob,1001,dev\n",
+		"files/ansible.csv":    "alice\t/home/alice\n",
+		"files/default.yaml":   "",
+		"vars/production.yaml": "",
+	})
+	values := defs.Config{"name": "alice", "site": "east", "env_name": "production"}
+	tests := map[string]any{
+		"{{ lookup('env', 'GOPARSE_LOOKUP_TEST') }}":                                        "from env",
+		"{{ lookup('env', 'GOPARSE_LOOKUP_MISSING', default='none') }}":                     "none",
+		"{{ lookup('file', 'key.pub') }}":                                                   "ssh-ed25519 AAAA",
+		"{{ lookup('file', 'top.txt', lstrip=true) }}":                                      "top",
+		"{{ lookup('file', 'key.pub', 'top.txt') }}":                                        "ssh-ed25519 AAAA,  top",
+		"{{ query('file', 'key.pub') }}":                                                    []any{"ssh-ed25519 AAAA"},
+		"{{ lookup('template', 'motd.j2') }}":                                               "Hello alice from east",
+		"{{ lookup('template', 'motd.j2', template_vars={'site': 'west'}) }}":               "Hello alice from west",
+		"{{ lookup('pipe', 'echo piped') }}":                                                "piped",
+		"{{ query('lines', 'printf \"a\\\\nb\\\\n\"') }}":                                   []any{"a", "b"},
+		"{{ lookup('vars', 'site') }}":                                                      "east",
+		"{{ lookup('vars', 'missing', default=1) }}":                                        1,
+		"{{ lookup('csvfile', 'bob file=users.csv delimiter=, col=2') }}":                   "dev",
+		"{{ lookup('csvfile', 'alice col=1') }}":                                            "/home/alice",
+		"{{ lookup('csvfile', 'carol file=users.csv delimiter=, default=none') }}":          "none",
+		"{{ lookup('first_found', [env_name ~ '.yaml', 'default.yaml'], paths=['vars']) }}": fp.Join(dir, "vars/production.yaml"),
+		"{{ lookup('first_found', ['missing.yaml', 'default.yaml']) }}":                     fp.Join(dir, "files/default.yaml"),
+		"{{ query('first_found', ['missing.yaml'], skip=true) }}":                           []any{},
+		"{{ query('fileglob', '*.conf') }}":                                                 []any{fp.Join(dir, "files/a.conf"), fp.Join(dir, "files/b.conf")},
+		"{{ query('fileglob', 'missing/*') }}":                                              []any{},
+	}
+	for template, want := range tests {
+		got, err := evaluate(dir, template, values)
+		if err != nil {
+			t.Errorf("evaluate(%q) failed: %v", template, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("evaluate(%q) = %#v, want %#v", template, got, want)
+		}
+	}
+}
+
+func TestLookupErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[string]string{
+		"{{ lookup('file', 'missing.txt') }}":      "Lookup file failed",
+		"{{ lookup('vars', 'missing') }}":          "No variable found with name missing",
+		"{{ lookup('first_found', ['missing']) }}": "No file was found",
+		"{{ lookup('pipe', 'exit 3') }}":           "Lookup pipe failed",
+		"{{ lookup('nope', 'x') }}":                "Lookup plugin nope is not found",
+		"{{ lookup('password', 'x length=0') }}":   "Invalid password length",
+	}
+	for template, want := range tests {
+		_, err := evaluate(dir, template, defs.Config{})
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("evaluate(%q) = %v, want an error containing %q", template, err, want)
+		}
+	}
+	// The failures are ignored if errors is ignore.
+	got, err := evaluate(dir, "{{ query('file', 'missing.txt', errors='ignore') }}", defs.Config{})
+	if err != nil || !reflect.DeepEqual(got, []any{}) {
+		t.Errorf("ignored lookup = %#v, %v, want an empty list", got, err)
+	}
+}
+
+func TestPasswordLookup(t *testing.T) {
+	dir := t.TempDir()
+	first, err := evaluate(dir, "{{ lookup('password', 'creds/db length=12 chars=digits') }}", defs.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	password, _ := first.(string)
+	if len(password) != 12 || strings.Trim(password, "0123456789") != "" {
+		t.Errorf("password = %q, want 12 digits", password)
+	}
+	// The stored password is returned the next time.
+	second, err := evaluate(dir, "{{ lookup('password', 'creds/db') }}", defs.Config{})
+	if err != nil || second != first {
+		t.Errorf("second password = %v, %v, want %v", second, err, first)
+	}
+	info, err := os.Stat(fp.Join(dir, "creds/db"))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("password file = %v, %v, want the mode 0600", info, err)
+	}
+	// The password is not stored for /dev/null.
+	other, err := evaluate(dir, "{{ lookup('password', '/dev/null') }}", defs.Config{})
+	if err != nil || len(other.(string)) != defaultPasswordLength {
+		t.Errorf("/dev/null password = %v, %v", other, err)
+	}
+}
+
+func TestPasswordChars(t *testing.T) {
+	tests := map[string]string{
+		"digits":       "0123456789",
+		"octdigits,xy": "01234567xy",
+		"digits,,":     ",0123456789",
+		"ab,,cd":       ",abcd",
+	}
+	for sets, want := range tests {
+		if got := passwordChars(sets); got != want {
+			t.Errorf("passwordChars(%q) = %q, want %q", sets, got, want)
+		}
+	}
+}
+
+func TestParseTerm(t *testing.T) {
+	name, params, err := parseTerm(`key with space file='my file.csv' delimiter="," col=2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"file": "my file.csv", "delimiter": ",", "col": "2"}
+	if name != "key with space" || !reflect.DeepEqual(params, want) {
+		t.Errorf("parseTerm = %q, %v, want key with space, %v", name, params, want)
+	}
+	if _, _, err := parseTerm("key 'unbalanced"); err == nil {
+		t.Errorf("parseTerm with an unbalanced quote succeeded")
+	}
+}
@@ -0,0 +1,44 @@
+package lookups
+
+import (
+	"errors"
+	"goparse/defs"
+)
+
+func init() {
+	defs.MustRegisterLookup(&Nested{})
+}
+
+// Nested returns the product of the lists in the terms.
+type Nested struct{}
+
+func (lookup *Nested) Name() string {
+	return "nested"
+}
+
+func (lookup *Nested) Run(lookupContext *defs.LookupContext, terms []any, options defs.Config) ([]any, error) {
+	if len(terms) == 0 {
+		return nil, errors.New("Nested lookup requires at least one list")
+	}
+	products := [][]any{{}}
+	for _, term := range terms {
+		list, ok := term.([]any)
+		if !ok {
+			list = []any{term}
+		}
+		next := make([][]any, 0, len(products)*len(list))
+		for _, product := range products {
+			for _, item := range list {
+				combined := make([]any, 0, len(product)+1)
+				combined = append(combined, product...)
+				next = append(next, append(combined, item))
+			}
+		}
+		products = next
+	}
+	results := make([]any, 0, len(products))
+	for _, product := range products {
+		results = append(results, product)
+	}
+	return results, nil
+}
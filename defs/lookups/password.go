@@ -0,0 +1,127 @@
+package lookups
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"goparse/defs"
+	"math/big"
+	"os"
+	fp "path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPasswordLength = 20
+)
+
+var (
+	passwordCharSets = map[string]string{
+		"ascii_letters":   "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ",
+		"ascii_lowercase": "abcdefghijklmnopqrstuvwxyz",
+		"ascii_uppercase": "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+		"digits":          "0123456789",
+		"hexdigits":       "0123456789abcdefABCDEF",
+		"octdigits":       "01234567",
+		"punctuation":     "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~",
+	}
+)
+
+func init() {
+	defs.MustRegisterLookup(&Password{})
+}
+
+// Password returns the passwords stored in the files on the controller.
+// A random password is generated and stored if the file does not exist.
+// The terms are in the form of "path length=20 chars=ascii_letters,digits".
+// The password is not stored if the path is /dev/null.
+type Password struct{}
+
+func (lookup *Password) Name() string {
+	return "password"
+}
+
+func (lookup *Password) Run(lookupContext *defs.LookupContext, terms []any, options defs.Config) ([]any, error) {
+	results := []any{}
+	for _, term := range toStrings(terms) {
+		path, params, err := parseTerm(term)
+		if err != nil {
+			return nil, err
+		}
+		if path == "" {
+			return nil, errors.New("Password file path is missing")
+		}
+		if option(options, params, "encrypt", "") != "" {
+			return nil, errors.New("Encrypted passwords are not supported, use the password_hash filter instead")
+		}
+		length, err := strconv.Atoi(option(options, params, "length", strconv.Itoa(defaultPasswordLength)))
+		if err != nil || length <= 0 {
+			return nil, fmt.Errorf("Invalid password length in %s", term)
+		}
+		chars := passwordChars(option(options, params, "chars", "ascii_letters,digits,.,,:-_"))
+		password, err := readOrCreatePassword(lookupContext.Path(path), length, chars)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, password)
+	}
+	return results, nil
+}
+
+// passwordChars returns the characters in the comma separated sets.
+// A set is either a name like digits or the literal characters. Two commas anywhere add a comma.
+func passwordChars(sets string) string {
+	var sb strings.Builder
+	if strings.Contains(sets, ",,") {
+		sb.WriteString(",")
+	}
+	for _, set := range strings.Split(strings.ReplaceAll(sets, ",,", ","), ",") {
+		if chars, ok := passwordCharSets[set]; ok {
+			sb.WriteString(chars)
+		} else {
+			sb.WriteString(set)
+		}
+	}
+	return sb.String()
+}
+
+func readOrCreatePassword(path string, length int, chars string) (string, error) {
+	if path != os.DevNull {
+		content, err := os.ReadFile(path)
+		if err == nil {
+			// The file may also have the salt of an encrypted password.
+			password, _, _ := strings.Cut(strings.TrimRight(string(content), "\n"), " salt=")
+			return password, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	if chars == "" {
+		return "", errors.New("Password characters are empty")
+	}
+	runes := []rune(chars)
+	var sb strings.Builder
+	max := big.NewInt(int64(len(runes)))
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteRune(runes[n.Int64()])
+	}
+	password := sb.String()
+	if path == os.DevNull {
+		return password, nil
+	}
+	err := os.MkdirAll(fp.Dir(path), 0700)
+	if err != nil {
+		return "", err
+	}
+	err = os.WriteFile(path, []byte(password+"\n"), 0600)
+	if err != nil {
+		return "", err
+	}
+	return password, nil
+}
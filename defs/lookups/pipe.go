@@ -0,0 +1,42 @@
+package lookups
+
+import (
+	"fmt"
+	"goparse/defs"
+	"os/exec"
+	"strings"
+)
+
+func init() {
+	defs.MustRegisterLookup(&Pipe{})
+}
+
+// Pipe returns the outputs of the commands.
+type Pipe struct{}
+
+func (lookup *Pipe) Name() string {
+	return "pipe"
+}
+
+func (lookup *Pipe) Run(lookupContext *defs.LookupContext, terms []any, options defs.Config) ([]any, error) {
+	results := []any{}
+	for _, command := range toStrings(terms) {
+		output, err := runCommand(lookupContext, command)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, strings.TrimRight(output, "\n"))
+	}
+	return results, nil
+}
+
+// runCommand runs the command in the first search path.
+func runCommand(lookupContext *defs.LookupContext, command string) (string, error) {
+	cmd := exec.Command("/bin/bash", "-c", command)
+	cmd.Dir = lookupContext.Path("")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("Command %s failed: %w", command, err)
+	}
+	return string(output), nil
+}
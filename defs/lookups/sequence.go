@@ -0,0 +1,134 @@
+package lookups
+
+import (
+	"errors"
+	"fmt"
+	"goparse/defs"
+	"regexp"
+	"strconv"
+)
+
+var (
+	// The shortcut form is [start-]end[/stride][:format].
+	sequenceShortcut = regexp.MustCompile(`^(?:(0[xX][0-9a-fA-F]+|0[oO]?[0-7]+|-?\d+)-)?(0[xX][0-9a-fA-F]+|0[oO]?[0-7]+|-?\d+)(?:/(-?\d+|0[xX][0-9a-fA-F]+|0[oO]?[0-7]+))?(?::(.+))?$`)
+)
+
+func init() {
+	defs.MustRegisterLookup(&Sequence{})
+}
+
+// Sequence returns the formatted numbers in the sequences.
+// The terms are in the form of "start=1 end=10 stride=1 format=%d", "count=10" or the shortcut "1-10/1:%d".
+type Sequence struct{}
+
+func (lookup *Sequence) Name() string {
+	return "sequence"
+}
+
+func (lookup *Sequence) Run(lookupContext *defs.LookupContext, terms []any, options defs.Config) ([]any, error) {
+	results := []any{}
+	for _, term := range toStrings(terms) {
+		params, err := sequenceParams(term)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range options {
+			if _, ok := params[key]; !ok {
+				params[key] = fmt.Sprint(value)
+			}
+		}
+		numbers, err := sequenceNumbers(params)
+		if err != nil {
+			return nil, err
+		}
+		format := params["format"]
+		if format == "" {
+			format = "%d"
+		}
+		for _, number := range numbers {
+			results = append(results, fmt.Sprintf(format, number))
+		}
+	}
+	return results, nil
+}
+
+func sequenceParams(term string) (map[string]string, error) {
+	if match := sequenceShortcut.FindStringSubmatch(term); match != nil {
+		params := map[string]string{"end": match[2]}
+		if match[1] != "" {
+			params["start"] = match[1]
+		}
+		if match[3] != "" {
+			params["stride"] = match[3]
+		}
+		if match[4] != "" {
+			params["format"] = match[4]
+		}
+		return params, nil
+	}
+	name, params, err := parseTerm(term)
+	if err != nil {
+		return nil, err
+	}
+	if name != "" {
+		return nil, fmt.Errorf("Invalid sequence %s", term)
+	}
+	return params, nil
+}
+
+func sequenceNumbers(params map[string]string) ([]int64, error) {
+	parse := func(name string, defaultValue int64) (int64, error) {
+		value, ok := params[name]
+		if !ok {
+			return defaultValue, nil
+		}
+		number, err := strconv.ParseInt(value, 0, 64)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid sequence %s %s", name, value)
+		}
+		return number, nil
+	}
+	start, err := parse("start", 1)
+	if err != nil {
+		return nil, err
+	}
+	stride, err := parse("stride", 1)
+	if err != nil {
+		return nil, err
+	}
+	_, hasEnd := params["end"]
+	_, hasCount := params["count"]
+	if hasEnd == hasCount {
+		return nil, errors.New("Sequence requires either end or count")
+	}
+	var end int64
+	if hasCount {
+		count, err := parse("count", 0)
+		if err != nil {
+			return nil, err
+		}
+		if count <= 0 {
+			return nil, nil
+		}
+		end = start + count*stride - 1
+		if stride < 0 {
+			end = start + count*stride + 1
+		}
+	} else if end, err = parse("end", 0); err != nil {
+		return nil, err
+	}
+	if stride == 0 {
+		return nil, nil
+	}
+	if stride > 0 && end < start {
+		return nil, errors.New("Sequence end must not be less than start, use a negative stride to count backwards")
+	}
+	if stride < 0 && end > start {
+		return nil, errors.New("Sequence end must not be greater than start with a negative stride")
+	}
+	numbers := []int64{}
+	for i := start; (stride > 0 && i <= end) || (stride < 0 && i >= end); i += stride {
+		numbers = append(numbers, i)
+	}
+	return numbers, nil
+}
@@ -0,0 +1,80 @@
+package lookups
+
+import (
+	"errors"
+	"fmt"
+	"goparse/defs"
+	"sort"
+	"strings"
+)
+
+func init() {
+	defs.MustRegisterLookup(&Subelements{})
+}
+
+// Subelements returns the pairs of each item and each element in the list under the key of the item.
+// The terms are the items, the key which may be dotted and optionally the flags like skip_missing.
+type Subelements struct{}
+
+func (lookup *Subelements) Name() string {
+	return "subelements"
+}
+
+func (lookup *Subelements) Run(lookupContext *defs.LookupContext, terms []any, options defs.Config) ([]any, error) {
+	if len(terms) < 2 || len(terms) > 3 {
+		return nil, errors.New("Subelements lookup expects a list, a key and optionally flags")
+	}
+	items, ok := terms[0].([]any)
+	if !ok {
+		dict, ok := toMap(terms[0])
+		if !ok {
+			return nil, fmt.Errorf("Subelements lookup expects a list or a dictionary, but found %T", terms[0])
+		}
+		keys := make([]string, 0, len(dict))
+		for key := range dict {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			items = append(items, dict[key])
+		}
+	}
+	key, ok := terms[1].(string)
+	if !ok {
+		return nil, fmt.Errorf("Subelements key must be a string, but found %T", terms[1])
+	}
+	skipMissing := option(options, nil, "skip_missing", "false") == "true"
+	if len(terms) == 3 {
+		flags, ok := toMap(terms[2])
+		if !ok {
+			return nil, fmt.Errorf("Subelements flags must be a dictionary, but found %T", terms[2])
+		}
+		skipMissing = fmt.Sprint(flags["skip_missing"]) == "true"
+	}
+	results := []any{}
+	for _, item := range items {
+		var subelements any = item
+		for _, part := range strings.Split(key, ".") {
+			dict, ok := toMap(subelements)
+			if !ok {
+				subelements = nil
+				break
+			}
+			subelements = dict[part]
+		}
+		if subelements == nil {
+			if skipMissing {
+				continue
+			}
+			return nil, fmt.Errorf("Could not find key %s in the item %v", key, item)
+		}
+		list, ok := subelements.([]any)
+		if !ok {
+			return nil, fmt.Errorf("The key %s must be a list, but found %T", key, subelements)
+		}
+		for _, subelement := range list {
+			results = append(results, []any{item, subelement})
+		}
+	}
+	return results, nil
+}
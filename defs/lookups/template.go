@@ -0,0 +1,47 @@
+package lookups
+
+import (
+	"fmt"
+	"goparse/defs"
+)
+
+func init() {
+	defs.MustRegisterLookup(&Template{})
+}
+
+// Template returns the rendered template files.
+type Template struct{}
+
+func (lookup *Template) Name() string {
+	return "template"
+}
+
+func (lookup *Template) Run(lookupContext *defs.LookupContext, terms []any, options defs.Config) ([]any, error) {
+	values := lookupContext.Variables
+	if templateVars, ok := options["template_vars"]; ok {
+		extraVars, ok := templateVars.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("Template vars must be a dictionary, but found %T", templateVars)
+		}
+		values = make(defs.Config, len(lookupContext.Variables)+len(extraVars))
+		for key, value := range lookupContext.Variables {
+			values[key] = value
+		}
+		for key, value := range extraVars {
+			values[key] = value
+		}
+	}
+	results := []any{}
+	for _, term := range toStrings(terms) {
+		path, err := lookupContext.FindFile("templates", term)
+		if err != nil {
+			return nil, err
+		}
+		output, err := lookupContext.RenderTemplateFile(path, values)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, output)
+	}
+	return results, nil
+}
@@ -0,0 +1,33 @@
+package lookups
+
+import (
+	"fmt"
+	"goparse/defs"
+)
+
+func init() {
+	defs.MustRegisterLookup(&Vars{})
+}
+
+// Vars returns the values of the variables.
+type Vars struct{}
+
+func (lookup *Vars) Name() string {
+	return "vars"
+}
+
+func (lookup *Vars) Run(lookupContext *defs.LookupContext, terms []any, options defs.Config) ([]any, error) {
+	results := []any{}
+	for _, name := range toStrings(terms) {
+		value, ok := lookupContext.Variables[name]
+		if !ok {
+			defaultValue, ok := options["default"]
+			if !ok {
+				return nil, fmt.Errorf("No variable found with name %s", name)
+			}
+			value = defaultValue
+		}
+		results = append(results, value)
+	}
+	return results, nil
+}
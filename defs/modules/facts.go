@@ -0,0 +1,571 @@
+package modules
+
+import (
+	"encoding/json"
+	"fmt"
+	"goparse/defs"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// factCollectors gather the subsets of the facts by the names.
+	factCollectors = map[string]*factCollector{
+		"platform": {
+			commands: map[string]string{
+				"hostname": "hostname || uname -n",
+				"fqdn":     "hostname -f || hostname",
+				"nodename": "uname -n",
+				"system":   "uname -s",
+				"kernel":   "uname -r",
+				"version":  "uname -v",
+				"machine":  "uname -m",
+			},
+			parse: parsePlatformFacts,
+		},
+		"distribution": {
+			commands: map[string]string{
+				"os_release": "cat /etc/os-release || cat /usr/lib/os-release",
+				"system":     "uname -s",
+			},
+			parse: parseDistributionFacts,
+		},
+		"env": {
+			commands: map[string]string{"env": "env"},
+			parse:    parseEnvFacts,
+		},
+		"date_time": {
+			commands: map[string]string{"date": "date '+%s %z %Z'"},
+			parse:    parseDateTimeFacts,
+		},
+		"user": {
+			commands: map[string]string{"id": `id -un; id -u; id -g; echo "$HOME"; echo "$SHELL"`},
+			parse:    parseUserFacts,
+		},
+		"python": {
+			commands: map[string]string{
+				"python": `for python in python3 python; do "$python" -c 'import sys, json, platform; print(json.dumps({"executable": sys.executable, "version_info": list(sys.version_info), "type": platform.python_implementation()}))' && break; done`,
+			},
+			parse: parsePythonFacts,
+		},
+		"go": {
+			commands: map[string]string{"go": "go env GOVERSION GOOS GOARCH"},
+			parse:    parseGoFacts,
+		},
+		"hardware": {
+			commands: map[string]string{
+				"cpuinfo": "cat /proc/cpuinfo",
+				"nproc":   "nproc || getconf _NPROCESSORS_ONLN",
+				"meminfo": "cat /proc/meminfo",
+				"mounts":  "cat /proc/mounts",
+				"df":      "df -P -k",
+			},
+			parse: parseHardwareFacts,
+		},
+		"network": {
+			commands: map[string]string{
+				"links":     `for dev in /sys/class/net/*; do [ -e "$dev" ] && echo "${dev##*/}|$(cat "$dev/address")|$(cat "$dev/mtu")|$(cat "$dev/operstate")"; done`,
+				"addresses": "ip -o addr show",
+				"route":     "cat /proc/net/route",
+			},
+			parse: parseNetworkFacts,
+		},
+	}
+	// minFactSubsets are the subsets gathered unless they are excluded explicitly.
+	minFactSubsets = []string{"platform", "distribution", "env", "date_time", "user", "python", "go"}
+	// distributionNames are the distribution names by the IDs in /etc/os-release.
+	distributionNames = map[string]string{
+		"almalinux":           "AlmaLinux",
+		"alpine":              "Alpine",
+		"amzn":                "Amazon",
+		"arch":                "Archlinux",
+		"centos":              "CentOS",
+		"debian":              "Debian",
+		"fedora":              "Fedora",
+		"ol":                  "OracleLinux",
+		"opensuse-leap":       "openSUSE Leap",
+		"opensuse-tumbleweed": "openSUSE Tumbleweed",
+		"rhel":                "RedHat",
+		"rocky":               "Rocky",
+		"sles":                "SLES",
+		"ubuntu":              "Ubuntu",
+	}
+	// osFamilies are the OS families by the distribution IDs. The IDs in ID_LIKE are also looked up.
+	osFamilies = map[string]string{
+		"almalinux":           "RedHat",
+		"amzn":                "RedHat",
+		"centos":              "RedHat",
+		"fedora":              "RedHat",
+		"ol":                  "RedHat",
+		"rhel":                "RedHat",
+		"rocky":               "RedHat",
+		"debian":              "Debian",
+		"ubuntu":              "Debian",
+		"opensuse-leap":       "Suse",
+		"opensuse-tumbleweed": "Suse",
+		"sles":                "Suse",
+		"suse":                "Suse",
+		"alpine":              "Alpine",
+		"arch":                "Archlinux",
+	}
+	envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+)
+
+// factCollector gathers a subset of the facts by running the shell commands on the host.
+type factCollector struct {
+	// commands print the sections of the output by the names.
+	commands map[string]string
+	// parse sets the facts from the sections of the output. The facts are not prefixed with ansible_.
+	parse func(sections map[string]string, facts defs.Config)
+}
+
+// factScript returns the shell script running the commands of the collectors.
+// Each section of the output starts with a line of @@ followed by the collector and the section names.
+func factScript(names []string) string {
+	var script strings.Builder
+	for _, name := range names {
+		commands := factCollectors[name].commands
+		sections := make([]string, 0, len(commands))
+		for section := range commands {
+			sections = append(sections, section)
+		}
+		sort.Strings(sections)
+		for _, section := range sections {
+			fmt.Fprintf(&script, "echo '@@%s.%s'\n{ %s\n} 2>/dev/null\n", name, section, commands[section])
+		}
+	}
+	// The facts of the missing commands are not set instead of failing.
+	script.WriteString("exit 0\n")
+	return script.String()
+}
+
+// parseFactSections splits the output of the fact script into the sections of the collectors.
+func parseFactSections(output string) map[string]map[string]string {
+	sections := map[string]map[string]string{}
+	name, section := "", ""
+	lines := []string{}
+	flush := func() {
+		if name != "" {
+			sections[name][section] = strings.Join(lines, "\n")
+		}
+	}
+	for _, line := range strings.Split(strings.TrimRight(output, "\n"), "\n") {
+		if marker, ok := strings.CutPrefix(line, "@@"); ok {
+			if markerName, markerSection, ok := strings.Cut(marker, "."); ok {
+				flush()
+				name, section, lines = markerName, markerSection, []string{}
+				if sections[name] == nil {
+					sections[name] = map[string]string{}
+				}
+				continue
+			}
+		}
+		lines = append(lines, line)
+	}
+	flush()
+	return sections
+}
+
+func parsePlatformFacts(sections map[string]string, facts defs.Config) {
+	fqdn := strings.TrimSpace(sections["fqdn"])
+	hostname := strings.SplitN(strings.TrimSpace(sections["hostname"]), ".", 2)[0]
+	facts["hostname"] = hostname
+	facts["fqdn"] = fqdn
+	facts["domain"] = ""
+	if _, domain, ok := strings.Cut(fqdn, "."); ok {
+		facts["domain"] = domain
+	}
+	facts["nodename"] = strings.TrimSpace(sections["nodename"])
+	facts["system"] = strings.TrimSpace(sections["system"])
+	facts["kernel"] = strings.TrimSpace(sections["kernel"])
+	facts["kernel_version"] = strings.TrimSpace(sections["version"])
+	facts["machine"] = strings.TrimSpace(sections["machine"])
+	facts["architecture"] = facts["machine"]
+}
+
+func parseDistributionFacts(sections map[string]string, facts defs.Config) {
+	osRelease := map[string]string{}
+	for _, line := range strings.Split(sections["os_release"], "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok || strings.HasPrefix(key, "#") {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, `'"`)
+		}
+		osRelease[key] = value
+	}
+	system := strings.TrimSpace(sections["system"])
+	id := osRelease["ID"]
+	distribution, ok := distributionNames[id]
+	if !ok {
+		distribution = strings.SplitN(osRelease["NAME"], " ", 2)[0]
+	}
+	if distribution == "" {
+		distribution = system
+	}
+	family, ok := osFamilies[id]
+	for _, like := range strings.Fields(osRelease["ID_LIKE"]) {
+		if ok {
+			break
+		}
+		family, ok = osFamilies[like]
+	}
+	if !ok {
+		family = distribution
+	}
+	version := osRelease["VERSION_ID"]
+	facts["distribution"] = distribution
+	facts["distribution_version"] = version
+	facts["distribution_major_version"] = strings.SplitN(version, ".", 2)[0]
+	facts["distribution_release"] = osRelease["VERSION_CODENAME"]
+	facts["os_family"] = family
+}
+
+func parseEnvFacts(sections map[string]string, facts defs.Config) {
+	env := map[string]any{}
+	last := ""
+	for _, line := range strings.Split(sections["env"], "\n") {
+		if envNamePattern.MatchString(line) {
+			key, value, _ := strings.Cut(line, "=")
+			env[key] = value
+			last = key
+		} else if last != "" {
+			// A value with newlines continues on the next lines.
+			env[last] = env[last].(string) + "\n" + line
+		}
+	}
+	facts["env"] = env
+}
+
+func parseDateTimeFacts(sections map[string]string, facts defs.Config) {
+	fields := strings.Fields(sections["date"])
+	if len(fields) < 3 {
+		return
+	}
+	epoch, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return
+	}
+	offset, err := time.Parse("-0700", fields[1])
+	if err != nil {
+		return
+	}
+	_, seconds := offset.Zone()
+	t := time.Unix(epoch, 0).In(time.FixedZone(fields[2], seconds))
+	_, week := t.ISOWeek()
+	facts["date_time"] = map[string]any{
+		"year":                t.Format("2006"),
+		"month":               t.Format("01"),
+		"day":                 t.Format("02"),
+		"hour":                t.Format("15"),
+		"minute":              t.Format("04"),
+		"second":              t.Format("05"),
+		"epoch":               fields[0],
+		"epoch_int":           fields[0],
+		"date":                t.Format("2006-01-02"),
+		"time":                t.Format("15:04:05"),
+		"iso8601":             t.UTC().Format("2006-01-02T15:04:05Z"),
+		"iso8601_basic":       t.Format("20060102T150405.000000"),
+		"iso8601_basic_short": t.Format("20060102T150405"),
+		"iso8601_micro":       t.UTC().Format("2006-01-02T15:04:05.000000Z"),
+		"tz":                  fields[2],
+		"tz_offset":           fields[1],
+		"weekday":             t.Format("Monday"),
+		"weekday_number":      strconv.Itoa(int(t.Weekday())),
+		"weeknumber":          fmt.Sprintf("%02d", week),
+	}
+}
+
+func parseUserFacts(sections map[string]string, facts defs.Config) {
+	lines := strings.Split(sections["id"], "\n")
+	if len(lines) < 5 {
+		return
+	}
+	facts["user_id"] = lines[0]
+	if uid, err := strconv.Atoi(lines[1]); err == nil {
+		facts["user_uid"] = uid
+	}
+	if gid, err := strconv.Atoi(lines[2]); err == nil {
+		facts["user_gid"] = gid
+	}
+	facts["user_dir"] = lines[3]
+	facts["user_shell"] = lines[4]
+}
+
+func parsePythonFacts(sections map[string]string, facts defs.Config) {
+	python := struct {
+		Executable  string `json:"executable"`
+		VersionInfo []any  `json:"version_info"`
+		Type        string `json:"type"`
+	}{}
+	err := json.Unmarshal([]byte(sections["python"]), &python)
+	if err != nil || len(python.VersionInfo) < 5 {
+		// Python is not installed on the host.
+		return
+	}
+	for i, value := range python.VersionInfo {
+		if number, ok := value.(float64); ok {
+			python.VersionInfo[i] = int(number)
+		}
+	}
+	facts["python"] = map[string]any{
+		"executable":   python.Executable,
+		"type":         python.Type,
+		"version_info": python.VersionInfo,
+		"version": map[string]any{
+			"major":        python.VersionInfo[0],
+			"minor":        python.VersionInfo[1],
+			"micro":        python.VersionInfo[2],
+			"releaselevel": python.VersionInfo[3],
+			"serial":       python.VersionInfo[4],
+		},
+	}
+	facts["python_version"] = fmt.Sprintf("%v.%v.%v", python.VersionInfo[0], python.VersionInfo[1], python.VersionInfo[2])
+}
+
+func parseGoFacts(sections map[string]string, facts defs.Config) {
+	lines := strings.Split(strings.TrimSpace(sections["go"]), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "go") {
+		// Go is not installed on the host.
+		return
+	}
+	facts["go"] = map[string]any{
+		"version": lines[0],
+		"os":      lines[1],
+		"arch":    lines[2],
+	}
+}
+
+func parseHardwareFacts(sections map[string]string, facts defs.Config) {
+	parseProcessorFacts(sections["cpuinfo"], sections["nproc"], facts)
+	parseMemoryFacts(sections["meminfo"], facts)
+	facts["mounts"] = parseMounts(sections["mounts"], sections["df"])
+}
+
+func parseProcessorFacts(cpuinfo string, nproc string, facts defs.Config) {
+	vcpus := 0
+	processors := []any{}
+	sockets := map[string]struct{}{}
+	cores := 0
+	for _, line := range strings.Split(cpuinfo, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch key {
+		case "processor":
+			vcpus++
+		case "model name", "Processor":
+			processors = append(processors, value)
+		case "physical id":
+			sockets[value] = struct{}{}
+		case "cpu cores":
+			cores, _ = strconv.Atoi(value)
+		}
+	}
+	count := max(len(sockets), 1)
+	cores = max(cores, 1)
+	facts["processor"] = processors
+	facts["processor_vcpus"] = vcpus
+	facts["processor_count"] = count
+	facts["processor_cores"] = cores
+	facts["processor_threads_per_core"] = max(vcpus/(count*cores), 1)
+	facts["processor_nproc"] = vcpus
+	if value, err := strconv.Atoi(strings.TrimSpace(nproc)); err == nil {
+		facts["processor_nproc"] = value
+	}
+}
+
+func parseMemoryFacts(meminfo string, facts defs.Config) {
+	values := map[string]int{}
+	for _, line := range strings.Split(meminfo, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		// The values are in kB.
+		kb, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(value), " kB"))
+		if err == nil {
+			values[key] = kb / 1024
+		}
+	}
+	total, free, available := values["MemTotal"], values["MemFree"], values["MemAvailable"]
+	swapTotal, swapFree := values["SwapTotal"], values["SwapFree"]
+	facts["memtotal_mb"] = total
+	facts["memfree_mb"] = free
+	facts["swaptotal_mb"] = swapTotal
+	facts["swapfree_mb"] = swapFree
+	facts["memory_mb"] = map[string]any{
+		"real":    map[string]any{"total": total, "free": free, "used": total - free},
+		"nocache": map[string]any{"free": available, "used": total - available},
+		"swap":    map[string]any{"total": swapTotal, "free": swapFree, "used": swapTotal - swapFree},
+	}
+}
+
+// parseMounts returns the mounts of /proc/mounts which have the sizes in the output of df.
+func parseMounts(mounts string, df string) []any {
+	sizes := map[string][]string{}
+	for _, line := range strings.Split(df, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 6 || !strings.HasPrefix(fields[5], "/") {
+			continue
+		}
+		sizes[strings.Join(fields[5:], " ")] = fields[1:4]
+	}
+	result := []any{}
+	for _, line := range strings.Split(mounts, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		mount := unescapeMountField(fields[1])
+		size, ok := sizes[mount]
+		if !ok {
+			continue
+		}
+		total, _ := strconv.ParseInt(size[0], 10, 64)
+		available, _ := strconv.ParseInt(size[2], 10, 64)
+		result = append(result, map[string]any{
+			"mount":          mount,
+			"device":         unescapeMountField(fields[0]),
+			"fstype":         fields[2],
+			"options":        fields[3],
+			"size_total":     total * 1024,
+			"size_available": available * 1024,
+		})
+	}
+	return result
+}
+
+// unescapeMountField replaces the octal escapes like \040 for a space in /proc/mounts.
+func unescapeMountField(field string) string {
+	var result strings.Builder
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+3 < len(field) {
+			if value, err := strconv.ParseUint(field[i+1:i+4], 8, 8); err == nil {
+				result.WriteByte(byte(value))
+				i += 3
+				continue
+			}
+		}
+		result.WriteByte(field[i])
+	}
+	return result.String()
+}
+
+func parseNetworkFacts(sections map[string]string, facts defs.Config) {
+	interfaces := map[string]map[string]any{}
+	names := []any{}
+	for _, line := range strings.Split(sections["links"], "\n") {
+		fields := strings.Split(line, "|")
+		if len(fields) != 4 {
+			continue
+		}
+		mtu, _ := strconv.Atoi(fields[2])
+		interfaces[fields[0]] = map[string]any{
+			"device":     fields[0],
+			"macaddress": fields[1],
+			"mtu":        mtu,
+			"active":     fields[3] != "down",
+			"ipv6":       []any{},
+		}
+		names = append(names, fields[0])
+	}
+	ipv4Addresses, ipv6Addresses := []any{}, []any{}
+	for _, line := range strings.Split(sections["addresses"], "\n") {
+		// The lines are like 2: eth0    inet 10.0.0.2/24 brd 10.0.0.255 scope global eth0
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		iface, ok := interfaces[fields[1]]
+		if !ok {
+			continue
+		}
+		ip, network, err := net.ParseCIDR(fields[3])
+		if err != nil {
+			continue
+		}
+		prefix, _ := network.Mask.Size()
+		switch fields[2] {
+		case "inet":
+			ipv4 := map[string]any{
+				"address": ip.String(),
+				"netmask": net.IP(network.Mask).String(),
+				"network": network.IP.String(),
+				"prefix":  strconv.Itoa(prefix),
+			}
+			if len(fields) > 5 && fields[4] == "brd" {
+				ipv4["broadcast"] = fields[5]
+			}
+			if _, ok := iface["ipv4"]; ok {
+				secondaries, _ := iface["ipv4_secondaries"].([]any)
+				iface["ipv4_secondaries"] = append(secondaries, ipv4)
+			} else {
+				iface["ipv4"] = ipv4
+			}
+			if !ip.IsLoopback() {
+				ipv4Addresses = append(ipv4Addresses, ip.String())
+			}
+		case "inet6":
+			scope := ""
+			if len(fields) > 5 && fields[4] == "scope" {
+				scope = fields[5]
+			}
+			iface["ipv6"] = append(iface["ipv6"].([]any), map[string]any{
+				"address": ip.String(),
+				"prefix":  strconv.Itoa(prefix),
+				"scope":   scope,
+			})
+			if !ip.IsLoopback() {
+				ipv6Addresses = append(ipv6Addresses, ip.String())
+			}
+		}
+	}
+	for name, iface := range interfaces {
+		// The interface names like eth0.100 and br-lan are not valid variable names.
+		facts[strings.NewReplacer("-", "_", ".", "_", ":", "_").Replace(name)] = iface
+	}
+	facts["interfaces"] = names
+	facts["all_ipv4_addresses"] = ipv4Addresses
+	facts["all_ipv6_addresses"] = ipv6Addresses
+	facts["default_ipv4"] = defaultIPv4(sections["route"], interfaces)
+}
+
+// defaultIPv4 returns the interface of the default route in /proc/net/route with the gateway.
+func defaultIPv4(route string, interfaces map[string]map[string]any) map[string]any {
+	for _, line := range strings.Split(route, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		// The gateway is a little endian hex number.
+		gateway, err := strconv.ParseUint(fields[2], 16, 32)
+		if err != nil {
+			continue
+		}
+		result := map[string]any{
+			"interface": fields[0],
+			"gateway":   net.IPv4(byte(gateway), byte(gateway>>8), byte(gateway>>16), byte(gateway>>24)).String(),
+		}
+		if iface, ok := interfaces[fields[0]]; ok {
+			result["macaddress"] = iface["macaddress"]
+			result["mtu"] = iface["mtu"]
+			if ipv4, ok := iface["ipv4"].(map[string]any); ok {
+				for key, value := range ipv4 {
+					result[key] = value
+				}
+			}
+		}
+		return result
+	}
+	return map[string]any{}
+}
@@ -0,0 +1,270 @@
+package modules
+
+import (
+	"goparse/defs"
+	"reflect"
+	"testing"
+)
+
+func TestParseDistributionFacts(t *testing.T) {
+	tests := []struct {
+		name      string
+		osRelease string
+		want      defs.Config
+	}{
+		{
+			name: "ubuntu",
+			osRelease: `PRETTY_NAME="Ubuntu 22.04.4 LTS"
+NAME="Ubuntu"
+VERSION_ID="22.04"
+VERSION="22.04.4 LTS (Jammy Jellyfish)"
+VERSION_CODENAME=jammy
+ID=ubuntu
+ID_LIKE=debian
+HOME_URL="https://www.ubuntu.com/"
+UBUNTU_CODENAME=jammy`,
+			want: defs.Config{
+				"distribution":               "Ubuntu",
+				"distribution_version":       "22.04",
+				"distribution_major_version": "22",
+				"distribution_release":       "jammy",
+				"os_family":                  "Debian",
+			},
+		},
+		{
+			name: "rocky",
+			osRelease: `NAME="Rocky Linux"
+VERSION="9.3 (Blue Onyx)"
+ID="rocky"
+ID_LIKE="rhel centos fedora"
+VERSION_ID="9.3"
+PLATFORM_ID="platform:el9"
+# A comment
+PRETTY_NAME='Rocky Linux 9.3 (Blue Onyx)'`,
+			want: defs.Config{
+				"distribution":               "Rocky",
+				"distribution_version":       "9.3",
+				"distribution_major_version": "9",
+				"distribution_release":       "",
+				"os_family":                  "RedHat",
+			},
+		},
+		{
+			name: "derivative",
+			osRelease: `NAME="Linux Mint"
+VERSION="21.3 (Virginia)"
+ID=linuxmint
+ID_LIKE="ubuntu debian"
+VERSION_ID="21.3"
+VERSION_CODENAME=virginia`,
+			want: defs.Config{
+				"distribution":               "Linux",
+				"distribution_version":       "21.3",
+				"distribution_major_version": "21",
+				"distribution_release":       "virginia",
+				"os_family":                  "Debian",
+			},
+		},
+		{
+			name:      "missing",
+			osRelease: "",
+			want: defs.Config{
+				"distribution":               "Darwin",
+				"distribution_version":       "",
+				"distribution_major_version": "",
+				"distribution_release":       "",
+				"os_family":                  "Darwin",
+			},
+		},
+	}
+	for _, test := range tests {
+		system := "Linux"
+		if test.osRelease == "" {
+			system = "Darwin"
+		}
+		facts := defs.Config{}
+		parseDistributionFacts(map[string]string{"os_release": test.osRelease, "system": system + "\n"}, facts)
+		if !reflect.DeepEqual(facts, test.want) {
+			t.Errorf("%s: facts = %v, want %v", test.name, facts, test.want)
+		}
+	}
+}
+
+func TestParseHardwareFacts(t *testing.T) {
+	sections := map[string]string{
+		"cpuinfo": `processor	: 0
+model name	: Intel(R) Xeon(R) CPU E5-2680 v4 @ 2.40GHz
+physical id	: 0
+cpu cores	: 2
+
+processor	: 1
+model name	: Intel(R) Xeon(R) CPU E5-2680 v4 @ 2.40GHz
+physical id	: 0
+cpu cores	: 2
+
+processor	: 2
+model name	: Intel(R) Xeon(R) CPU E5-2680 v4 @ 2.40GHz
+physical id	: 0
+cpu cores	: 2
+
+processor	: 3
+model name	: Intel(R) Xeon(R) CPU E5-2680 v4 @ 2.40GHz
+physical id	: 0
+cpu cores	: 2`,
+		"nproc": "2\n",
+		"meminfo": `MemTotal:        8048576 kB
+MemFree:         1048576 kB
+MemAvailable:    4194304 kB
+Buffers:          204800 kB
+SwapTotal:       2097152 kB
+SwapFree:        1048576 kB
+HugePages_Total:       0`,
+		"mounts": `/dev/sda1 / ext4 rw,relatime 0 0
+proc /proc proc rw,nosuid,nodev,noexec,relatime 0 0
+/dev/sdb1 /mnt/my\040data xfs rw,noatime 0 0`,
+		"df": `Filesystem     1024-blocks     Used Available Capacity Mounted on
+/dev/sda1         41152736 10485760  28570296      27% /
+/dev/sdb1          1048576   524288    524288      50% /mnt/my data`,
+	}
+	facts := defs.Config{}
+	parseHardwareFacts(sections, facts)
+	want := defs.Config{
+		"processor": []any{
+			"Intel(R) Xeon(R) CPU E5-2680 v4 @ 2.40GHz",
+			"Intel(R) Xeon(R) CPU E5-2680 v4 @ 2.40GHz",
+			"Intel(R) Xeon(R) CPU E5-2680 v4 @ 2.40GHz",
+			"Intel(R) Xeon(R) CPU E5-2680 v4 @ 2.40GHz",
+		},
+		"processor_vcpus":            4,
+		"processor_count":            1,
+		"processor_cores":            2,
+		"processor_threads_per_core": 2,
+		"processor_nproc":            2,
+		"memtotal_mb":                7859,
+		"memfree_mb":                 1024,
+		"swaptotal_mb":               2048,
+		"swapfree_mb":                1024,
+		"memory_mb": map[string]any{
+			"real":    map[string]any{"total": 7859, "free": 1024, "used": 6835},
+			"nocache": map[string]any{"free": 4096, "used": 3763},
+			"swap":    map[string]any{"total": 2048, "free": 1024, "used": 1024},
+		},
+		"mounts": []any{
+			map[string]any{
+				"mount":          "/",
+				"device":         "/dev/sda1",
+				"fstype":         "ext4",
+				"options":        "rw,relatime",
+				"size_total":     int64(41152736 * 1024),
+				"size_available": int64(28570296 * 1024),
+			},
+			map[string]any{
+				"mount":          "/mnt/my data",
+				"device":         "/dev/sdb1",
+				"fstype":         "xfs",
+				"options":        "rw,noatime",
+				"size_total":     int64(1048576 * 1024),
+				"size_available": int64(524288 * 1024),
+			},
+		},
+	}
+	for key, value := range want {
+		if !reflect.DeepEqual(facts[key], value) {
+			t.Errorf("%s = %#v, want %#v", key, facts[key], value)
+		}
+	}
+}
+
+func TestParseNetworkFacts(t *testing.T) {
+	sections := map[string]string{
+		"links": `lo|00:00:00:00:00:00|65536|unknown
+eth0|52:54:00:12:34:56|1500|up
+br-lan|52:54:00:ab:cd:ef|1500|down`,
+		"addresses": `1: lo    inet 127.0.0.1/8 scope host lo\       valid_lft forever preferred_lft forever
+1: lo    inet6 ::1/128 scope host \       valid_lft forever preferred_lft forever
+2: eth0    inet 10.0.0.2/24 brd 10.0.0.255 scope global eth0\       valid_lft forever preferred_lft forever
+2: eth0    inet 10.0.0.3/24 brd 10.0.0.255 scope global secondary eth0\       valid_lft forever preferred_lft forever
+2: eth0    inet6 fe80::5054:ff:fe12:3456/64 scope link \       valid_lft forever preferred_lft forever
+3: br-lan    inet 192.168.1.1/24 scope global br-lan\       valid_lft forever preferred_lft forever`,
+		"route": `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth0	00000000	0100000A	0003	0	0	100	00000000	0	0	0
+eth0	0000000A	00000000	0001	0	0	100	00FFFFFF	0	0	0`,
+	}
+	facts := defs.Config{}
+	parseNetworkFacts(sections, facts)
+	eth0IPv4 := map[string]any{
+		"address":   "10.0.0.2",
+		"netmask":   "255.255.255.0",
+		"network":   "10.0.0.0",
+		"prefix":    "24",
+		"broadcast": "10.0.0.255",
+	}
+	want := defs.Config{
+		"interfaces":         []any{"lo", "eth0", "br-lan"},
+		"all_ipv4_addresses": []any{"10.0.0.2", "10.0.0.3", "192.168.1.1"},
+		"all_ipv6_addresses": []any{"fe80::5054:ff:fe12:3456"},
+		"lo": map[string]any{
+			"device":     "lo",
+			"macaddress": "00:00:00:00:00:00",
+			"mtu":        65536,
+			"active":     true,
+			"ipv4":       map[string]any{"address": "127.0.0.1", "netmask": "255.0.0.0", "network": "127.0.0.0", "prefix": "8"},
+			"ipv6":       []any{map[string]any{"address": "::1", "prefix": "128", "scope": "host"}},
+		},
+		"eth0": map[string]any{
+			"device":     "eth0",
+			"macaddress": "52:54:00:12:34:56",
+			"mtu":        1500,
+			"active":     true,
+			"ipv4":       eth0IPv4,
+			"ipv4_secondaries": []any{map[string]any{
+				"address":   "10.0.0.3",
+				"netmask":   "255.255.255.0",
+				"network":   "10.0.0.0",
+				"prefix":    "24",
+				"broadcast": "10.0.0.255",
+			}},
+			"ipv6": []any{map[string]any{"address": "fe80::5054:ff:fe12:3456", "prefix": "64", "scope": "link"}},
+		},
+		"br_lan": map[string]any{
+			"device":     "br-lan",
+			"macaddress": "52:54:00:ab:cd:ef",
+			"mtu":        1500,
+			"active":     false,
+			"ipv4":       map[string]any{"address": "192.168.1.1", "netmask": "255.255.255.0", "network": "192.168.1.0", "prefix": "24"},
+			"ipv6":       []any{},
+		},
+		"default_ipv4": map[string]any{
+			"interface":  "eth0",
+			"gateway":    "10.0.0.1",
+			"macaddress": "52:54:00:12:34:56",
+			"mtu":        1500,
+			"address":    "10.0.0.2",
+			"netmask":    "255.255.255.0",
+			"network":    "10.0.0.0",
+			"prefix":     "24",
+			"broadcast":  "10.0.0.255",
+		},
+	}
+	if !reflect.DeepEqual(facts, want) {
+		t.Errorf("facts = %#v, want %#v", facts, want)
+	}
+}
+
+func TestParseGoFacts(t *testing.T) {
+	tests := []struct {
+		output string
+		want   defs.Config
+	}{
+		{"go1.22.12\nlinux\narm64\n", defs.Config{"go": map[string]any{"version": "go1.22.12", "os": "linux", "arch": "arm64"}}},
+		{"", defs.Config{}},
+		{"sh: go: not found\n", defs.Config{}},
+	}
+	for _, test := range tests {
+		facts := defs.Config{}
+		parseGoFacts(map[string]string{"go": test.output}, facts)
+		if !reflect.DeepEqual(facts, test.want) {
+			t.Errorf("parseGoFacts(%q) = %v, want %v", test.output, facts, test.want)
+		}
+	}
+}
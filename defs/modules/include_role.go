@@ -0,0 +1,89 @@
+package modules
+
+import (
+	"context"
+	"goparse/defs"
+)
+
+func init() {
+	defs.MustRegisterTask(&IncludeRole{})
+	defs.MustRegisterTask(&ImportRole{})
+}
+
+type IncludeRole struct {
+	Role         string    `json:"name"`
+	TasksFrom    string    `json:"tasks_from"`
+	VarsFrom     string    `json:"vars_from"`
+	DefaultsFrom string    `json:"defaults_from"`
+	Public       defs.Bool `json:"public"`
+	taskVars     defs.Config
+}
+
+// ImportRole is the same as IncludeRole as there is no static import.
+type ImportRole struct {
+	IncludeRole
+}
+
+func (task *IncludeRole) Name() string {
+	return "include_role"
+}
+
+func (task *ImportRole) Name() string {
+	return "import_role"
+}
+
+func (task *IncludeRole) Init(yamlElement *defs.YamlElement) error {
+	task.taskVars = yamlElement.Variables()
+	return yamlElement.ReadTaskConfig(task)
+}
+
+func (task *IncludeRole) Run(ctx context.Context, executor defs.PlaybookExecutor) (defs.Output, error) {
+	role, err := executor.FindRole(task.Role)
+	if err != nil {
+		return nil, err
+	}
+	tasksFrom := task.TasksFrom
+	if tasksFrom == "" {
+		tasksFrom = "main"
+	}
+	tasksFile, err := role.File("tasks", tasksFrom)
+	if err != nil {
+		return nil, err
+	}
+	defaults, err := role.ReadVars("defaults", task.DefaultsFrom)
+	if err != nil {
+		return nil, err
+	}
+	vars, err := role.ReadVars("vars", task.VarsFrom)
+	if err != nil {
+		return nil, err
+	}
+	// Defaults have the lowest precedence, then the role vars, the vars passed to the task
+	// and the extra vars which are never overridden.
+	roleConfig := defs.Config{}
+	currentConfig := executor.CurrentConfig()
+	extraVars := executor.ExtraVars()
+	for key, value := range defaults {
+		if _, ok := currentConfig[key]; !ok {
+			roleConfig[key] = value
+		}
+	}
+	for key, value := range vars {
+		if _, ok := task.taskVars[key]; !ok {
+			roleConfig[key] = value
+		}
+	}
+	for key := range extraVars {
+		delete(roleConfig, key)
+	}
+	if task.Public {
+		err = executor.ApplyConfig(roleConfig)
+		if err != nil {
+			return nil, err
+		}
+		return nil, executor.ExecuteFile(ctx, tasksFile)
+	}
+	return nil, executor.ApplyScopedConfig(roleConfig, func() error {
+		return executor.ExecuteFile(ctx, tasksFile)
+	})
+}
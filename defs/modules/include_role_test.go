@@ -0,0 +1,136 @@
+package modules_test
+
+import (
+	"context"
+	"goparse/runtime"
+	"os"
+	fp "path/filepath"
+	"testing"
+)
+
+// roleFiles are the files of the role r. Each task file records the role vars and defaults it sees.
+var roleFiles = map[string]string{
+	"roles/r/tasks/main.yml":    "- set_fact:\n    seen_main: \"{{ rv }}-{{ rd }}\"\n",
+	"roles/r/tasks/other.yml":   "- set_fact:\n    seen_other: \"{{ rv }}-{{ rd }}\"\n",
+	"roles/r/vars/main.yml":     "rv: fromvars\n",
+	"roles/r/vars/alt.yml":      "rv: fromalt\n",
+	"roles/r/defaults/main.yml": "rd: default\n",
+	"roles/r/defaults/alt.yaml": "rd: altdefault\n",
+}
+
+// executeRoleTasks runs the tasks next to the role r and returns the variables after them.
+func executeRoleTasks(t *testing.T, tasks string, extraVars map[string]any) map[string]any {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{"tasks.yaml": tasks}
+	for name, content := range roleFiles {
+		files[name] = content
+	}
+	for name, content := range files {
+		path := fp.Join(dir, name)
+		err := os.MkdirAll(fp.Dir(path), 0755)
+		if err == nil {
+			err = os.WriteFile(path, []byte(content), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	pe := runtime.NewPlaybookExecutor(&runtime.PlaybookConfig{YamlDir: dir, ExtraVars: extraVars})
+	err := pe.ExecuteFile(context.Background(), "tasks.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pe.CurrentConfig()
+}
+
+func TestIncludeRoleFiles(t *testing.T) {
+	vars := executeRoleTasks(t, `
+- include_role:
+    name: r
+- include_role:
+    name: r
+    tasks_from: other
+    vars_from: alt
+    defaults_from: alt
+`, nil)
+	if vars["seen_main"] != "fromvars-default" {
+		t.Errorf("main tasks saw %v, want fromvars-default", vars["seen_main"])
+	}
+	if vars["seen_other"] != "fromalt-altdefault" {
+		t.Errorf("other tasks saw %v, want fromalt-altdefault", vars["seen_other"])
+	}
+}
+
+func TestIncludeRoleMissingFile(t *testing.T) {
+	dir := t.TempDir()
+	err := os.MkdirAll(fp.Join(dir, "roles/r/tasks"), 0755)
+	if err == nil {
+		err = os.WriteFile(fp.Join(dir, "tasks.yaml"), []byte("- include_role:\n    name: r\n    tasks_from: missing\n"), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	pe := runtime.NewPlaybookExecutor(&runtime.PlaybookConfig{YamlDir: dir})
+	if err := pe.ExecuteFile(context.Background(), "tasks.yaml"); err == nil {
+		t.Errorf("include_role with a missing tasks file succeeded")
+	}
+}
+
+func TestIncludeRolePrecedence(t *testing.T) {
+	tests := []struct {
+		name      string
+		tasks     string
+		extraVars map[string]any
+		want      string
+	}{
+		{"role vars override the variables", `
+- set_fact:
+    rv: fact
+    rd: fact
+- include_role:
+    name: r
+`, nil, "fromvars-fact"},
+		{"task vars override the role vars", `
+- include_role:
+    name: r
+  vars:
+    rv: task
+    rd: task
+`, nil, "task-task"},
+		{"extra vars override the role vars", `
+- include_role:
+    name: r
+`, map[string]any{"rv": "EXTRA", "rd": "EXTRA"}, "EXTRA-EXTRA"},
+		{"extra vars override the public role vars", `
+- include_role:
+    name: r
+    public: yes
+`, map[string]any{"rv": "EXTRA"}, "EXTRA-default"},
+	}
+	for _, test := range tests {
+		vars := executeRoleTasks(t, test.tasks, test.extraVars)
+		if vars["seen_main"] != test.want {
+			t.Errorf("%s: role saw %v, want %s", test.name, vars["seen_main"], test.want)
+		}
+		if rv, ok := test.extraVars["rv"]; ok && vars["rv"] != rv {
+			t.Errorf("%s: rv = %v after the role, want %v", test.name, vars["rv"], rv)
+		}
+	}
+}
+
+func TestIncludeRoleScope(t *testing.T) {
+	private := executeRoleTasks(t, "- include_role:\n    name: r\n", nil)
+	for _, key := range []string{"rv", "rd"} {
+		if value, ok := private[key]; ok {
+			t.Errorf("%s = %v after a private role", key, value)
+		}
+	}
+	if private["seen_main"] != "fromvars-default" {
+		t.Errorf("facts set by a private role = %v, want kept", private["seen_main"])
+	}
+	public := executeRoleTasks(t, "- include_role:\n    name: r\n    public: yes\n", nil)
+	if public["rv"] != "fromvars" || public["rd"] != "default" {
+		t.Errorf("rv, rd = %v, %v after a public role, want fromvars, default", public["rv"], public["rd"])
+	}
+}
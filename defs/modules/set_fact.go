@@ -2,6 +2,8 @@ package modules
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"goparse/defs"
 )
 
@@ -11,6 +13,8 @@ func init() {
 
 type SetFact struct {
 	Config defs.Config
+	// Cacheable also stores the facts in the fact cache.
+	Cacheable defs.Bool
 }
 
 func (task *SetFact) Name() string {
@@ -18,11 +22,33 @@ func (task *SetFact) Name() string {
 }
 
 func (task *SetFact) Init(yamlElement *defs.YamlElement) error {
-	task.Config = make(defs.Config)
-	return yamlElement.ReadTaskConfig(&task.Config)
+	if yamlElement.Task == nil {
+		return errors.New("Task is nil")
+	}
+	// The config is not converted through JSON to keep the native types of the values.
+	task.Config = make(defs.Config, len(yamlElement.Task.Config))
+	for key, value := range yamlElement.Task.Config {
+		if key == "cacheable" {
+			// The value is converted through JSON to accept the YAML style booleans.
+			data, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			err = json.Unmarshal(data, &task.Cacheable)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		task.Config[key] = value
+	}
+	return nil
 }
 
 func (task *SetFact) Run(ctx context.Context, executor defs.PlaybookExecutor) (defs.Output, error) {
 	err := executor.ApplyConfig(task.Config)
-	return nil, err
+	if err != nil || !task.Cacheable {
+		return nil, err
+	}
+	return nil, executor.CacheFacts(task.Config)
 }
@@ -0,0 +1,260 @@
+package modules
+
+import (
+	"context"
+	"fmt"
+	"goparse/defs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultGatherTimeout is the number of seconds to wait for the facts if gather_timeout is not set.
+	DefaultGatherTimeout = 10
+)
+
+func init() {
+	defs.MustRegisterTask(&Setup{})
+	defs.MustRegisterTask(&GatherFacts{})
+}
+
+// Setup gathers the facts of the host and sets them as ansible_facts and the ansible_ prefixed variables.
+type Setup struct {
+	// GatherSubset is a list or a comma separated string of the subsets like all, min, hardware
+	// and network. A subset prefixed with ! is excluded. The min subsets are always gathered
+	// unless they are excluded.
+	GatherSubset any `json:"gather_subset"`
+	// GatherTimeout is the number of seconds to wait for the facts.
+	GatherTimeout int `json:"gather_timeout"`
+	// Filter is a list or a comma separated string of the glob patterns of the ansible_ prefixed fact names.
+	// The filtered facts are not cached.
+	Filter any `json:"filter"`
+	// Cached uses the cached facts instead of gathering them if they were gathered with the subsets.
+	// It is set for the implicit gathering of the plays if the gathering is smart.
+	Cached  bool `json:"cached"`
+	subsets []string
+	filters []string
+}
+
+// GatherFacts is the setup module by the name gather_facts.
+type GatherFacts struct {
+	Setup
+}
+
+func (task *Setup) Name() string {
+	return "setup"
+}
+
+func (task *GatherFacts) Name() string {
+	return "gather_facts"
+}
+
+func (task *Setup) Init(yamlElement *defs.YamlElement) error {
+	err := yamlElement.ReadTaskConfig(task)
+	if err != nil {
+		return err
+	}
+	subsets, err := stringList(task.GatherSubset)
+	if err != nil {
+		return err
+	}
+	task.subsets, err = factSubsets(subsets)
+	if err != nil {
+		return err
+	}
+	task.filters, err = stringList(task.Filter)
+	return err
+}
+
+func (task *Setup) Run(ctx context.Context, executor defs.PlaybookExecutor) (defs.Output, error) {
+	vars, err := task.facts(ctx, executor)
+	if err != nil {
+		return nil, err
+	}
+	facts := map[string]any{}
+	for key, value := range vars {
+		facts[strings.TrimPrefix(key, "ansible_")] = value
+	}
+	allFacts := map[string]any{}
+	switch existing := executor.CurrentConfig()["ansible_facts"].(type) {
+	case map[string]any:
+		for key, value := range existing {
+			allFacts[key] = value
+		}
+	case defs.Config:
+		for key, value := range existing {
+			allFacts[key] = value
+		}
+	}
+	for key, value := range facts {
+		allFacts[key] = value
+	}
+	vars["ansible_facts"] = allFacts
+	err = executor.ApplyConfig(vars)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"ansible_facts": facts, "changed": false}, nil
+}
+
+// facts returns the facts prefixed with ansible_. They are cached unless they are filtered.
+func (task *Setup) facts(ctx context.Context, executor defs.PlaybookExecutor) (defs.Config, error) {
+	if task.Cached && len(task.filters) == 0 {
+		// The cached facts may also have the cacheable facts set by set_fact,
+		// so module_setup tells that the facts were gathered.
+		vars, ok, err := executor.CachedFacts()
+		if err != nil {
+			return nil, err
+		}
+		if ok && vars["module_setup"] == true && coversSubsets(vars["ansible_gather_subset"], task.subsets) {
+			return vars, nil
+		}
+	}
+	facts, err := task.gather(ctx, executor)
+	if err != nil {
+		return nil, err
+	}
+	vars := defs.Config{}
+	if len(task.filters) > 0 {
+		for key, value := range facts {
+			for _, filter := range task.filters {
+				if ok, _ := path.Match(filter, "ansible_"+key); ok {
+					vars["ansible_"+key] = value
+					break
+				}
+			}
+		}
+		return vars, nil
+	}
+	subsets := []any{}
+	for _, name := range task.subsets {
+		subsets = append(subsets, name)
+	}
+	vars["module_setup"] = true
+	vars["ansible_gather_subset"] = subsets
+	for key, value := range facts {
+		vars["ansible_"+key] = value
+	}
+	err = executor.CacheFacts(vars)
+	if err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+// coversSubsets returns true if the cached gather_subset has all the subsets.
+func coversSubsets(cached any, subsets []string) bool {
+	list, _ := cached.([]any)
+	names := map[string]bool{}
+	for _, name := range list {
+		names[fmt.Sprint(name)] = true
+	}
+	for _, name := range subsets {
+		if !names[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// gather runs the collectors of the subsets on the host. The facts are not prefixed with ansible_.
+func (task *Setup) gather(ctx context.Context, executor defs.PlaybookExecutor) (defs.Config, error) {
+	conn, err := executor.Connection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	timeout := task.GatherTimeout
+	if timeout <= 0 {
+		timeout = DefaultGatherTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+	result, err := conn.Exec(ctx, factScript(task.subsets), defs.ExecOptions{Executable: "/bin/sh"})
+	if err != nil {
+		return nil, fmt.Errorf("Gathering facts failed: %w", err)
+	}
+	sections := parseFactSections(result.Stdout)
+	facts := defs.Config{}
+	for _, name := range task.subsets {
+		factCollectors[name].parse(sections[name], facts)
+	}
+	return facts, nil
+}
+
+// factSubsets returns the names of the collectors of the gather_subset values.
+// All the subsets are gathered unless !all or the subsets to include are set.
+func factSubsets(subsets []string) ([]string, error) {
+	included := map[string]bool{}
+	excluded := map[string]bool{}
+	excludeAll := false
+	for _, subset := range subsets {
+		name, exclude := strings.CutPrefix(subset, "!")
+		names := []string{name}
+		switch name {
+		case "all":
+			if exclude {
+				// The min subsets are excluded only by !min.
+				excludeAll = true
+				continue
+			}
+			names = []string{}
+			for collector := range factCollectors {
+				names = append(names, collector)
+			}
+		case "min":
+			names = minFactSubsets
+		default:
+			if _, ok := factCollectors[name]; !ok {
+				return nil, fmt.Errorf("Gather subset %s is not supported", subset)
+			}
+		}
+		for _, name := range names {
+			if exclude {
+				excluded[name] = true
+			} else {
+				included[name] = true
+			}
+		}
+	}
+	if len(included) == 0 && !excludeAll {
+		for name := range factCollectors {
+			included[name] = true
+		}
+	}
+	for _, name := range minFactSubsets {
+		included[name] = true
+	}
+	result := []string{}
+	for name := range included {
+		if !excluded[name] {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// stringList returns the strings of a list or a comma separated string.
+func stringList(value any) ([]string, error) {
+	var list []string
+	switch v := value.(type) {
+	case nil:
+	case string:
+		list = strings.Split(v, ",")
+	case []any:
+		for _, item := range v {
+			list = append(list, fmt.Sprint(item))
+		}
+	default:
+		return nil, fmt.Errorf("List or string is expected, but found %T", value)
+	}
+	result := []string{}
+	for _, item := range list {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"goparse/defs"
-	"os/exec"
 )
 
 func init() {
@@ -12,7 +11,10 @@ func init() {
 }
 
 type Shell struct {
-	Command string `json:"cmd"`
+	Command    string `json:"cmd"`
+	Chdir      string `json:"chdir"`
+	Executable string `json:"executable"`
+	env        defs.StrConfig
 }
 
 func (task *Shell) Name() string {
@@ -20,16 +22,28 @@ func (task *Shell) Name() string {
 }
 
 func (task *Shell) Init(yamlElement *defs.YamlElement) error {
-	fmt.Printf("\nEnvironment: %+v\n", yamlElement.Environment())
+	task.env = yamlElement.Environment()
+	fmt.Printf("\nEnvironment: %+v\n", task.env)
 	return yamlElement.ReadTaskConfig(task)
 }
 
 func (task *Shell) Run(ctx context.Context, executor defs.PlaybookExecutor) (defs.Output, error) {
-	cmd := exec.Command("/bin/bash", "-c", task.Command)
-	output, err := cmd.Output()
+	conn, err := executor.Connection(ctx)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println(string(output))
-	return string(output), nil
+	executable := task.Executable
+	if executable == "" {
+		executable = "/bin/bash"
+	}
+	result, err := conn.Exec(ctx, task.Command, defs.ExecOptions{Executable: executable, Dir: task.Chdir, Env: task.env})
+	if err != nil {
+		if result != nil {
+			// The exit code is available from the wrapped defs.ExitError.
+			return result.Stdout, err
+		}
+		return nil, err
+	}
+	fmt.Println(result.Stdout)
+	return result.Stdout, nil
 }
@@ -4,8 +4,6 @@ import (
 	"context"
 	"goparse/defs"
 	"os"
-
-	"github.com/noirbizarre/gonja"
 )
 
 func init() {
@@ -27,17 +25,18 @@ func (task *Template) Init(yamlElement *defs.YamlElement) error {
 }
 
 func (task *Template) Run(ctx context.Context, executor defs.PlaybookExecutor) (defs.Output, error) {
-	tpl, err := gonja.FromFile(task.Src)
+	output, err := defs.RenderTemplateFile(task.Src, executor.CurrentConfig(), executor.TemplateOptions())
 	if err != nil {
 		return nil, err
 	}
-	output, err := tpl.Execute(executor.CurrentConfig())
+	// The template is rendered on the controller and written to the host.
+	conn, err := executor.Connection(ctx)
 	if err != nil {
 		return nil, err
 	}
-	err = os.WriteFile(task.Dest, []byte(output), os.FileMode(task.Mod))
+	err = conn.Put(ctx, []byte(output), task.Dest, os.FileMode(task.Mod))
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	return string(output), nil
 }
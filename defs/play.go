@@ -0,0 +1,181 @@
+package defs
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// YamlPlay represents a play in a playbook file which runs the tasks on the hosts.
+type YamlPlay struct {
+	Name string
+	// Hosts is the host pattern. A list of patterns is joined with commas.
+	Hosts string
+	// Strategy is linear or free. The default strategy is used if it is empty.
+	Strategy string
+	// Serial is the sizes of the batches of the hosts in which the play runs. A size is a number
+	// or a percentage of the hosts like 30%. The last size is repeated for the remaining hosts.
+	Serial []string
+	// MaxFailPercentage stops the play when more than the percentage of the hosts in a batch fail.
+	MaxFailPercentage *float64
+	// AnyErrorsFatal stops the play when any host fails.
+	AnyErrorsFatal bool
+	// GatherFacts runs the setup module on the hosts before the tasks. The gathering config decides if it is not set.
+	GatherFacts *bool
+	// GatherSubset is the gather_subset of the setup module gathering the facts.
+	GatherSubset []string
+	// Become is the become keywords inherited by the tasks.
+	Become BecomeKeywords
+	Vars   Config
+	Tasks  YamlElements
+	Pos    Position
+}
+
+type YamlPlays []*YamlPlay
+
+func (yamlPlays *YamlPlays) UnmarshalYAML(value *yaml.Node) error {
+	if value == nil {
+		return nil
+	}
+	if value.Kind != yaml.SequenceNode {
+		return newParseError(value, fmt.Errorf("Sequence node is expected, but found %v", value.Kind))
+	}
+	for _, node := range value.Content {
+		yamlPlay := &YamlPlay{}
+		err := node.Decode(yamlPlay)
+		if err != nil {
+			return newParseError(node, err)
+		}
+		*yamlPlays = append(*yamlPlays, yamlPlay)
+	}
+	return nil
+}
+
+func (yamlPlay *YamlPlay) UnmarshalYAML(value *yaml.Node) error {
+	if value == nil {
+		return nil
+	}
+	yamlPlay.Pos = NodePosition(value)
+	if value.Kind != yaml.MappingNode {
+		return newParseError(value, fmt.Errorf("Mapping node is expected, but found %v", value.Kind))
+	}
+	// The become keywords are parsed like those of a task.
+	becomeElement := &YamlElement{}
+	for i := 0; i < len(value.Content); i += 2 {
+		key := value.Content[i]
+		val := value.Content[i+1]
+		var strKey string
+		err := key.Decode(&strKey)
+		if err != nil {
+			return newParseError(key, err)
+		}
+		switch strKey {
+		case "name":
+			err = val.Decode(&yamlPlay.Name)
+		case "hosts":
+			err = parseHostPattern(val, yamlPlay)
+		case "strategy":
+			err = val.Decode(&yamlPlay.Strategy)
+		case "serial":
+			err = parseSerial(val, yamlPlay)
+		case "max_fail_percentage":
+			var v float64
+			err = val.Decode(&v)
+			yamlPlay.MaxFailPercentage = &v
+		case "any_errors_fatal":
+			err = val.Decode(&yamlPlay.AnyErrorsFatal)
+		case "gather_facts":
+			var v bool
+			err = val.Decode(&v)
+			yamlPlay.GatherFacts = &v
+		case "gather_subset":
+			err = parseGatherSubset(val, yamlPlay)
+		case "become", "become_user", "become_method", "become_flags":
+			err = yamlElementFieldParsers[strKey](strKey, val, becomeElement)
+		case "vars":
+			yamlPlay.Vars = Config{}
+			err = val.Decode(&yamlPlay.Vars)
+		case "tasks":
+			err = val.Decode(&yamlPlay.Tasks)
+		default:
+			return newParseError(key, fmt.Errorf("Unknown play field %s", strKey))
+		}
+		if err != nil {
+			return newParseError(val, err)
+		}
+	}
+	if yamlPlay.Hosts == "" {
+		return newParseError(value, errors.New("Play must have hosts"))
+	}
+	yamlPlay.Become = becomeElement.BecomeKeywords()
+	return nil
+}
+
+func parseHostPattern(node *yaml.Node, yamlPlay *YamlPlay) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return node.Decode(&yamlPlay.Hosts)
+	case yaml.SequenceNode:
+		v := []string{}
+		err := node.Decode(&v)
+		if err != nil {
+			return err
+		}
+		yamlPlay.Hosts = strings.Join(v, ",")
+		return nil
+	}
+	return fmt.Errorf("Unsupported node kind %v", node.Kind)
+}
+
+func parseSerial(node *yaml.Node, yamlPlay *YamlPlay) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		yamlPlay.Serial = []string{node.Value}
+	case yaml.SequenceNode:
+		err := node.Decode(&yamlPlay.Serial)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("Unsupported node kind %v", node.Kind)
+	}
+	for _, size := range yamlPlay.Serial {
+		_, _, err := ParseBatchSize(size)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseGatherSubset(node *yaml.Node, yamlPlay *YamlPlay) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		yamlPlay.GatherSubset = strings.Split(node.Value, ",")
+		return nil
+	case yaml.SequenceNode:
+		return node.Decode(&yamlPlay.GatherSubset)
+	}
+	return fmt.Errorf("Unsupported node kind %v", node.Kind)
+}
+
+// ParseBatchSize parses a serial batch size which is a number or a percentage like 30%.
+func ParseBatchSize(size string) (float64, bool, error) {
+	str, percent := strings.CutSuffix(strings.TrimSpace(size), "%")
+	value, err := strconv.ParseFloat(str, 64)
+	if err != nil || value < 0 || (!percent && value != float64(int(value))) {
+		return 0, false, fmt.Errorf("Invalid serial batch size %s", size)
+	}
+	return value, percent, nil
+}
+
+// SetFile sets the source file in the position of the play and its tasks.
+func (yamlPlay *YamlPlay) SetFile(file string) {
+	yamlPlay.Pos.File = file
+	for _, task := range yamlPlay.Tasks {
+		task.SetFile(file)
+	}
+}
@@ -1,9 +1,13 @@
 package defs
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"gopkg.in/yaml.v3"
@@ -11,6 +15,10 @@ import (
 
 var (
 	yamlElementFieldParsers = map[string]YamlConfigFieldParser{}
+	// Lookups supported by the with_<lookup> loops.
+	loopLookups = []string{"items", "list", "dict", "nested", "subelements", "sequence", "fileglob"}
+	// yamlErrorLine matches the line of a YAML syntax error which has no node.
+	yamlErrorLine = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
 )
 
 func init() {
@@ -39,9 +47,6 @@ func registerYamlElementFieldParsers() {
 		return nil
 	}
 	yamlElementFieldParsers["when"] = func(name string, node *yaml.Node, yamlElement *YamlElement) error {
-		fn := func(cond string) string {
-			return fmt.Sprintf("{%% if %s %%}true{%% else %%}false{%% endif %%}", cond)
-		}
 		switch node.Kind {
 		case yaml.SequenceNode:
 			v := []string{}
@@ -49,19 +54,14 @@ func registerYamlElementFieldParsers() {
 			if err != nil {
 				return err
 			}
-			yamlElement.When = make([]string, len(v))
-			for i, cond := range v {
-				yamlElement.When[i] = fn(cond)
-			}
+			yamlElement.When = v
 		case yaml.ScalarNode:
 			var v string
 			err := node.Decode(&v)
 			if err != nil {
 				return err
 			}
-			yamlElement.When = []string{
-				fn(v),
-			}
+			yamlElement.When = []string{v}
 		default:
 			return fmt.Errorf("Unsupported node kind %v", node.Kind)
 		}
@@ -77,12 +77,40 @@ func registerYamlElementFieldParsers() {
 		return nil
 	}
 	yamlElementFieldParsers["loop"] = func(name string, node *yaml.Node, yamlElement *YamlElement) error {
-		yamlLoop := YamlLoop{}
-		err := node.Decode(&yamlLoop)
+		return parseLoop(node, "", yamlElement)
+	}
+	yamlElementFieldParsers["loop_control"] = func(name string, node *yaml.Node, yamlElement *YamlElement) error {
+		v := Config{}
+		err := node.Decode(&v)
+		if err != nil {
+			return err
+		}
+		// The values are converted through JSON to accept the YAML style booleans.
+		data, err := json.Marshal(v)
 		if err != nil {
 			return err
 		}
-		yamlElement.Loop = &yamlLoop
+		loopControl := YamlLoopControl{}
+		err = json.Unmarshal(data, &loopControl)
+		if err != nil {
+			return err
+		}
+		yamlElement.LoopControl = &loopControl
+		return nil
+	}
+	for _, lookup := range loopLookups {
+		lookup := lookup
+		yamlElementFieldParsers["with_"+lookup] = func(name string, node *yaml.Node, yamlElement *YamlElement) error {
+			return parseLoop(node, lookup, yamlElement)
+		}
+	}
+	yamlElementFieldParsers["vars"] = func(name string, node *yaml.Node, yamlElement *YamlElement) error {
+		v := Config{}
+		err := node.Decode(&v)
+		if err != nil {
+			return err
+		}
+		yamlElement.Vars = v
 		return nil
 	}
 	yamlElementFieldParsers["ignore_errors"] = func(name string, node *yaml.Node, yamlElement *YamlElement) error {
@@ -94,6 +122,80 @@ func registerYamlElementFieldParsers() {
 		yamlElement.IgnoreErrors = v
 		return nil
 	}
+	yamlElementFieldParsers["become"] = func(name string, node *yaml.Node, yamlElement *YamlElement) error {
+		var v any
+		err := node.Decode(&v)
+		if err != nil {
+			return err
+		}
+		// The value is converted through JSON to accept the YAML style booleans.
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		var become Bool
+		err = json.Unmarshal(data, &become)
+		if err != nil {
+			return err
+		}
+		yamlElement.Become = &become
+		return nil
+	}
+	yamlElementFieldParsers["become_user"] = func(name string, node *yaml.Node, yamlElement *YamlElement) error {
+		var v string
+		err := node.Decode(&v)
+		if err != nil {
+			return err
+		}
+		yamlElement.BecomeUser = &v
+		return nil
+	}
+	yamlElementFieldParsers["become_method"] = func(name string, node *yaml.Node, yamlElement *YamlElement) error {
+		var v string
+		err := node.Decode(&v)
+		if err != nil {
+			return err
+		}
+		yamlElement.BecomeMethod = &v
+		return nil
+	}
+	yamlElementFieldParsers["become_flags"] = func(name string, node *yaml.Node, yamlElement *YamlElement) error {
+		var v string
+		err := node.Decode(&v)
+		if err != nil {
+			return err
+		}
+		yamlElement.BecomeFlags = &v
+		return nil
+	}
+	yamlElementFieldParsers["delegate_to"] = func(name string, node *yaml.Node, yamlElement *YamlElement) error {
+		var v string
+		err := node.Decode(&v)
+		if err != nil {
+			return err
+		}
+		yamlElement.DelegateTo = &v
+		return nil
+	}
+	yamlElementFieldParsers["run_once"] = func(name string, node *yaml.Node, yamlElement *YamlElement) error {
+		var v any
+		err := node.Decode(&v)
+		if err != nil {
+			return err
+		}
+		// The value is converted through JSON to accept the YAML style booleans.
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		var runOnce Bool
+		err = json.Unmarshal(data, &runOnce)
+		if err != nil {
+			return err
+		}
+		yamlElement.RunOnce = &runOnce
+		return nil
+	}
 	yamlElementFieldParsers["block"] = func(name string, node *yaml.Node, yamlElement *YamlElement) error {
 		yamlElements := YamlElements{}
 		err := node.Decode(&yamlElements)
@@ -108,19 +210,96 @@ func registerYamlElementFieldParsers() {
 	}
 }
 
+// parseLoop parses the loop keyword if the lookup is empty. Otherwise, it parses the with_<lookup> keyword.
+func parseLoop(node *yaml.Node, lookup string, yamlElement *YamlElement) error {
+	if yamlElement.Loop != nil {
+		return errors.New("Loop is already configured")
+	}
+	yamlLoop := YamlLoop{Lookup: lookup}
+	switch node.Kind {
+	case yaml.ScalarNode:
+		var v string
+		err := node.Decode(&v)
+		if err != nil {
+			return err
+		}
+		yamlLoop.Var = &v
+	case yaml.SequenceNode:
+		v := []any{}
+		err := node.Decode(&v)
+		if err != nil {
+			return err
+		}
+		yamlLoop.Items = v
+	case yaml.MappingNode:
+		if lookup == "" {
+			// The loop is in the form of {var: ..., items: [...]}.
+			err := node.Decode(&yamlLoop)
+			if err != nil {
+				return err
+			}
+			break
+		}
+		// The dictionary is the only term of the lookup.
+		v := map[string]any{}
+		err := node.Decode(&v)
+		if err != nil {
+			return err
+		}
+		yamlLoop.Items = []any{v}
+	default:
+		return fmt.Errorf("Unsupported node kind %v", node.Kind)
+	}
+	yamlElement.Loop = &yamlLoop
+	return nil
+}
+
 type Processor struct {
 	yamlElements YamlElements
+	yamlPlays    YamlPlays
 }
 
 func NewProcessor() *Processor {
-	return &Processor{yamlElements: YamlElements{}}
+	return &Processor{yamlElements: YamlElements{}, yamlPlays: YamlPlays{}}
 }
 
 func (processor *Processor) YamlConfigs() YamlElements {
 	return processor.yamlElements
 }
 
+// YamlPlays returns the plays parsed by ParsePlaybook.
+func (processor *Processor) YamlPlays() YamlPlays {
+	return processor.yamlPlays
+}
+
 func (processor *Processor) ParseYaml(filepath string) error {
+	yamlElements := YamlElements{}
+	err := processor.parseFile(filepath, &yamlElements)
+	if err != nil {
+		return err
+	}
+	for _, yamlElement := range yamlElements {
+		yamlElement.SetFile(filepath)
+	}
+	processor.yamlElements = yamlElements
+	return nil
+}
+
+// ParsePlaybook parses the playbook file which is a list of plays.
+func (processor *Processor) ParsePlaybook(filepath string) error {
+	yamlPlays := YamlPlays{}
+	err := processor.parseFile(filepath, &yamlPlays)
+	if err != nil {
+		return err
+	}
+	for _, yamlPlay := range yamlPlays {
+		yamlPlay.SetFile(filepath)
+	}
+	processor.yamlPlays = yamlPlays
+	return nil
+}
+
+func (processor *Processor) parseFile(filepath string, out any) error {
 	data, err := os.ReadFile(filepath)
 	if err != nil {
 		return err
@@ -129,12 +308,20 @@ func (processor *Processor) ParseYaml(filepath string) error {
 	if err != nil {
 		return err
 	}
-	yamlElements := YamlElements{}
-	err = yaml.Unmarshal([]byte(data), &yamlElements)
+	err = yaml.Unmarshal([]byte(data), out)
 	if err != nil {
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			parseErr = &ParseError{Err: err}
+			if match := yamlErrorLine.FindStringSubmatch(err.Error()); match != nil {
+				parseErr.Line, _ = strconv.Atoi(match[1])
+				parseErr.Err = errors.New("yaml: " + match[2])
+			}
+			err = parseErr
+		}
+		parseErr.File = filepath
 		return err
 	}
-	processor.yamlElements = yamlElements
 	return nil
 }
 
@@ -0,0 +1,74 @@
+package defs
+
+import (
+	"errors"
+	"os"
+	fp "path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParsePlaybookErrorPosition(t *testing.T) {
+	tests := []struct {
+		name     string
+		playbook string
+		line     int
+		column   int
+		message  string
+	}{
+		{
+			name:     "unknown play field",
+			playbook: "- hosts: all\n  tasks: []\n  unknown: 1\n",
+			line:     3,
+			column:   3,
+			message:  "Unknown play field unknown",
+		},
+		{
+			name:     "missing hosts",
+			playbook: "- name: first\n  hosts: all\n- name: second\n  tasks: []\n",
+			line:     3,
+			column:   3,
+			message:  "Play must have hosts",
+		},
+		{
+			name:     "unknown task field",
+			playbook: "- hosts: all\n  tasks:\n    - block:\n        - noop: {}\n          unknown: 1\n",
+			line:     5,
+			column:   11,
+			message:  "Unknown field unknown",
+		},
+		{
+			name:     "invalid serial",
+			playbook: "- hosts: all\n  serial: [1, x]\n",
+			line:     2,
+			column:   11,
+			message:  "Invalid serial batch size x",
+		},
+		{
+			name:     "syntax error",
+			playbook: "- hosts: all\n  tasks:\n    - noop: {\n",
+			line:     3,
+			column:   0,
+			message:  "playbook.yaml:3: yaml: did not find expected node content",
+		},
+	}
+	for _, test := range tests {
+		path := fp.Join(t.TempDir(), "playbook.yaml")
+		err := os.WriteFile(path, []byte(test.playbook), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = NewProcessor().ParsePlaybook(path)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("%s: error = %v, want a ParseError", test.name, err)
+			continue
+		}
+		if parseErr.File != path || parseErr.Line != test.line || parseErr.Column != test.column {
+			t.Errorf("%s: position = %s:%d:%d, want %s:%d:%d", test.name, parseErr.File, parseErr.Line, parseErr.Column, path, test.line, test.column)
+		}
+		if !strings.Contains(err.Error(), test.message) {
+			t.Errorf("%s: error = %v, want %q", test.name, err, test.message)
+		}
+	}
+}
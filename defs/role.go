@@ -0,0 +1,77 @@
+package defs
+
+import (
+	"fmt"
+	"os"
+	fp "path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	yamlExtensions = []string{"", ".yml", ".yaml"}
+)
+
+// Role represents a role directory containing tasks, vars and defaults.
+type Role struct {
+	Name string
+	Path string
+}
+
+// FindRole looks up the role directory in the search paths.
+func FindRole(name string, searchPaths []string) (*Role, error) {
+	if fp.IsAbs(name) {
+		return &Role{Name: fp.Base(name), Path: name}, nil
+	}
+	for _, searchPath := range searchPaths {
+		path, err := fp.Abs(fp.Join(searchPath, name))
+		if err != nil {
+			return nil, err
+		}
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			return &Role{Name: name, Path: path}, nil
+		}
+	}
+	return nil, fmt.Errorf("Role %s is not found in %v", name, searchPaths)
+}
+
+// File returns the path of the YAML file in the sub-directory of the role.
+func (role *Role) File(dir, name string) (string, error) {
+	for _, ext := range yamlExtensions {
+		path := fp.Join(role.Path, dir, name+ext)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("File %s is not found in %s of role %s", name, dir, role.Name)
+}
+
+// ReadVars reads the vars from the YAML file in the sub-directory of the role.
+// The main file is optional.
+func (role *Role) ReadVars(dir, name string) (Config, error) {
+	if name == "" {
+		name = "main"
+		if _, err := role.File(dir, name); err != nil {
+			return Config{}, nil
+		}
+	}
+	path, err := role.File(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	return ReadConfigFile(path)
+}
+
+// ReadConfigFile reads the key-value pairs from the YAML file.
+func ReadConfigFile(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := Config{}
+	err = yaml.Unmarshal(data, &config)
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
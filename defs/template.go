@@ -0,0 +1,497 @@
+package defs
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/noirbizarre/gonja"
+	"github.com/noirbizarre/gonja/config"
+	"github.com/noirbizarre/gonja/exec"
+	"github.com/noirbizarre/gonja/nodes"
+	"github.com/noirbizarre/gonja/tokens"
+)
+
+var (
+	templateEnv = newTemplateEnvironment()
+	// templateGlobals are the global functions of the environment like range.
+	templateGlobals = map[string]any{}
+	nameNodeType    = reflect.TypeOf(&nodes.Name{})
+)
+
+func init() {
+	// Merge copies the globals into the map of the context.
+	exec.NewContext(templateGlobals).Merge(templateEnv.Globals)
+}
+
+// TemplateOptions controls how the templates are rendered.
+type TemplateOptions struct {
+	// StrictUndefined makes a reference to an undefined variable an error.
+	StrictUndefined bool
+	// Native returns the value of a template consisting of a single expression as it is,
+	// instead of rendering it to a string.
+	Native bool
+	// SearchPaths are the directories in which the lookups search the relative paths.
+	SearchPaths []string
+}
+
+func newTemplateEnvironment() *gonja.Environment {
+	env := gonja.NewEnvironment(config.DefaultConfig, gonja.DefaultLoader)
+	env.Filters.Update(ansibleFilters)
+	for name, filter := range *env.Filters {
+		(*env.Filters)[name] = errorPropagatingFilter(name, filter)
+	}
+	env.Tests.Update(ansibleTests)
+	for name, test := range *env.Tests {
+		(*env.Tests)[name] = errorPropagatingTest(name, test)
+	}
+	return env
+}
+
+// parseTemplate parses the template source or returns the cached template.
+func parseTemplate(name, source string) (tpl *exec.Template, err error) {
+	key := templateCacheKey{name: name, source: source}
+	if tpl, ok := templateCache.get(key); ok {
+		return tpl, nil
+	}
+	// The gonja parser panics on some invalid expressions.
+	defer func() {
+		if r := recover(); r != nil {
+			tpl, err = nil, fmt.Errorf("Invalid template %s: %v", name, r)
+		}
+	}()
+	source = wrapTestExpressions(subscriptNumericAttributes(source))
+	tpl, err = exec.NewTemplate(name, source, templateEnv.EvalConfig)
+	if err != nil {
+		return nil, err
+	}
+	templateCache.put(key, tpl)
+	return tpl, nil
+}
+
+// isTemplate returns false if the string has no template syntax and renders to itself.
+func isTemplate(str string) bool {
+	return strings.Contains(str, "{{") || strings.Contains(str, "{%") || strings.Contains(str, "{#")
+}
+
+// errorPropagatingFilter returns the input as it is if it is an error.
+// Otherwise, filters like upper render the error message of an undefined variable.
+func errorPropagatingFilter(name string, filter exec.FilterFunction) exec.FilterFunction {
+	if name == "default" || name == "d" {
+		return filter
+	}
+	return func(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+		if in.IsError() {
+			return in
+		}
+		return filter(e, in, params)
+	}
+}
+
+func renderTemplate(str string, values Config, options TemplateOptions) (string, error) {
+	if !isTemplate(str) {
+		return str, nil
+	}
+	tpl, err := parseTemplate("string", str)
+	if err != nil {
+		return "", &TemplateError{Template: str, Err: err}
+	}
+	output, err := executeTemplate(tpl, templateContext(tpl.Root, values, options))
+	if err != nil {
+		return "", &TemplateError{Template: str, Err: templateErrorCause(err)}
+	}
+	return output, nil
+}
+
+// RenderTemplateFile renders the template file.
+func RenderTemplateFile(path string, values Config, options TemplateOptions) (string, error) {
+	fd, err := templateEnv.Loader.Get(path)
+	if err != nil {
+		return "", &TemplateError{Template: path, Err: err}
+	}
+	source, err := io.ReadAll(fd)
+	if err != nil {
+		return "", &TemplateError{Template: path, Err: err}
+	}
+	tpl, err := parseTemplate(path, string(source))
+	if err != nil {
+		return "", &TemplateError{Template: path, Err: err}
+	}
+	output, err := executeTemplate(tpl, templateContext(tpl.Root, values, options))
+	if err != nil {
+		return "", &TemplateError{Template: path, Err: templateErrorCause(err)}
+	}
+	return output, nil
+}
+
+// evaluateTemplate returns the value of the expression if the template is a single expression.
+// Otherwise, the template is rendered to a string.
+func evaluateTemplate(str string, values Config, options TemplateOptions) (any, error) {
+	if !isTemplate(str) {
+		return str, nil
+	}
+	tpl, err := parseTemplate("string", str)
+	if err != nil {
+		return nil, &TemplateError{Template: str, Err: err}
+	}
+	if len(tpl.Root.Nodes) != 1 {
+		return renderTemplate(str, values, options)
+	}
+	output, ok := tpl.Root.Nodes[0].(*nodes.Output)
+	if !ok {
+		return renderTemplate(str, values, options)
+	}
+	evaluator := &exec.Evaluator{
+		EvalConfig: templateEnv.EvalConfig,
+		Ctx:        templateContext(tpl.Root, values, options),
+	}
+	value := evaluator.Eval(output.Expression)
+	if value.IsError() {
+		return nil, &TemplateError{Template: str, Err: templateErrorCause(value)}
+	}
+	return toNative(value), nil
+}
+
+// EvaluateCondition evaluates the expression in a when condition.
+func EvaluateCondition(cond string, values Config, options TemplateOptions) (bool, error) {
+	tpl, err := parseTemplate("string", fmt.Sprintf("{%% if %s %%}true{%% else %%}false{%% endif %%}", cond))
+	if err != nil {
+		return false, err
+	}
+	ctx := templateContext(tpl.Root, values, options)
+	// The undefined names fail the condition even if the templates are not strict.
+	addUndefinedVariables(tpl.Root, ctx)
+	output, err := executeTemplate(tpl, ctx)
+	if err != nil {
+		return false, templateErrorCause(err)
+	}
+	return output == "true", nil
+}
+
+// subscriptNumericAttributes rewrites the numeric attributes like item.0.name to subscripts like item[0].name.
+// gonja lexes .0. as a float and fails to parse it.
+func subscriptNumericAttributes(source string) string {
+	if !strings.Contains(source, ".") {
+		return source
+	}
+	all := []*tokens.Token{}
+	lexer := tokens.NewLexer(source)
+	go lexer.Run()
+	for token := range lexer.Tokens {
+		all = append(all, token)
+	}
+	var sb strings.Builder
+	last := 0
+	var previous *tokens.Token
+	for i, token := range all {
+		if token.Type == tokens.Error {
+			// Let the parser report the error.
+			return source
+		}
+		if token.Type == tokens.Whitespace || token.Pos < last {
+			continue
+		}
+		current := previous
+		previous = token
+		if token.Type != tokens.Dot || current == nil || i+1 >= len(all) {
+			continue
+		}
+		if !isClosingToken(current) && (current.Type != tokens.Name || !isOperandToken(current)) {
+			continue
+		}
+		number := all[i+1]
+		if number.Type != tokens.Integer && number.Type != tokens.Float || strings.ContainsAny(number.Val, "eE") {
+			continue
+		}
+		// A float is two indexes like 0.1 or an index followed by a dot like 0.
+		index, rest, _ := strings.Cut(number.Val, ".")
+		sb.WriteString(source[last:token.Pos])
+		sb.WriteString("[" + index + "]")
+		switch {
+		case number.Type == tokens.Integer:
+		case rest == "":
+			sb.WriteString(".")
+		default:
+			sb.WriteString("[" + rest + "]")
+		}
+		last = number.Pos + len(number.Val)
+	}
+	if last == 0 {
+		return source
+	}
+	sb.WriteString(source[last:])
+	return sb.String()
+}
+
+// wrapTestExpressions wraps each test expression like x is defined in parentheses.
+// Otherwise, gonja parses the rest of the expression as the test argument,
+// e.g. x is defined and y is parsed as x is defined(and y).
+func wrapTestExpressions(source string) string {
+	if !strings.Contains(source, "is") {
+		return source
+	}
+	all := []*tokens.Token{}
+	lexer := tokens.NewLexer(source)
+	go lexer.Run()
+	for token := range lexer.Tokens {
+		all = append(all, token)
+	}
+	// End offsets are needed as the string tokens are unescaped.
+	toks := []*tokens.Token{}
+	ends := []int{}
+	for i, token := range all {
+		if token.Type == tokens.Error {
+			// Let the parser report the error.
+			return source
+		}
+		if token.Type == tokens.Whitespace {
+			continue
+		}
+		end := len(source)
+		if i+1 < len(all) {
+			end = all[i+1].Pos
+		}
+		toks = append(toks, token)
+		ends = append(ends, end)
+	}
+	type insertion struct {
+		offset int
+		text   string
+	}
+	insertions := []insertion{}
+	for i, token := range toks {
+		if token.Type != tokens.Name || token.Val != "is" {
+			continue
+		}
+		start := testSubjectStart(toks, i)
+		end := testExpressionEnd(toks, i)
+		if start < 0 || end < 0 {
+			continue
+		}
+		insertions = append(insertions,
+			insertion{offset: toks[start].Pos, text: "("},
+			insertion{offset: ends[end], text: ")"})
+	}
+	if len(insertions) == 0 {
+		return source
+	}
+	sort.SliceStable(insertions, func(i, j int) bool {
+		if insertions[i].offset == insertions[j].offset {
+			return insertions[i].text == ")" && insertions[j].text == "("
+		}
+		return insertions[i].offset < insertions[j].offset
+	})
+	var sb strings.Builder
+	last := 0
+	for _, ins := range insertions {
+		sb.WriteString(source[last:ins.offset])
+		sb.WriteString(ins.text)
+		last = ins.offset
+	}
+	sb.WriteString(source[last:])
+	return sb.String()
+}
+
+// testSubjectStart returns the index of the first token of the expression tested
+// by the is token at the index. It is -1 if the expression is not recognized.
+func testSubjectStart(toks []*tokens.Token, index int) int {
+	start := -1
+	for i := index - 1; i >= 0; {
+		token := toks[i]
+		switch {
+		case isClosingToken(token):
+			open := matchingToken(toks, i, -1)
+			if open < 0 {
+				return -1
+			}
+			start, i = open, open-1
+			// A call or a subscript.
+			if i >= 0 && (isOperandToken(toks[i]) || isClosingToken(toks[i])) {
+				continue
+			}
+		case isOperandToken(token):
+			start, i = i, i-1
+		default:
+			return start
+		}
+		// An attribute or a filter.
+		if i >= 0 && (toks[i].Type == tokens.Dot || toks[i].Type == tokens.Pipe) {
+			i--
+			continue
+		}
+		return start
+	}
+	return start
+}
+
+// testExpressionEnd returns the index of the last token of the test
+// following the is token at the index. It is -1 if the test is not recognized.
+func testExpressionEnd(toks []*tokens.Token, index int) int {
+	i := index + 1
+	if i < len(toks) && toks[i].Type == tokens.Name && toks[i].Val == "not" {
+		i++
+	}
+	if i >= len(toks) || !isOperandToken(toks[i]) {
+		return -1
+	}
+	if i+1 < len(toks) {
+		switch next := toks[i+1]; {
+		case next.Type == tokens.Lparen:
+			return matchingToken(toks, i+1, 1)
+		case isOperandToken(next):
+			// A single argument without parentheses like divisibleby 3.
+			return i + 1
+		}
+	}
+	return i
+}
+
+// matchingToken returns the index of the bracket matching the one at the index.
+// It searches backwards if the direction is negative.
+func matchingToken(toks []*tokens.Token, index int, direction int) int {
+	depth := 0
+	for i := index; i >= 0 && i < len(toks); i += direction {
+		switch {
+		case isOpeningToken(toks[i]):
+			depth += direction
+		case isClosingToken(toks[i]):
+			depth -= direction
+		case toks[i].Type == tokens.VariableEnd || toks[i].Type == tokens.BlockEnd ||
+			toks[i].Type == tokens.VariableBegin || toks[i].Type == tokens.BlockBegin:
+			return -1
+		}
+		if depth == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+func isOpeningToken(token *tokens.Token) bool {
+	return token.Type == tokens.Lparen || token.Type == tokens.Lbracket || token.Type == tokens.Lbrace
+}
+
+func isClosingToken(token *tokens.Token) bool {
+	return token.Type == tokens.Rparen || token.Type == tokens.Rbracket || token.Type == tokens.Rbrace
+}
+
+// isOperandToken returns true for a name, which is not a keyword, or a literal.
+func isOperandToken(token *tokens.Token) bool {
+	switch token.Type {
+	case tokens.String, tokens.Integer, tokens.Float:
+		return true
+	case tokens.Name:
+		switch token.Val {
+		case "and", "or", "not", "in", "is", "if", "elif", "else", "for", "recursive":
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+// executeTemplate renders the template in the context.
+// Unlike Template.Execute, it does not copy the context.
+func executeTemplate(tpl *exec.Template, ctx *exec.Context) (string, error) {
+	var out strings.Builder
+	renderer := exec.NewRenderer(ctx, &out, tpl.Env, tpl)
+	err := renderer.Execute()
+	if err != nil {
+		return "", err
+	}
+	return renderer.String(), nil
+}
+
+// templateContext returns the context of the values with the global and the lookup functions.
+// The values are not copied but layered below the functions, which the template cannot modify.
+// In strict mode, the undefined variables referenced in the root are added as well.
+func templateContext(root *nodes.Template, values Config, options TemplateOptions) *exec.Context {
+	ctx := exec.NewContext(values).Inherit()
+	for name, value := range templateGlobals {
+		// The variables take precedence over the globals.
+		if _, ok := values[name]; !ok {
+			ctx.Set(name, value)
+		}
+	}
+	lookupContext := &LookupContext{Variables: values, Options: options}
+	query := lookupContext.lookupFunction(true)
+	ctx.Set("lookup", lookupContext.lookupFunction(false))
+	ctx.Set("query", query)
+	ctx.Set("q", query)
+	if options.StrictUndefined && root != nil {
+		addUndefinedVariables(root, ctx)
+	}
+	return ctx
+}
+
+// addUndefinedVariables sets the variables referenced in the template but not defined
+// to UndefinedVariableError.
+// Evaluating such a variable fails unless it is tested for definition or defaulted.
+func addUndefinedVariables(root *nodes.Template, ctx *exec.Context) {
+	names := map[string]struct{}{}
+	collectVariableNames(reflect.ValueOf(root), names, map[uintptr]struct{}{})
+	for name := range names {
+		if !ctx.Has(name) {
+			ctx.Set(name, &UndefinedVariableError{Name: name})
+		}
+	}
+}
+
+// collectVariableNames adds the names referenced in the nodes reachable from the value.
+// The fields are walked by reflection since the statements like if and for do not export their nodes.
+// The names bound by the statements like for and set are added too, but they are shadowed when bound.
+func collectVariableNames(value reflect.Value, names map[string]struct{}, visited map[uintptr]struct{}) {
+	switch value.Kind() {
+	case reflect.Pointer:
+		if value.IsNil() {
+			return
+		}
+		if value.Type() == nameNodeType {
+			names[value.Elem().FieldByName("Name").Elem().FieldByName("Val").String()] = struct{}{}
+			return
+		}
+		if _, ok := visited[value.Pointer()]; ok {
+			return
+		}
+		visited[value.Pointer()] = struct{}{}
+		collectVariableNames(value.Elem(), names, visited)
+	case reflect.Interface:
+		if !value.IsNil() {
+			collectVariableNames(value.Elem(), names, visited)
+		}
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			collectVariableNames(value.Field(i), names, visited)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			collectVariableNames(value.Index(i), names, visited)
+		}
+	case reflect.Map:
+		iter := value.MapRange()
+		for iter.Next() {
+			collectVariableNames(iter.Value(), names, visited)
+		}
+	}
+}
+
+// templateErrorCause returns the UndefinedVariableError wrapped in the gonja error if there is any.
+func templateErrorCause(err error) error {
+	for cause := err; cause != nil; {
+		switch e := cause.(type) {
+		case *UndefinedVariableError:
+			return e
+		case *exec.Value:
+			cause, _ = e.Interface().(error)
+		case interface{ Cause() error }:
+			cause = e.Cause()
+		case interface{ Unwrap() error }:
+			cause = e.Unwrap()
+		default:
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,142 @@
+package defs
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSubscriptNumericAttributes(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"plain text 1.0", "plain text 1.0"},
+		{"{{ item.0.name }}", "{{ item[0].name }}"},
+		{"{{ item.1 }}", "{{ item[1] }}"},
+		{"{{ item.0.1 }}", "{{ item[0][1] }}"},
+		{"{{ x[0].0 }}", "{{ x[0][0] }}"},
+		{"{{ f().0 }}", "{{ f()[0] }}"},
+		{"{{ 1.5 + item.name }}", "{{ 1.5 + item.name }}"},
+		{"{{ '.0.' ~ item.0 }}", "{{ '.0.' ~ item[0] }}"},
+		{"{% for x in items.0 %}{{ x.0 }}{% endfor %}", "{% for x in items[0] %}{{ x[0] }}{% endfor %}"},
+	}
+	for _, test := range tests {
+		if got := subscriptNumericAttributes(test.source); got != test.want {
+			t.Errorf("subscriptNumericAttributes(%q) = %q, want %q", test.source, got, test.want)
+		}
+	}
+}
+
+func TestRenderNumericAttributes(t *testing.T) {
+	values := Config{
+		"item": []any{map[string]any{"name": "alice"}, []any{"x", "y"}},
+	}
+	tests := map[string]string{
+		"{{ item.0.name }}":                 "alice",
+		"{{ item.1.1 }}":                    "y",
+		"{{ item[0].name }}-{{ item.1.0 }}": "alice-x",
+	}
+	for source, want := range tests {
+		got, err := renderTemplate(source, values, TemplateOptions{})
+		if err != nil {
+			t.Errorf("renderTemplate(%q) failed: %v", source, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("renderTemplate(%q) = %q, want %q", source, got, want)
+		}
+	}
+}
+
+func TestRenderInvalidTemplate(t *testing.T) {
+	for _, source := range []string{"{{ item. }}", "{{ item[ }}", "{{ item.0.1.2 }}"} {
+		_, err := renderTemplate(source, Config{"item": []any{1}}, TemplateOptions{})
+		var templateErr *TemplateError
+		if !errors.As(err, &templateErr) {
+			t.Errorf("renderTemplate(%q) = %v, want a TemplateError", source, err)
+		}
+	}
+}
+
+func TestTemplateContextLayers(t *testing.T) {
+	values := Config{"name": "world", "range": "shadowed"}
+	tests := map[string]string{
+		"{% set name = 'set' %}{{ name }}":         "set",
+		"{{ range }}":                              "shadowed",
+		"{% for i in [1, 2] %}{{ i }}{% endfor %}": "12",
+	}
+	for source, want := range tests {
+		got, err := renderTemplate(source, values, TemplateOptions{})
+		if err != nil {
+			t.Errorf("renderTemplate(%q) failed: %v", source, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("renderTemplate(%q) = %q, want %q", source, got, want)
+		}
+	}
+	got, err := renderTemplate("{{ range(3) | list | join(',') }}", Config{}, TemplateOptions{})
+	if err != nil || got != "0,1,2" {
+		t.Errorf("renderTemplate(range) = %q, %v", got, err)
+	}
+	if len(values) != 2 || values["name"] != "world" {
+		t.Errorf("values are modified: %v", values)
+	}
+}
+
+func TestRenderStrictUndefinedStatements(t *testing.T) {
+	values := Config{"items": []any{1, 2}, "flag": true}
+	undefined := []string{
+		"{% if missing %}yes{% endif %}",
+		"{% if flag %}{{ missing }}{% endif %}",
+		"{% if not flag %}{% elif missing %}yes{% endif %}",
+		"{% for x in missing %}{{ x }}{% endfor %}",
+		"{% for x in items %}{{ x + missing }}{% endfor %}",
+		"{% set y = missing %}{{ y }}",
+		"{% with y = missing %}{{ y }}{% endwith %}",
+	}
+	for _, source := range undefined {
+		_, err := renderTemplate(source, values, TemplateOptions{StrictUndefined: true})
+		var undefinedErr *UndefinedVariableError
+		if !errors.As(err, &undefinedErr) || undefinedErr.Name != "missing" {
+			t.Errorf("renderTemplate(%q) = %v, want the undefined variable missing", source, err)
+		}
+	}
+	// The names bound by the statements are not undefined.
+	defined := map[string]string{
+		"{% for x in items %}{{ x }}{{ loop.index }}{% endfor %}": "1122",
+		"{% set y = 3 %}{{ y }}":                                  "3",
+		"{% with y = 4 %}{{ y }}{% endwith %}":                    "4",
+		"{% macro m(a) %}{{ a }}{% endmacro %}{{ m(5) }}":         "5",
+		"{% if missing is defined %}{{ missing }}{% endif %}":     "",
+	}
+	for source, want := range defined {
+		got, err := renderTemplate(source, values, TemplateOptions{StrictUndefined: true})
+		if err != nil || got != want {
+			t.Errorf("renderTemplate(%q) = %q, %v, want %q", source, got, err, want)
+		}
+	}
+}
+
+func TestEvaluateConditionUndefined(t *testing.T) {
+	values := Config{"flag": true}
+	for _, options := range []TemplateOptions{{}, {StrictUndefined: true}} {
+		_, err := EvaluateCondition("missing == 1", values, options)
+		var undefinedErr *UndefinedVariableError
+		if !errors.As(err, &undefinedErr) {
+			t.Errorf("EvaluateCondition with %+v = %v, want an UndefinedVariableError", options, err)
+		}
+		conds := map[string]bool{
+			"missing is defined":              false,
+			"missing is undefined":            true,
+			"missing | default(flag)":         true,
+			"flag and missing is not defined": true,
+		}
+		for cond, want := range conds {
+			got, err := EvaluateCondition(cond, values, options)
+			if err != nil || got != want {
+				t.Errorf("EvaluateCondition(%q) with %+v = %v, %v, want %v", cond, options, got, err, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package defs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	fp "path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/noirbizarre/gonja/exec"
+)
+
+var (
+	ansibleTests = exec.TestSet{
+		"abs":             testAbs,
+		"change":          testChanged,
+		"changed":         testChanged,
+		"contains":        testContains,
+		"directory":       testDirectory,
+		"exists":          testExists,
+		"failed":          testFailed,
+		"failure":         testFailed,
+		"file":            testFile,
+		"link":            testLink,
+		"match":           testMatch,
+		"regex":           testRegex,
+		"search":          testSearch,
+		"skip":            testSkipped,
+		"skipped":         testSkipped,
+		"subset":          testSubset,
+		"succeeded":       testSucceeded,
+		"success":         testSucceeded,
+		"superset":        testSuperset,
+		"version":         testVersion,
+		"version_compare": testVersion,
+	}
+
+	// Same as the component pattern of LooseVersion of Python.
+	versionComponent = regexp.MustCompile(`\d+|[a-zA-Z]+|[^\d\sa-zA-Z.]+`)
+)
+
+// errorPropagatingTest fails the test if the input is an error like an undefined variable.
+func errorPropagatingTest(name string, test exec.TestFunction) exec.TestFunction {
+	if name == "defined" || name == "undefined" {
+		return test
+	}
+	return func(ctx *exec.Context, in *exec.Value, params *exec.VarArgs) (bool, error) {
+		if in.IsError() {
+			return false, in
+		}
+		return test(ctx, in, params)
+	}
+}
+
+// testArgs returns the arguments of the test. The arguments in the form of is test(a, b)
+// are parsed as a single tuple which is unpacked here.
+func testArgs(params *exec.VarArgs) []*exec.Value {
+	if len(params.Args) == 1 && params.Args[0].IsList() {
+		args := []*exec.Value{}
+		params.Args[0].Iterate(func(idx, count int, key, value *exec.Value) bool {
+			args = append(args, key)
+			return true
+		}, func() {})
+		return args
+	}
+	return params.Args
+}
+
+// taskResult returns the registered result of a task.
+func taskResult(name string, in *exec.Value) (map[string]any, error) {
+	result, ok := toDict(in)
+	if !ok {
+		return nil, fmt.Errorf("The %s test expects a registered result, but found %T", name, toNative(in))
+	}
+	return result, nil
+}
+
+func testSucceeded(ctx *exec.Context, in *exec.Value, params *exec.VarArgs) (bool, error) {
+	result, err := taskResult("succeeded", in)
+	if err != nil {
+		return false, err
+	}
+	return !toBool(result["failed"]), nil
+}
+
+func testFailed(ctx *exec.Context, in *exec.Value, params *exec.VarArgs) (bool, error) {
+	result, err := taskResult("failed", in)
+	if err != nil {
+		return false, err
+	}
+	return toBool(result["failed"]), nil
+}
+
+func testChanged(ctx *exec.Context, in *exec.Value, params *exec.VarArgs) (bool, error) {
+	result, err := taskResult("changed", in)
+	if err != nil {
+		return false, err
+	}
+	return toBool(result["changed"]), nil
+}
+
+func testSkipped(ctx *exec.Context, in *exec.Value, params *exec.VarArgs) (bool, error) {
+	result, err := taskResult("skipped", in)
+	if err != nil {
+		return false, err
+	}
+	return toBool(result["skipped"]), nil
+}
+
+// regexTest matches the input against the pattern in the first argument.
+// The optional arguments are ignorecase, multiline and match_type as gonja does not parse
+// keyword arguments of tests.
+func regexTest(name string, in *exec.Value, params *exec.VarArgs, matchType string) (bool, error) {
+	args := testArgs(params)
+	if len(args) < 1 {
+		return false, fmt.Errorf("The %s test expects a pattern", name)
+	}
+	ignoreCase, multiline := false, false
+	if len(args) > 1 {
+		ignoreCase = args[1].Bool()
+	}
+	if len(args) > 2 {
+		multiline = args[2].Bool()
+	}
+	if len(args) > 3 && name == "regex" {
+		matchType = args[3].String()
+	}
+	pattern := args[0].String()
+	switch matchType {
+	case "match":
+		pattern = `\A(?:` + pattern + `)`
+	case "fullmatch":
+		pattern = `\A(?:` + pattern + `)\z`
+	}
+	re, err := compileRegex(pattern, ignoreCase, multiline)
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(in.String()), nil
+}
+
+func testMatch(ctx *exec.Context, in *exec.Value, params *exec.VarArgs) (bool, error) {
+	return regexTest("match", in, params, "match")
+}
+
+func testSearch(ctx *exec.Context, in *exec.Value, params *exec.VarArgs) (bool, error) {
+	return regexTest("search", in, params, "search")
+}
+
+func testRegex(ctx *exec.Context, in *exec.Value, params *exec.VarArgs) (bool, error) {
+	return regexTest("regex", in, params, "search")
+}
+
+// compareVersions compares the versions in the same way as LooseVersion.
+func compareVersions(a, b string) int {
+	partsA := versionComponent.FindAllString(a, -1)
+	partsB := versionComponent.FindAllString(b, -1)
+	for i := 0; i < len(partsA) && i < len(partsB); i++ {
+		numA, errA := strconv.Atoi(partsA[i])
+		numB, errB := strconv.Atoi(partsB[i])
+		switch {
+		case errA == nil && errB == nil:
+			if numA != numB {
+				if numA < numB {
+					return -1
+				}
+				return 1
+			}
+		case errA == nil:
+			// A number is greater than a pre-release tag like rc or beta.
+			return 1
+		case errB == nil:
+			return -1
+		default:
+			if c := strings.Compare(partsA[i], partsB[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	switch {
+	case len(partsA) < len(partsB):
+		return -1
+	case len(partsA) > len(partsB):
+		return 1
+	}
+	return 0
+}
+
+func testVersion(ctx *exec.Context, in *exec.Value, params *exec.VarArgs) (bool, error) {
+	args := testArgs(params)
+	if len(args) < 1 {
+		return false, errors.New("The version test expects a version to compare")
+	}
+	operator := "eq"
+	if len(args) > 1 {
+		operator = args[1].String()
+	}
+	c := compareVersions(in.String(), args[0].String())
+	switch operator {
+	case "==", "=", "eq":
+		return c == 0, nil
+	case "!=", "<>", "ne":
+		return c != 0, nil
+	case "<", "lt":
+		return c < 0, nil
+	case "<=", "le":
+		return c <= 0, nil
+	case ">", "gt":
+		return c > 0, nil
+	case ">=", "ge":
+		return c >= 0, nil
+	}
+	return false, fmt.Errorf("Invalid version operator %s", operator)
+}
+
+// containsAll returns true if all the items of b are in a.
+func containsAll(a, b *exec.Value) (bool, error) {
+	listA, ok1 := toList(a)
+	listB, ok2 := toList(b)
+	if !ok1 || !ok2 {
+		return false, errors.New("Lists are expected")
+	}
+	for _, item := range listB {
+		if !containsItem(listA, item) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func testSubset(ctx *exec.Context, in *exec.Value, params *exec.VarArgs) (bool, error) {
+	return containsAll(params.First(), in)
+}
+
+func testSuperset(ctx *exec.Context, in *exec.Value, params *exec.VarArgs) (bool, error) {
+	return containsAll(in, params.First())
+}
+
+func testContains(ctx *exec.Context, in *exec.Value, params *exec.VarArgs) (bool, error) {
+	return in.Contains(params.First()), nil
+}
+
+func testFile(ctx *exec.Context, in *exec.Value, params *exec.VarArgs) (bool, error) {
+	info, err := os.Stat(in.String())
+	return err == nil && info.Mode().IsRegular(), nil
+}
+
+func testDirectory(ctx *exec.Context, in *exec.Value, params *exec.VarArgs) (bool, error) {
+	info, err := os.Stat(in.String())
+	return err == nil && info.IsDir(), nil
+}
+
+func testExists(ctx *exec.Context, in *exec.Value, params *exec.VarArgs) (bool, error) {
+	_, err := os.Stat(in.String())
+	return err == nil, nil
+}
+
+func testLink(ctx *exec.Context, in *exec.Value, params *exec.VarArgs) (bool, error) {
+	info, err := os.Lstat(in.String())
+	return err == nil && info.Mode()&os.ModeSymlink != 0, nil
+}
+
+func testAbs(ctx *exec.Context, in *exec.Value, params *exec.VarArgs) (bool, error) {
+	return fp.IsAbs(in.String()), nil
+}
@@ -0,0 +1,96 @@
+package defs
+
+import (
+	"os"
+	fp "path/filepath"
+	"testing"
+)
+
+func TestAnsibleTests(t *testing.T) {
+	dir := t.TempDir()
+	file := fp.Join(dir, "file")
+	err := os.WriteFile(file, nil, 0644)
+	if err == nil {
+		err = os.Symlink(file, fp.Join(dir, "link"))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := Config{
+		"dir":     dir,
+		"ok":      map[string]any{"failed": false, "changed": true},
+		"failure": map[string]any{"failed": true},
+		"skip":    map[string]any{"skipped": true},
+		"items":   []any{1, 2, 3},
+	}
+	conds := map[string]bool{
+		"ok is succeeded":                         true,
+		"ok is success":                           true,
+		"ok is failed":                            false,
+		"failure is failure":                      true,
+		"ok is changed":                           true,
+		"failure is change":                       false,
+		"skip is skipped":                         true,
+		"ok is skip":                              false,
+		"'abc' is match('a')":                     true,
+		"'abc' is match('b')":                     false,
+		"'abc' is search('b')":                    true,
+		"'ABC' is search('b', true)":              true,
+		"'abc' is regex('^b')":                    false,
+		"'a\nbc' is regex('^b', false, true)":     true,
+		"'1.10.0' is version('1.9', '>')":         true,
+		"'1.0rc1' is version('1.0.0', 'lt')":      true,
+		"'2.0' is version('2.0')":                 true,
+		"'2.0' is version_compare('2.1', '<=')":   true,
+		"'2.0.1' is version_compare('2.0', 'ne')": true,
+		"[1, 2] is subset(items)":                 true,
+		"items is superset([1, 4])":               false,
+		"items is contains(2)":                    true,
+		"(dir ~ '/file') is file":                 true,
+		"dir is file":                             false,
+		"dir is directory":                        true,
+		"(dir ~ '/link') is link":                 true,
+		"(dir ~ '/file') is link":                 false,
+		"(dir ~ '/missing') is exists":            false,
+		"dir is abs":                              true,
+		"'relative/path' is abs":                  false,
+	}
+	for cond, want := range conds {
+		got, err := EvaluateCondition(cond, values, TemplateOptions{})
+		if err != nil || got != want {
+			t.Errorf("EvaluateCondition(%q) = %v, %v, want %v", cond, got, err, want)
+		}
+	}
+}
+
+func TestAnsibleTestErrors(t *testing.T) {
+	for _, cond := range []string{
+		"'x' is succeeded",
+		"'1.0' is version('1.0', 'about')",
+		"'a' is match",
+		"1 is subset(2)",
+	} {
+		if _, err := EvaluateCondition(cond, Config{}, TemplateOptions{}); err == nil {
+			t.Errorf("EvaluateCondition(%q) succeeded, want an error", cond)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"1.10", "1.9", 1},
+		{"1.0", "1.0.1", -1},
+		{"1.0rc1", "1.0", 1},
+		{"1.0rc1", "1.0.0", -1},
+		{"1.0b1", "1.0rc1", -1},
+	}
+	for _, test := range tests {
+		if got := compareVersions(test.a, test.b); got != test.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
@@ -1,127 +1,286 @@
 package defs
 
 import (
+	"encoding/json"
 	"reflect"
+	"strconv"
+	"strings"
+)
 
-	"github.com/noirbizarre/gonja"
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
 )
 
 func DefaultTemplateResolver(values Config) TemplateResolver {
-	return TemplateResolver(func(str string) (string, error) {
-		tpl, err := gonja.FromString(str)
-		if err != nil {
-			return "", err
+	return NewTemplateResolver(values, TemplateOptions{})
+}
+
+func NewTemplateResolver(values Config, options TemplateOptions) TemplateResolver {
+	return TemplateResolver(func(str string, native bool) (any, error) {
+		if native && options.Native {
+			return evaluateTemplate(str, values, options)
 		}
-		return tpl.Execute(values)
+		return renderTemplate(str, values, options)
 	})
 }
 
+// ResolveVars returns a deep copy of the input in which the strings are resolved as templates.
+// A string stored in an interface may be resolved to a native value.
 func ResolveVars[V any](input V, resolver TemplateResolver) (V, error) {
 	var output V
-	visited := map[uintptr]struct{}{}
-	i, err := resolveVars(input, resolver, visited)
+	value := reflect.ValueOf(&input).Elem()
+	resolvedValue, err := resolveVars(value, resolver, map[resolvedKey]reflect.Value{})
 	if err != nil {
 		return output, err
 	}
-	if i != nil {
-		output = i.(V)
-	}
+	// The output stays zero if the value is a nil interface.
+	output, _ = resolvedValue.Interface().(V)
 	return output, nil
 }
 
-// This resolves the variables in the input structure using the provided resolver function.
-func resolveVars(input any, resolver TemplateResolver, visited map[uintptr]struct{}) (any, error) {
-	value := reflect.ValueOf(input)
-	targetValue := reflect.Indirect(value)
-	if !targetValue.IsValid() {
-		return nil, nil
-	}
-	if targetValue.CanAddr() {
-		address := targetValue.Addr().Pointer()
-		if _, ok := visited[address]; ok {
-			return input, nil
+// resolvedKey identifies a pointer, map or slice which is already resolved.
+type resolvedKey struct {
+	pointer   uintptr
+	length    int
+	valueType reflect.Type
+}
+
+// resolveVars returns a copy of the value of the same type with the strings resolved.
+// The pointers, maps and slices shared in the input are also shared in the output,
+// which also makes the cycles safe.
+func resolveVars(value reflect.Value, resolver TemplateResolver, resolved map[resolvedKey]reflect.Value) (reflect.Value, error) {
+	valueType := value.Type()
+	switch value.Kind() {
+	case reflect.Interface:
+		if value.IsNil() {
+			return value, nil
 		}
-		visited[address] = struct{}{}
-	}
-	var output any
-	targetValueType := targetValue.Type()
-	switch targetValueType.Kind() {
-	case reflect.Struct:
-		clonePtr := reflect.New(targetValueType)
-		clone := clonePtr.Elem()
-		for i := 0; i < targetValue.NumField(); i++ {
-			name := targetValueType.Field(i).Name
-			field := targetValue.FieldByName(name)
-			cloneField := clone.FieldByName(name)
-			if field.IsValid() {
-				resolvedValue, err := resolveVars(field.Interface(), resolver, visited)
-				if err != nil {
-					return nil, err
-				}
-				if resolvedValue != nil {
-					cloneField.Set(reflect.ValueOf(resolvedValue))
-				}
+		clone := reflect.New(valueType).Elem()
+		element := value.Elem()
+		if element.Kind() == reflect.String && valueType.NumMethod() == 0 {
+			// Native values can be stored only in an empty interface.
+			resolvedValue, err := resolver(element.String(), true)
+			if err != nil {
+				return value, err
 			}
+			if resolvedValue != nil {
+				clone.Set(reflect.ValueOf(resolvedValue))
+			}
+			return clone, nil
 		}
-		if value.Type().Kind() == reflect.Pointer {
-			output = clonePtr.Interface()
-		} else {
-			output = clone.Interface()
+		resolvedElement, err := resolveVars(element, resolver, resolved)
+		if err != nil {
+			return value, err
 		}
-	case reflect.Slice:
-		clone := reflect.MakeSlice(targetValueType, targetValue.Len(), targetValue.Len())
-		for i := 0; i < targetValue.Len(); i++ {
-			element := targetValue.Index(i)
-			cloneElement := clone.Index(i)
-			resolvedValue, err := resolveVars(element.Interface(), resolver, visited)
+		clone.Set(resolvedElement)
+		return clone, nil
+	case reflect.Pointer:
+		if value.IsNil() {
+			return value, nil
+		}
+		key := resolvedKey{pointer: value.Pointer(), valueType: valueType}
+		if clone, ok := resolved[key]; ok {
+			return clone, nil
+		}
+		clone := reflect.New(valueType.Elem())
+		resolved[key] = clone
+		resolvedElement, err := resolveVars(value.Elem(), resolver, resolved)
+		if err != nil {
+			return value, err
+		}
+		clone.Elem().Set(resolvedElement)
+		return clone, nil
+	case reflect.Struct:
+		clone := reflect.New(valueType).Elem()
+		// The unexported fields are copied as they are.
+		clone.Set(value)
+		for i := 0; i < value.NumField(); i++ {
+			field := valueType.Field(i)
+			if !field.IsExported() || field.Tag.Get("template") == "-" {
+				continue
+			}
+			resolvedField, err := resolveVars(value.Field(i), resolver, resolved)
 			if err != nil {
-				return nil, err
+				return value, err
 			}
-			if resolvedValue != nil {
-				cloneElement.Set(reflect.ValueOf(resolvedValue))
+			clone.Field(i).Set(resolvedField)
+		}
+		return clone, nil
+	case reflect.Slice:
+		if value.IsNil() {
+			return value, nil
+		}
+		key := resolvedKey{pointer: value.Pointer(), length: value.Len(), valueType: valueType}
+		if clone, ok := resolved[key]; ok {
+			return clone, nil
+		}
+		clone := reflect.MakeSlice(valueType, value.Len(), value.Len())
+		resolved[key] = clone
+		for i := 0; i < value.Len(); i++ {
+			resolvedElement, err := resolveVars(value.Index(i), resolver, resolved)
+			if err != nil {
+				return value, err
 			}
+			clone.Index(i).Set(resolvedElement)
 		}
-		if value.Kind() == reflect.Pointer {
-			output = clone.Addr().Interface()
-		} else {
-			output = clone.Interface()
+		return clone, nil
+	case reflect.Array:
+		clone := reflect.New(valueType).Elem()
+		for i := 0; i < value.Len(); i++ {
+			resolvedElement, err := resolveVars(value.Index(i), resolver, resolved)
+			if err != nil {
+				return value, err
+			}
+			clone.Index(i).Set(resolvedElement)
 		}
+		return clone, nil
 	case reflect.Map:
-		clone := reflect.MakeMap(targetValueType)
-		for _, key := range targetValue.MapKeys() {
-			mValue := targetValue.MapIndex(key)
-			if mValue.IsValid() {
-				resolvedValue, err := resolveVars(mValue.Interface(), resolver, visited)
-				if err != nil {
-					return nil, err
-				}
-				if resolvedValue != nil {
-					clone.SetMapIndex(key, reflect.ValueOf(resolvedValue))
+		if value.IsNil() {
+			return value, nil
+		}
+		key := resolvedKey{pointer: value.Pointer(), valueType: valueType}
+		if clone, ok := resolved[key]; ok {
+			return clone, nil
+		}
+		clone := reflect.MakeMapWithSize(valueType, value.Len())
+		resolved[key] = clone
+		iter := value.MapRange()
+		for iter.Next() {
+			// The keys are not templated.
+			resolvedElement, err := resolveVars(iter.Value(), resolver, resolved)
+			if err != nil {
+				return value, err
+			}
+			clone.SetMapIndex(iter.Key(), resolvedElement)
+		}
+		return clone, nil
+	case reflect.String:
+		resolvedValue, err := resolver(value.String(), false)
+		if err != nil {
+			return value, err
+		}
+		// Preserve the named string types.
+		return reflect.ValueOf(resolvedValue).Convert(valueType), nil
+	}
+	return value, nil
+}
+
+// convertScalars returns a copy of the decoded JSON value in which the scalars are converted
+// to the kinds of the fields of the type, e.g. a number to a string field, so that the native
+// template results can be unmarshaled. The values which cannot be converted are kept as they are.
+func convertScalars(value any, valueType reflect.Type) any {
+	for valueType.Kind() == reflect.Pointer {
+		valueType = valueType.Elem()
+	}
+	if reflect.PointerTo(valueType).Implements(jsonUnmarshalerType) {
+		return value
+	}
+	switch valueType.Kind() {
+	case reflect.Struct:
+		object, ok := value.(map[string]any)
+		if !ok {
+			return value
+		}
+		fields := map[string]reflect.Type{}
+		jsonFields(valueType, fields)
+		converted := make(map[string]any, len(object))
+		for key, element := range object {
+			fieldType, ok := fields[key]
+			if !ok {
+				// The JSON keys match the field names case-insensitively.
+				for name, t := range fields {
+					if strings.EqualFold(name, key) {
+						fieldType, ok = t, true
+						break
+					}
 				}
 			}
-			if value.Kind() == reflect.Pointer {
-				output = clone.Addr().Interface()
-			} else {
-				output = clone.Interface()
+			if ok {
+				element = convertScalars(element, fieldType)
 			}
+			converted[key] = element
+		}
+		return converted
+	case reflect.Map:
+		object, ok := value.(map[string]any)
+		if !ok {
+			return value
+		}
+		converted := make(map[string]any, len(object))
+		for key, element := range object {
+			converted[key] = convertScalars(element, valueType.Elem())
+		}
+		return converted
+	case reflect.Slice, reflect.Array:
+		list, ok := value.([]any)
+		if !ok {
+			return value
 		}
+		converted := make([]any, len(list))
+		for i, element := range list {
+			converted[i] = convertScalars(element, valueType.Elem())
+		}
+		return converted
 	case reflect.String:
-		strValue, ok := targetValue.Interface().(string)
-		if ok {
-			resolvedValue, err := resolver(strValue)
-			if err != nil {
-				return nil, err
+		switch v := value.(type) {
+		case bool:
+			return strconv.FormatBool(v)
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if str, ok := value.(string); ok {
+			if number, err := strconv.ParseFloat(strings.TrimSpace(str), 64); err == nil {
+				return number
 			}
-			if value.Type().Kind() == reflect.Pointer {
-				clone := reflect.New(targetValueType).Elem()
-				clone.SetString(resolvedValue)
-				output = clone.Addr().Interface()
-			} else {
-				output = resolvedValue
+		}
+	case reflect.Bool:
+		if str, ok := value.(string); ok {
+			if b, err := strconv.ParseBool(strings.TrimSpace(str)); err == nil {
+				return b
+			}
+		}
+	}
+	return value
+}
+
+// jsonFields adds the types of the fields of the struct type by their JSON names.
+// The fields of the embedded structs are promoted unless they are shadowed like encoding/json does.
+func jsonFields(structType reflect.Type, fields map[string]reflect.Type) {
+	embedded := []reflect.Type{}
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Pointer {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				embedded = append(embedded, fieldType)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	for _, embeddedType := range embedded {
+		promoted := map[string]reflect.Type{}
+		jsonFields(embeddedType, promoted)
+		for name, fieldType := range promoted {
+			if _, ok := fields[name]; !ok {
+				fields[name] = fieldType
 			}
 		}
-	default:
-		output = value.Interface()
 	}
-	return output, nil
 }
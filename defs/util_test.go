@@ -0,0 +1,147 @@
+package defs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+type namedString string
+
+func (str namedString) String() string {
+	return string(str)
+}
+
+type resolveTarget struct {
+	Any       any
+	Stringer  interface{ String() string }
+	Named     namedString
+	Skipped   string `template:"-"`
+	Pointer   *string
+	Shared    *string
+	Map       map[string]any
+	Slice     []any
+	Prefix    []any
+	unexposed string
+}
+
+// upperResolver upper-cases the strings. A native {{ n }} resolves to 42.
+func upperResolver(str string, native bool) (any, error) {
+	if native && str == "{{ n }}" {
+		return 42, nil
+	}
+	return strings.ToUpper(str), nil
+}
+
+func identityResolver(str string, native bool) (any, error) {
+	return str, nil
+}
+
+func TestResolveVars(t *testing.T) {
+	pointed := "pointed"
+	slice := []any{"a", "b", "c"}
+	input := resolveTarget{
+		Any:       "{{ n }}",
+		Stringer:  namedString("{{ n }}"),
+		Named:     "named",
+		Skipped:   "skipped",
+		Pointer:   &pointed,
+		Shared:    &pointed,
+		Map:       map[string]any{"key": "{{ n }}", "nil": nil},
+		Slice:     slice,
+		Prefix:    slice[:2],
+		unexposed: "unexposed",
+	}
+	output, err := ResolveVars(input, upperResolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{"native in an empty interface", output.Any, 42},
+		{"named string in a non-empty interface", output.Stringer, namedString("{{ N }}")},
+		{"named string", output.Named, namedString("NAMED")},
+		{"skipped field", output.Skipped, "skipped"},
+		{"unexported field", output.unexposed, "unexposed"},
+		{"pointer", *output.Pointer, "POINTED"},
+		{"shared pointer", output.Shared == output.Pointer, true},
+		{"native in a map", output.Map["key"], 42},
+		{"nil interface in a map", output.Map["nil"], nil},
+		{"slice", output.Slice, []any{"A", "B", "C"}},
+		{"aliased slice of a different length", output.Prefix, []any{"A", "B"}},
+	}
+	for _, test := range tests {
+		if !reflect.DeepEqual(test.got, test.want) {
+			t.Errorf("%s = %#v, want %#v", test.name, test.got, test.want)
+		}
+	}
+	if pointed != "pointed" || slice[0] != "a" || input.Map["key"] != "{{ n }}" {
+		t.Errorf("input is modified")
+	}
+}
+
+func TestResolveVarsCycles(t *testing.T) {
+	cyclic := map[string]any{"name": "cycle"}
+	cyclic["self"] = cyclic
+	output, err := ResolveVars(cyclic, upperResolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output["name"] != "CYCLE" {
+		t.Errorf("name = %v, want CYCLE", output["name"])
+	}
+	self, ok := output["self"].(map[string]any)
+	if !ok || reflect.ValueOf(self).Pointer() != reflect.ValueOf(output).Pointer() {
+		t.Errorf("self is not the resolved map")
+	}
+}
+
+func TestResolveVarsNil(t *testing.T) {
+	output, err := ResolveVars[any](nil, upperResolver)
+	if err != nil || output != nil {
+		t.Errorf("ResolveVars(nil) = %v, %v", output, err)
+	}
+	var config Config
+	resolved, err := ResolveVars(config, upperResolver)
+	if err != nil || resolved != nil {
+		t.Errorf("ResolveVars(nil map) = %v, %v", resolved, err)
+	}
+}
+
+type quickTarget struct {
+	Name    string
+	Count   int
+	Ratio   float64
+	Enabled bool
+	Names   []string
+	Labels  map[string]string
+	Pointer *string
+	Nested  []quickNested
+	Array   [3]string
+}
+
+type quickNested struct {
+	Value  string
+	Values map[string][]string
+}
+
+func TestResolveVarsRoundTrip(t *testing.T) {
+	roundTrip := func(input quickTarget) bool {
+		output, err := ResolveVars(input, identityResolver)
+		if err != nil || !reflect.DeepEqual(input, output) {
+			return false
+		}
+		// The output is a deep copy.
+		if input.Pointer != nil && input.Pointer == output.Pointer {
+			return false
+		}
+		return len(input.Names) == 0 || &input.Names[0] != &output.Names[0]
+	}
+	if err := quick.Check(roundTrip, nil); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,172 @@
+package inventory
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ParseINI parses the inventory in the INI format.
+//
+//	host1 ansible_host=10.0.0.1
+//	[web]
+//	node[01:03] http_port=80
+//	[web:vars]
+//	proxy=proxy.example.com
+//	[cluster:children]
+//	web
+func (inventory *Inventory) ParseINI(data []byte) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	groupName := UngroupedGroup
+	section := "hosts"
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			groupName, section, _ = strings.Cut(line[1:len(line)-1], ":")
+			groupName = strings.TrimSpace(groupName)
+			if section == "" {
+				section = "hosts"
+			}
+			if section != "hosts" && section != "vars" && section != "children" {
+				return fmt.Errorf("Line %d: invalid section type %s", lineNumber, section)
+			}
+			inventory.AddGroup(groupName)
+			continue
+		}
+		var err error
+		switch section {
+		case "hosts":
+			err = inventory.parseINIHostLine(line, groupName)
+		case "vars":
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				err = fmt.Errorf("Variable %s must be in the form of key=value", line)
+				break
+			}
+			inventory.groups[groupName].Vars[strings.TrimSpace(key)] = parseINIValue(strings.TrimSpace(value))
+		case "children":
+			err = inventory.AddChild(groupName, line)
+		}
+		if err != nil {
+			return fmt.Errorf("Line %d: %w", lineNumber, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	inventory.reconcile()
+	return nil
+}
+
+func (inventory *Inventory) parseINIHostLine(line string, groupName string) error {
+	tokens, err := splitINILine(line)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return nil
+	}
+	vars := map[string]any{}
+	for _, token := range tokens[1:] {
+		key, value, ok := strings.Cut(token, "=")
+		if !ok {
+			return fmt.Errorf("Host variable %s must be in the form of key=value", token)
+		}
+		vars[key] = parseINIValue(value)
+	}
+	return inventory.addHosts(tokens[0], groupName, vars)
+}
+
+// addHosts adds the hosts in the pattern which may have ranges and a port.
+func (inventory *Inventory) addHosts(pattern string, groupName string, vars map[string]any) error {
+	names, err := expandHostRanges(pattern)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		name, port, ok := splitHostPort(name)
+		host := inventory.AddHost(name, groupName)
+		if ok {
+			host.Vars["ansible_port"] = port
+		}
+		for key, value := range vars {
+			host.Vars[key] = value
+		}
+	}
+	return nil
+}
+
+// splitINILine splits the line by spaces except the ones in quotes. A # after a space starts a comment.
+func splitINILine(line string) ([]string, error) {
+	tokens := []string{}
+	var sb strings.Builder
+	var quote rune
+	inToken := false
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			sb.WriteRune(r)
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote, inToken = r, true
+			sb.WriteRune(r)
+		case r == ' ' || r == '\t':
+			if inToken {
+				tokens = append(tokens, sb.String())
+				sb.Reset()
+				inToken = false
+			}
+		case r == '#' && !inToken:
+			return tokens, nil
+		default:
+			sb.WriteRune(r)
+			inToken = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("Unbalanced quote in %s", line)
+	}
+	if inToken {
+		tokens = append(tokens, sb.String())
+	}
+	return tokens, nil
+}
+
+// parseINIValue parses the value like a Python literal. The value is a string if it is not a literal.
+func parseINIValue(value string) any {
+	if len(value) >= 2 && (value[0] == '\'' || value[0] == '"') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	switch value {
+	case "True":
+		return true
+	case "False":
+		return false
+	case "None":
+		return nil
+	}
+	if i, err := strconv.Atoi(value); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return f
+	}
+	if strings.HasPrefix(value, "[") || strings.HasPrefix(value, "{") {
+		var v any
+		if err := yaml.Unmarshal([]byte(value), &v); err == nil {
+			return v
+		}
+	}
+	return value
+}
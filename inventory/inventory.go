@@ -0,0 +1,461 @@
+package inventory
+
+import (
+	"fmt"
+	"goparse/defs"
+	"os"
+	fp "path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// AllGroup is the group of all the hosts.
+	AllGroup = "all"
+	// UngroupedGroup is the group of the hosts which are only in the all group.
+	UngroupedGroup = "ungrouped"
+)
+
+var (
+	// Files in an inventory directory which are not inventories.
+	ignoredExtensions = []string{"~", ".orig", ".bak", ".ini~", ".cfg", ".retry", ".pyc", ".pyo", ".md", ".txt"}
+	// Names of the implicit localhost which is not in the inventory.
+	localhostNames = []string{"localhost", "127.0.0.1", "::1"}
+)
+
+// Host is a host in the inventory.
+type Host struct {
+	Name string
+	Vars defs.Config
+	// Groups are the groups which the host is directly in.
+	Groups []string
+}
+
+// Group is a group of hosts and child groups.
+type Group struct {
+	Name     string
+	Vars     defs.Config
+	Hosts    []string
+	Children []string
+	Parents  []string
+}
+
+// Inventory is the hosts and the groups.
+type Inventory struct {
+	hosts  map[string]*Host
+	groups map[string]*Group
+	// Host names in the order in which they are added.
+	hostNames []string
+	// Sources are the files or directories from which the inventory is loaded.
+	sources []string
+	// Directories from which group_vars and host_vars are loaded.
+	varsDirs []string
+	// Implicit localhost entries which have host_vars.
+	implicitHosts map[string]*Host
+}
+
+// New returns an empty inventory with the all and ungrouped groups.
+func New() *Inventory {
+	inventory := &Inventory{
+		hosts:         map[string]*Host{},
+		groups:        map[string]*Group{},
+		implicitHosts: map[string]*Host{},
+	}
+	inventory.AddGroup(AllGroup)
+	inventory.AddChild(AllGroup, UngroupedGroup)
+	return inventory
+}
+
+// Load loads the inventory from the files, the directories or the executable scripts.
+// The group_vars and host_vars directories next to the inventory files are loaded after all the inventories.
+func Load(paths ...string) (*Inventory, error) {
+	inventory := New()
+	for _, path := range paths {
+		err := inventory.Load(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, path := range paths {
+		dir := path
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			dir = fp.Dir(path)
+		}
+		err := inventory.LoadVarsDir(dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return inventory, nil
+}
+
+// Load loads the file, the directory or the executable script into the inventory.
+// The format of a file is detected by the extension. A file without a YAML or JSON
+// extension is parsed as INI unless it is executable.
+func (inventory *Inventory) Load(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		err = inventory.loadFile(path, info)
+		if err != nil {
+			return fmt.Errorf("Failed to load inventory %s: %w", path, err)
+		}
+		inventory.sources = append(inventory.sources, path)
+		return nil
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") || name == "group_vars" || name == "host_vars" || isIgnoredFile(name) {
+			continue
+		}
+		err = inventory.Load(fp.Join(path, name))
+		if err != nil {
+			return err
+		}
+	}
+	inventory.sources = append(inventory.sources, path)
+	return nil
+}
+
+func (inventory *Inventory) loadFile(path string, info os.FileInfo) error {
+	ext := strings.ToLower(fp.Ext(path))
+	if ext == ".yml" || ext == ".yaml" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return inventory.ParseYAML(data)
+	}
+	if ext == ".json" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return inventory.ParseJSON(data)
+	}
+	if info.Mode()&0111 != 0 {
+		return inventory.LoadScript(path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return inventory.ParseINI(data)
+}
+
+func isIgnoredFile(name string) bool {
+	for _, ext := range ignoredExtensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsLocalhost returns true if the name is a name of the implicit localhost.
+func IsLocalhost(name string) bool {
+	return contains(localhostNames, name)
+}
+
+// Sources returns the files and the directories from which the inventory is loaded.
+func (inventory *Inventory) Sources() []string {
+	return inventory.sources
+}
+
+// AddGroup adds the group if it does not exist.
+func (inventory *Inventory) AddGroup(name string) *Group {
+	group, ok := inventory.groups[name]
+	if !ok {
+		group = &Group{Name: name, Vars: defs.Config{}}
+		inventory.groups[name] = group
+	}
+	return group
+}
+
+// AddHost adds the host to the group if it is not empty. The host is created if it does not exist.
+func (inventory *Inventory) AddHost(name string, groupName string) *Host {
+	host, ok := inventory.hosts[name]
+	if !ok {
+		host = &Host{Name: name, Vars: defs.Config{}}
+		inventory.hosts[name] = host
+		inventory.hostNames = append(inventory.hostNames, name)
+	}
+	if groupName != "" && groupName != AllGroup {
+		group := inventory.AddGroup(groupName)
+		if !contains(group.Hosts, name) {
+			group.Hosts = append(group.Hosts, name)
+			host.Groups = append(host.Groups, groupName)
+		}
+	}
+	return host
+}
+
+// AddChild adds the child group to the parent group. The groups are created if they do not exist.
+func (inventory *Inventory) AddChild(parentName, childName string) error {
+	if parentName == childName {
+		return fmt.Errorf("Group %s cannot be a child of itself", parentName)
+	}
+	parent := inventory.AddGroup(parentName)
+	child := inventory.AddGroup(childName)
+	if contains(parent.Children, childName) {
+		return nil
+	}
+	if inventory.isDescendant(childName, parentName) {
+		return fmt.Errorf("Adding group %s to %s makes a cycle", childName, parentName)
+	}
+	parent.Children = append(parent.Children, childName)
+	child.Parents = append(child.Parents, parentName)
+	return nil
+}
+
+// isDescendant returns true if the group is a descendant of the ancestor or the ancestor itself.
+func (inventory *Inventory) isDescendant(ancestorName, name string) bool {
+	if ancestorName == name {
+		return true
+	}
+	ancestor, ok := inventory.groups[ancestorName]
+	if !ok {
+		return false
+	}
+	for _, child := range ancestor.Children {
+		if inventory.isDescendant(child, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcile adds the groups without parents to the all group
+// and the hosts without groups to the ungrouped group.
+func (inventory *Inventory) reconcile() {
+	for name, group := range inventory.groups {
+		if name != AllGroup && len(group.Parents) == 0 {
+			inventory.AddChild(AllGroup, name)
+		}
+	}
+	ungrouped := inventory.groups[UngroupedGroup]
+	for _, name := range inventory.hostNames {
+		host := inventory.hosts[name]
+		if len(host.Groups) == 0 {
+			inventory.AddHost(name, UngroupedGroup)
+		} else if len(host.Groups) > 1 && contains(host.Groups, UngroupedGroup) {
+			// The host is added to another group later.
+			host.Groups = remove(host.Groups, UngroupedGroup)
+			ungrouped.Hosts = remove(ungrouped.Hosts, name)
+		}
+	}
+}
+
+// Host returns the host. The implicit localhost is returned for the local names
+// if it is not in the inventory.
+func (inventory *Inventory) Host(name string) (*Host, bool) {
+	if host, ok := inventory.hosts[name]; ok {
+		return host, true
+	}
+	if contains(localhostNames, name) {
+		host := &Host{Name: name, Vars: defs.Config{"ansible_connection": "local"}}
+		if implicit, ok := inventory.implicitHosts[name]; ok {
+			for key, value := range implicit.Vars {
+				host.Vars[key] = value
+			}
+		}
+		return host, true
+	}
+	return nil, false
+}
+
+// Group returns the group.
+func (inventory *Inventory) Group(name string) (*Group, bool) {
+	group, ok := inventory.groups[name]
+	return group, ok
+}
+
+// HostNames returns the names of all the hosts in the order in which they are added.
+func (inventory *Inventory) HostNames() []string {
+	return append([]string{}, inventory.hostNames...)
+}
+
+// GroupNames returns the names of all the groups sorted.
+func (inventory *Inventory) GroupNames() []string {
+	names := make([]string, 0, len(inventory.groups))
+	for name := range inventory.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GroupHosts returns the hosts in the group and its descendants in the inventory order.
+func (inventory *Inventory) GroupHosts(name string) []string {
+	if name == AllGroup {
+		return inventory.HostNames()
+	}
+	members := map[string]struct{}{}
+	inventory.collectGroupHosts(name, members, map[string]struct{}{})
+	hosts := []string{}
+	for _, host := range inventory.hostNames {
+		if _, ok := members[host]; ok {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+func (inventory *Inventory) collectGroupHosts(name string, members map[string]struct{}, visited map[string]struct{}) {
+	if _, ok := visited[name]; ok {
+		return
+	}
+	visited[name] = struct{}{}
+	group, ok := inventory.groups[name]
+	if !ok {
+		return
+	}
+	for _, host := range group.Hosts {
+		members[host] = struct{}{}
+	}
+	for _, child := range group.Children {
+		inventory.collectGroupHosts(child, members, visited)
+	}
+}
+
+// HostGroups returns the groups of the host including the ancestors sorted by
+// the depth and then by the name. The all group is the first.
+func (inventory *Inventory) HostGroups(name string) []string {
+	host, ok := inventory.hosts[name]
+	if !ok {
+		// The implicit localhost has only the vars of the all group.
+		return []string{AllGroup}
+	}
+	groups := map[string]struct{}{}
+	for _, group := range host.Groups {
+		inventory.collectAncestors(group, groups)
+	}
+	groups[AllGroup] = struct{}{}
+	names := make([]string, 0, len(groups))
+	depths := map[string]int{}
+	for group := range groups {
+		names = append(names, group)
+		depths[group] = inventory.depth(group)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if depths[names[i]] != depths[names[j]] {
+			return depths[names[i]] < depths[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+func (inventory *Inventory) collectAncestors(name string, groups map[string]struct{}) {
+	if _, ok := groups[name]; ok {
+		return
+	}
+	groups[name] = struct{}{}
+	if group, ok := inventory.groups[name]; ok {
+		for _, parent := range group.Parents {
+			inventory.collectAncestors(parent, groups)
+		}
+	}
+}
+
+// depth returns the length of the longest path from the all group.
+func (inventory *Inventory) depth(name string) int {
+	group, ok := inventory.groups[name]
+	if !ok || len(group.Parents) == 0 {
+		return 0
+	}
+	depth := 0
+	for _, parent := range group.Parents {
+		if d := inventory.depth(parent) + 1; d > depth {
+			depth = d
+		}
+	}
+	return depth
+}
+
+// HostVars returns the vars of the groups of the host merged with the vars of the host.
+// The vars of a child group take precedence over the vars of its parent groups.
+func (inventory *Inventory) HostVars(name string) defs.Config {
+	vars := defs.Config{}
+	for _, groupName := range inventory.HostGroups(name) {
+		for key, value := range inventory.groups[groupName].Vars {
+			vars[key] = value
+		}
+	}
+	if host, ok := inventory.Host(name); ok {
+		for key, value := range host.Vars {
+			vars[key] = value
+		}
+	}
+	return vars
+}
+
+// Variables returns the variables of the host including the magic variables
+// inventory_hostname, group_names, groups and hostvars.
+func (inventory *Inventory) Variables(name string) defs.Config {
+	hostVars := map[string]any{}
+	for _, hostName := range inventory.hostNames {
+		vars := inventory.HostVars(hostName)
+		inventory.addHostMagicVars(hostName, vars)
+		hostVars[hostName] = vars
+	}
+	vars := inventory.HostVars(name)
+	inventory.addHostMagicVars(name, vars)
+	if _, ok := hostVars[name]; !ok {
+		// The implicit localhost.
+		hostVars[name] = vars
+	}
+	groups := map[string]any{}
+	for groupName := range inventory.groups {
+		groups[groupName] = toAnySlice(inventory.GroupHosts(groupName))
+	}
+	vars["groups"] = groups
+	vars["hostvars"] = hostVars
+	return vars
+}
+
+func (inventory *Inventory) addHostMagicVars(name string, vars defs.Config) {
+	groupNames := []any{}
+	for _, group := range inventory.HostGroups(name) {
+		if group != AllGroup {
+			groupNames = append(groupNames, group)
+		}
+	}
+	sort.Slice(groupNames, func(i, j int) bool { return groupNames[i].(string) < groupNames[j].(string) })
+	vars["inventory_hostname"] = name
+	vars["inventory_hostname_short"] = strings.SplitN(name, ".", 2)[0]
+	vars["group_names"] = groupNames
+}
+
+func contains(list []string, item string) bool {
+	for _, value := range list {
+		if value == item {
+			return true
+		}
+	}
+	return false
+}
+
+func remove(list []string, item string) []string {
+	result := make([]string, 0, len(list))
+	for _, value := range list {
+		if value != item {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+func toAnySlice(list []string) []any {
+	result := make([]any, 0, len(list))
+	for _, value := range list {
+		result = append(result, value)
+	}
+	return result
+}
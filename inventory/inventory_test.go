@@ -0,0 +1,332 @@
+package inventory
+
+import (
+	"goparse/defs"
+	"os"
+	fp "path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const iniInventory = `
+# Comment
+local ansible_connection=local
+[web]
+node[01:03] http_port=80
+db.example.com:2222 motd="hello world"  # comment
+
+[web:vars]
+proxy=proxy.example.com
+enabled=True
+ratio=0.5
+tags=['a', 'b']
+
+[cluster:children]
+web
+`
+
+const yamlInventory = `
+all:
+  hosts:
+    local:
+      ansible_connection: local
+  children:
+    cluster:
+      children:
+        web:
+          hosts:
+            node[01:03]:
+              http_port: 80
+            db.example.com:
+              ansible_port: 2222
+              motd: hello world
+          vars:
+            proxy: proxy.example.com
+            enabled: true
+            ratio: 0.5
+            tags: [a, b]
+`
+
+const jsonInventory = `{
+  "web": {"hosts": ["node[01:03]", "db.example.com"], "vars": {"proxy": "proxy.example.com", "enabled": true, "ratio": 0.5, "tags": ["a", "b"]}},
+  "cluster": {"children": ["web"]},
+  "ungrouped": ["local"],
+  "_meta": {"hostvars": {
+    "local": {"ansible_connection": "local"},
+    "node01": {"http_port": 80}, "node02": {"http_port": 80}, "node03": {"http_port": 80},
+    "db.example.com": {"ansible_port": 2222, "motd": "hello world"}
+  }}
+}`
+
+// checkInventory checks the inventory parsed from any of the formats above.
+func checkInventory(t *testing.T, inventory *Inventory) {
+	t.Helper()
+	if got, want := inventory.GroupHosts("web"), []string{"node01", "node02", "node03", "db.example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("web hosts = %v, want %v", got, want)
+	}
+	if got, want := inventory.GroupHosts("cluster"), inventory.GroupHosts("web"); !reflect.DeepEqual(got, want) {
+		t.Errorf("cluster hosts = %v, want %v", got, want)
+	}
+	if got, want := inventory.GroupHosts(UngroupedGroup), []string{"local"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ungrouped hosts = %v, want %v", got, want)
+	}
+	if got := len(inventory.GroupHosts(AllGroup)); got != 5 {
+		t.Errorf("all has %d hosts, want 5", got)
+	}
+	vars := inventory.HostVars("node02")
+	want := map[string]any{"http_port": 80, "proxy": "proxy.example.com", "enabled": true, "ratio": 0.5, "tags": []any{"a", "b"}}
+	for key, value := range want {
+		if !reflect.DeepEqual(vars[key], value) {
+			t.Errorf("node02 %s = %#v, want %#v", key, vars[key], value)
+		}
+	}
+	vars = inventory.HostVars("db.example.com")
+	if vars["ansible_port"] != 2222 || vars["motd"] != "hello world" {
+		t.Errorf("db.example.com vars = %v", vars)
+	}
+	if got := inventory.HostVars("local")["ansible_connection"]; got != "local" {
+		t.Errorf("local connection = %v", got)
+	}
+}
+
+func TestParseINI(t *testing.T) {
+	inventory := New()
+	err := inventory.ParseINI([]byte(iniInventory))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInventory(t, inventory)
+}
+
+func TestParseYAML(t *testing.T) {
+	inventory := New()
+	err := inventory.ParseYAML([]byte(yamlInventory))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInventory(t, inventory)
+}
+
+func TestParseJSON(t *testing.T) {
+	inventory := New()
+	err := inventory.ParseJSON([]byte(jsonInventory))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInventory(t, inventory)
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]func(*Inventory) error{
+		"invalid section": func(inventory *Inventory) error {
+			return inventory.ParseINI([]byte("[web:other]\nhost\n"))
+		},
+		"invalid vars": func(inventory *Inventory) error {
+			return inventory.ParseINI([]byte("[web:vars]\nnot a var\n"))
+		},
+		"invalid host var": func(inventory *Inventory) error {
+			return inventory.ParseINI([]byte("host novalue\n"))
+		},
+		"unbalanced quote": func(inventory *Inventory) error {
+			return inventory.ParseINI([]byte("host motd='hello\n"))
+		},
+		"invalid range": func(inventory *Inventory) error {
+			return inventory.ParseINI([]byte("node[3:1]\n"))
+		},
+		"child cycle": func(inventory *Inventory) error {
+			return inventory.ParseINI([]byte("[a:children]\nb\n[b:children]\na\n"))
+		},
+		"invalid YAML key": func(inventory *Inventory) error {
+			return inventory.ParseYAML([]byte("all:\n  members: []\n"))
+		},
+		"invalid JSON group": func(inventory *Inventory) error {
+			return inventory.ParseJSON([]byte(`{"web": "node01"}`))
+		},
+	}
+	for name, parse := range tests {
+		if err := parse(New()); err == nil {
+			t.Errorf("%s: parse succeeded", name)
+		}
+	}
+}
+
+func TestExpandHostRanges(t *testing.T) {
+	tests := map[string][]string{
+		"node":             {"node"},
+		"node[1:3]":        {"node1", "node2", "node3"},
+		"node[01:10:4]":    {"node01", "node05", "node09"},
+		"db-[a:c]":         {"db-a", "db-b", "db-c"},
+		"r[1:2]-[x:y].lan": {"r1-x.lan", "r1-y.lan", "r2-x.lan", "r2-y.lan"},
+	}
+	for pattern, want := range tests {
+		got, err := expandHostRanges(pattern)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("expandHostRanges(%q) = %v, %v, want %v", pattern, got, err, want)
+		}
+	}
+	for _, pattern := range []string{"node[01:100]", "node[a:1]", "node[1:3:0]", "node[ab:c]"} {
+		if _, err := expandHostRanges(pattern); err == nil {
+			t.Errorf("expandHostRanges(%q) succeeded", pattern)
+		}
+	}
+}
+
+func TestSplitHostPort(t *testing.T) {
+	tests := []struct {
+		host string
+		name string
+		port int
+		ok   bool
+	}{
+		{"host", "host", 0, false},
+		{"host:2222", "host", 2222, true},
+		{"[::1]:2222", "::1", 2222, true},
+		{"fe80::1", "fe80::1", 0, false},
+		{"host:ssh", "host:ssh", 0, false},
+	}
+	for _, test := range tests {
+		name, port, ok := splitHostPort(test.host)
+		if name != test.name || port != test.port || ok != test.ok {
+			t.Errorf("splitHostPort(%q) = %q, %d, %v", test.host, name, port, ok)
+		}
+	}
+}
+
+func TestVariables(t *testing.T) {
+	inventory := New()
+	err := inventory.ParseINI([]byte(iniInventory))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := inventory.Variables("db.example.com")
+	if vars["inventory_hostname"] != "db.example.com" || vars["inventory_hostname_short"] != "db" {
+		t.Errorf("inventory_hostname = %v, %v", vars["inventory_hostname"], vars["inventory_hostname_short"])
+	}
+	if got, want := vars["group_names"], []any{"cluster", "web"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("group_names = %v, want %v", got, want)
+	}
+	groups := vars["groups"].(map[string]any)
+	if got, want := groups["ungrouped"], []any{"local"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("groups.ungrouped = %v, want %v", got, want)
+	}
+	hostVars := vars["hostvars"].(map[string]any)
+	if got := hostVars["node01"].(defs.Config)["http_port"]; got != 80 {
+		t.Errorf("hostvars.node01.http_port = %v", got)
+	}
+	// The implicit localhost has the magic variables too.
+	vars = inventory.Variables("localhost")
+	hostVars = vars["hostvars"].(map[string]any)
+	if vars["inventory_hostname"] != "localhost" || hostVars["localhost"] == nil {
+		t.Errorf("localhost variables = %v", vars)
+	}
+}
+
+func TestLoadScript(t *testing.T) {
+	dir := t.TempDir()
+	script := fp.Join(dir, "inventory.sh")
+	err := os.WriteFile(script, []byte(`#!/bin/sh
+if [ "$1" = --list ]; then
+  echo '{"web": ["node01", "node02"]}'
+else
+  echo "{\"host_id\": \"$2\"}"
+fi
+`), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inventory := New()
+	err = inventory.LoadScript(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := inventory.GroupHosts("web"), []string{"node01", "node02"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("web hosts = %v, want %v", got, want)
+	}
+	if got := inventory.HostVars("node02")["host_id"]; got != "node02" {
+		t.Errorf("node02 host_id = %v", got)
+	}
+}
+
+// writeFiles writes the files by the paths relative to the directory.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := fp.Join(dir, name)
+		err := os.MkdirAll(fp.Dir(path), 0755)
+		if err == nil {
+			err = os.WriteFile(path, []byte(content), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadVarsDir(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"inventory/hosts": `
+h1
+[child]
+h1
+h2
+[child:vars]
+c=ini
+[parent:children]
+child
+`,
+		"inventory/group_vars/all.yml":            "{a: all, b: all, c: all, d: all, source: inventory}\n",
+		"inventory/group_vars/parent.yaml":        "{b: parent, c: parent, d: parent}\n",
+		"inventory/group_vars/child.json":         `{"c": "child", "d": "child"}`,
+		"inventory/host_vars/h1/10-base.yml":      "{d: host, e: first}\n",
+		"inventory/host_vars/h1/20-override.yaml": "{e: second}\n",
+		"inventory/host_vars/h1/.hidden.yml":      "{e: hidden}\n",
+		"inventory/host_vars/h1/notes.txt":        "e: ignored\n",
+		"inventory/host_vars/localhost":           "local: true\n",
+		"inventory/group_vars/missing.yml":        "{missing: true}\n",
+		"playbook/group_vars/all.yml":             "{source: playbook}\n",
+		"playbook/group_vars/child.yml":           "{c: playbook}\n",
+		"playbook/host_vars/h2.yml":               "{d: playbook}\n",
+	})
+	inventory, err := Load(fp.Join(dir, "inventory", "hosts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = inventory.LoadVarsDir(fp.Join(dir, "playbook"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		host string
+		want map[string]any
+	}{
+		// all < parent group < child group < host, the playbook dir over the inventory dir.
+		{"h1", map[string]any{"a": "all", "b": "parent", "c": "playbook", "d": "host", "e": "second", "source": "playbook"}},
+		{"h2", map[string]any{"a": "all", "b": "parent", "c": "playbook", "d": "playbook", "e": nil, "source": "playbook"}},
+		{"localhost", map[string]any{"a": "all", "local": true, "source": "playbook"}},
+	}
+	for _, test := range tests {
+		vars := inventory.Variables(test.host)
+		for key, want := range test.want {
+			if got := vars[key]; got != want {
+				t.Errorf("%s %s = %v, want %v", test.host, key, got, want)
+			}
+		}
+		if _, ok := vars["missing"]; ok {
+			t.Errorf("%s has the vars of a group which is not in the inventory", test.host)
+		}
+	}
+}
+
+func TestLoadVarsDirErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"hosts":                 "h1\n",
+		"host_vars/h1/bad.json": `{"a": `,
+	})
+	_, err := Load(fp.Join(dir, "hosts"))
+	if err == nil || !strings.Contains(err.Error(), "bad.json") {
+		t.Errorf("Load = %v, want an error with the vars file", err)
+	}
+}
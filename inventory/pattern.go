@@ -0,0 +1,194 @@
+package inventory
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// A subscript like web[0] or web[1:3] selects the hosts of a pattern by the index.
+	hostSubscriptPattern = regexp.MustCompile(`^(.+)\[(-?[0-9]*)(?::(-?[0-9]*))?\]$`)
+)
+
+// MatchHosts returns the hosts matching the pattern. The pattern is a list of terms separated by
+// commas or colons. A term is all, a host, a group, a wildcard or a regular expression starting with ~,
+// and it may have a subscript like web[0] or web[1:3]. A term starting with & intersects the hosts and
+// a term starting with ! excludes the hosts. The implicit localhost matches only by the name.
+func (inventory *Inventory) MatchHosts(pattern string) ([]string, error) {
+	hosts := []string{}
+	var intersections [][]string
+	var exclusions [][]string
+	for _, term := range splitHostPattern(pattern) {
+		operator := term[0]
+		if operator == '&' || operator == '!' {
+			term = strings.TrimSpace(term[1:])
+		}
+		matched, err := inventory.matchHostTerm(term)
+		if err != nil {
+			return nil, err
+		}
+		switch operator {
+		case '&':
+			intersections = append(intersections, matched)
+		case '!':
+			exclusions = append(exclusions, matched)
+		default:
+			for _, host := range matched {
+				if !contains(hosts, host) {
+					hosts = append(hosts, host)
+				}
+			}
+		}
+	}
+	result := []string{}
+	for _, host := range hosts {
+		ok := true
+		for _, matched := range intersections {
+			ok = ok && contains(matched, host)
+		}
+		for _, matched := range exclusions {
+			ok = ok && !contains(matched, host)
+		}
+		if ok {
+			result = append(result, host)
+		}
+	}
+	return result, nil
+}
+
+// splitHostPattern splits the pattern by commas, or by colons if it has no commas.
+// The colons in subscripts and IPv6 addresses are not separators.
+func splitHostPattern(pattern string) []string {
+	separator := ':'
+	if strings.Contains(pattern, ",") {
+		separator = ','
+	} else if net.ParseIP(strings.TrimSpace(pattern)) != nil {
+		return []string{strings.TrimSpace(pattern)}
+	}
+	terms := []string{}
+	depth := 0
+	start := 0
+	for i, r := range pattern {
+		switch {
+		case r == '[':
+			depth++
+		case r == ']':
+			depth--
+		case r == separator && depth == 0:
+			terms = append(terms, pattern[start:i])
+			start = i + 1
+		}
+	}
+	terms = append(terms, pattern[start:])
+	result := []string{}
+	for _, term := range terms {
+		if term = strings.TrimSpace(term); term != "" {
+			result = append(result, term)
+		}
+	}
+	return result
+}
+
+func (inventory *Inventory) matchHostTerm(term string) ([]string, error) {
+	if match := hostSubscriptPattern.FindStringSubmatch(term); match != nil && !strings.HasPrefix(term, "~") {
+		hosts, err := inventory.matchHostTerm(match[1])
+		if err != nil {
+			return nil, err
+		}
+		return subscriptHosts(hosts, term, match[2], match[3], strings.Contains(term[len(match[1]):], ":"))
+	}
+	if term == AllGroup || term == "*" {
+		return inventory.HostNames(), nil
+	}
+	if strings.HasPrefix(term, "~") {
+		// The expression matches from the beginning of the names as Python re.match does.
+		re, err := regexp.Compile("^(?:" + term[1:] + ")")
+		if err != nil {
+			return nil, fmt.Errorf("Invalid host pattern %s: %w", term, err)
+		}
+		return inventory.matchHostNames(func(name string) bool { return re.MatchString(name) }), nil
+	}
+	if strings.ContainsAny(term, "*?[") {
+		if _, err := path.Match(term, ""); err != nil {
+			return nil, fmt.Errorf("Invalid host pattern %s: %w", term, err)
+		}
+		return inventory.matchHostNames(func(name string) bool {
+			ok, _ := path.Match(term, name)
+			return ok
+		}), nil
+	}
+	if _, ok := inventory.groups[term]; ok {
+		return inventory.GroupHosts(term), nil
+	}
+	if _, ok := inventory.Host(term); ok {
+		return []string{term}, nil
+	}
+	return []string{}, nil
+}
+
+// matchHostNames returns the hosts whose names match and the hosts in the groups whose names match.
+func (inventory *Inventory) matchHostNames(match func(string) bool) []string {
+	members := map[string]struct{}{}
+	for name := range inventory.groups {
+		if match(name) {
+			for _, host := range inventory.GroupHosts(name) {
+				members[host] = struct{}{}
+			}
+		}
+	}
+	hosts := []string{}
+	for _, host := range inventory.hostNames {
+		if _, ok := members[host]; ok || match(host) {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// subscriptHosts returns the host at the index or the hosts in the inclusive range.
+func subscriptHosts(hosts []string, term, startStr, endStr string, isRange bool) ([]string, error) {
+	index := func(str string, defaultValue int) (int, error) {
+		if str == "" {
+			return defaultValue, nil
+		}
+		i, err := strconv.Atoi(str)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid subscript in host pattern %s", term)
+		}
+		if i < 0 {
+			i += len(hosts)
+		}
+		return i, nil
+	}
+	start, err := index(startStr, 0)
+	if err != nil {
+		return nil, err
+	}
+	if !isRange {
+		if startStr == "" {
+			return nil, fmt.Errorf("Invalid subscript in host pattern %s", term)
+		}
+		if start < 0 || start >= len(hosts) {
+			return []string{}, nil
+		}
+		return []string{hosts[start]}, nil
+	}
+	end, err := index(endStr, len(hosts)-1)
+	if err != nil {
+		return nil, err
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end >= len(hosts) {
+		end = len(hosts) - 1
+	}
+	if start > end {
+		return []string{}, nil
+	}
+	return append([]string{}, hosts[start:end+1]...), nil
+}
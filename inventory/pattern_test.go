@@ -0,0 +1,84 @@
+package inventory
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchHosts(t *testing.T) {
+	inventory := New()
+	err := inventory.ParseINI([]byte(`
+local
+[web]
+web[1:3]
+[db]
+db1
+db2
+[east]
+web1
+db1
+[cluster:children]
+web
+db
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string][]string{
+		"all":             {"local", "web1", "web2", "web3", "db1", "db2"},
+		"*":               {"local", "web1", "web2", "web3", "db1", "db2"},
+		"web":             {"web1", "web2", "web3"},
+		"db2":             {"db2"},
+		"web:db":          {"web1", "web2", "web3", "db1", "db2"},
+		"web,db1":         {"web1", "web2", "web3", "db1"},
+		"cluster:&east":   {"web1", "db1"},
+		"cluster:!east":   {"web2", "web3", "db2"},
+		"all:!cluster":    {"local"},
+		"web*":            {"web1", "web2", "web3"},
+		"*1":              {"web1", "db1"},
+		"web?":            {"web1", "web2", "web3"},
+		"~(web|db)[12]":   {"web1", "web2", "db1", "db2"},
+		"~eb":             {},
+		"e*":              {"web1", "db1"},
+		"web[0]":          {"web1"},
+		"web[-1]":         {"web3"},
+		"web[1:]":         {"web2", "web3"},
+		"web[:1]":         {"web1", "web2"},
+		"web[5]":          {},
+		"web[0:1],db[-1]": {"web1", "web2", "db2"},
+		"missing":         {},
+		"localhost":       {"localhost"},
+		" web , !web2 ":   {"web1", "web3"},
+	}
+	for pattern, want := range tests {
+		got, err := inventory.MatchHosts(pattern)
+		if err != nil {
+			t.Errorf("MatchHosts(%q) failed: %v", pattern, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("MatchHosts(%q) = %v, want %v", pattern, got, want)
+		}
+	}
+	for _, pattern := range []string{"~(web", "web[]", "[web"} {
+		if _, err := inventory.MatchHosts(pattern); err == nil {
+			t.Errorf("MatchHosts(%q) succeeded", pattern)
+		}
+	}
+}
+
+func TestSplitHostPattern(t *testing.T) {
+	tests := map[string][]string{
+		"web:db":        {"web", "db"},
+		"web,db:x":      {"web", "db:x"},
+		"web[1:2]:db":   {"web[1:2]", "db"},
+		"fe80::1":       {"fe80::1"},
+		"::1,web":       {"::1", "web"},
+		"web:!db:&east": {"web", "!db", "&east"},
+	}
+	for pattern, want := range tests {
+		if got := splitHostPattern(pattern); !reflect.DeepEqual(got, want) {
+			t.Errorf("splitHostPattern(%q) = %v, want %v", pattern, got, want)
+		}
+	}
+}
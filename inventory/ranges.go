@@ -0,0 +1,109 @@
+package inventory
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	rangeLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+)
+
+var (
+	// A range is in the form of [start:end] or [start:end:stride].
+	hostRangePattern = regexp.MustCompile(`\[([0-9a-zA-Z]+):([0-9a-zA-Z]+)(?::([0-9]+))?\]`)
+)
+
+// expandHostRanges expands the ranges in the host pattern like node[01:20] or db-[a:c].
+func expandHostRanges(pattern string) ([]string, error) {
+	match := hostRangePattern.FindStringSubmatchIndex(pattern)
+	if match == nil {
+		return []string{pattern}, nil
+	}
+	prefix, suffix := pattern[:match[0]], pattern[match[1]:]
+	start, end := pattern[match[2]:match[3]], pattern[match[4]:match[5]]
+	stride := 1
+	if match[6] >= 0 {
+		var err error
+		stride, err = strconv.Atoi(pattern[match[6]:match[7]])
+		if err != nil || stride <= 0 {
+			return nil, fmt.Errorf("Invalid stride in host range %s", pattern)
+		}
+	}
+	items, err := expandRange(start, end, stride)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid host range %s: %w", pattern, err)
+	}
+	hosts := []string{}
+	for _, item := range items {
+		// The suffix may have more ranges.
+		expanded, err := expandHostRanges(prefix + item + suffix)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, expanded...)
+	}
+	return hosts, nil
+}
+
+func expandRange(start, end string, stride int) ([]string, error) {
+	startNum, err1 := strconv.Atoi(start)
+	endNum, err2 := strconv.Atoi(end)
+	if err1 == nil && err2 == nil {
+		format := "%d"
+		if len(start) > 1 && strings.HasPrefix(start, "0") {
+			if len(start) != len(end) {
+				return nil, fmt.Errorf("Begin %s and end %s must have the same length", start, end)
+			}
+			format = fmt.Sprintf("%%0%dd", len(start))
+		}
+		if startNum > endNum {
+			return nil, fmt.Errorf("Begin %s is greater than end %s", start, end)
+		}
+		items := []string{}
+		for i := startNum; i <= endNum; i += stride {
+			items = append(items, fmt.Sprintf(format, i))
+		}
+		return items, nil
+	}
+	startIndex := strings.Index(rangeLetters, start)
+	endIndex := strings.Index(rangeLetters, end)
+	if len(start) != 1 || len(end) != 1 || startIndex < 0 || endIndex < 0 {
+		return nil, fmt.Errorf("Range must be numeric or single letters, but found %s:%s", start, end)
+	}
+	if startIndex > endIndex {
+		return nil, fmt.Errorf("Begin %s is greater than end %s", start, end)
+	}
+	items := []string{}
+	for i := startIndex; i <= endIndex; i += stride {
+		items = append(items, string(rangeLetters[i]))
+	}
+	return items, nil
+}
+
+// splitHostPort splits the port from a host like host:2222.
+// IPv6 addresses without brackets are returned as they are.
+func splitHostPort(host string) (string, int, bool) {
+	if strings.HasPrefix(host, "[") {
+		end := strings.Index(host, "]:")
+		if end < 0 {
+			return host, 0, false
+		}
+		port, err := strconv.Atoi(host[end+2:])
+		if err != nil {
+			return host, 0, false
+		}
+		return host[1:end], port, true
+	}
+	if strings.Count(host, ":") != 1 {
+		return host, 0, false
+	}
+	name, portStr, _ := strings.Cut(host, ":")
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return host, 0, false
+	}
+	return name, port, true
+}
@@ -0,0 +1,149 @@
+package inventory
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// scriptGroup is a group in the JSON output of a dynamic inventory script.
+type scriptGroup struct {
+	Hosts    []string       `yaml:"hosts"`
+	Vars     map[string]any `yaml:"vars"`
+	Children []string       `yaml:"children"`
+}
+
+// LoadScript runs the dynamic inventory script with --list and parses the output.
+// The script is also run with --host for each of its hosts if the output has no _meta.hostvars.
+func (inventory *Inventory) LoadScript(path string) error {
+	output, err := runScript(path, "--list")
+	if err != nil {
+		return err
+	}
+	hosts, hasMeta, err := inventory.parseJSON(output)
+	if err != nil {
+		return err
+	}
+	if hasMeta {
+		return nil
+	}
+	for _, name := range hosts {
+		output, err := runScript(path, "--host", name)
+		if err != nil {
+			return err
+		}
+		vars := map[string]any{}
+		err = yaml.Unmarshal(output, &vars)
+		if err != nil {
+			return fmt.Errorf("Invalid vars of host %s: %w", name, err)
+		}
+		for key, value := range vars {
+			inventory.hosts[name].Vars[key] = value
+		}
+	}
+	return nil
+}
+
+func runScript(path string, args ...string) ([]byte, error) {
+	output, err := exec.Command(path, args...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("Inventory script %s failed: %w: %s", path, err, string(exitErr.Stderr))
+		}
+		return nil, fmt.Errorf("Inventory script %s failed: %w", path, err)
+	}
+	return output, nil
+}
+
+// ParseJSON parses the inventory in the JSON format of the dynamic inventory scripts.
+//
+//	{
+//	  "web": {"hosts": ["node01"], "vars": {"http_port": 80}, "children": ["db"]},
+//	  "db": ["node02"],
+//	  "_meta": {"hostvars": {"node01": {"ansible_host": "10.0.0.1"}}}
+//	}
+func (inventory *Inventory) ParseJSON(data []byte) error {
+	_, _, err := inventory.parseJSON(data)
+	return err
+}
+
+// parseJSON returns the hosts in the data and whether the data has _meta.hostvars.
+func (inventory *Inventory) parseJSON(data []byte) ([]string, bool, error) {
+	// JSON is parsed as YAML so that the integers are not converted to floats.
+	nodes := map[string]yaml.Node{}
+	err := yaml.Unmarshal(data, &nodes)
+	if err != nil {
+		return nil, false, err
+	}
+	// The groups are added in the sorted order for the deterministic host order.
+	names := make([]string, 0, len(nodes))
+	for name := range nodes {
+		if name != "_meta" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	hosts := []string{}
+	for _, name := range names {
+		node := nodes[name]
+		group := scriptGroup{}
+		// A group is either a list of hosts or a mapping.
+		if node.Kind == yaml.SequenceNode {
+			err = node.Decode(&group.Hosts)
+		} else {
+			err = node.Decode(&group)
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("Invalid group %s: %w", name, err)
+		}
+		inventory.AddGroup(name)
+		for key, value := range group.Vars {
+			inventory.groups[name].Vars[key] = value
+		}
+		for _, pattern := range group.Hosts {
+			names, err := expandHostRanges(pattern)
+			if err != nil {
+				return nil, false, err
+			}
+			for _, hostName := range names {
+				inventory.AddHost(hostName, name)
+				if !contains(hosts, hostName) {
+					hosts = append(hosts, hostName)
+				}
+			}
+		}
+		for _, child := range group.Children {
+			err = inventory.AddChild(name, child)
+			if err != nil {
+				return nil, false, err
+			}
+		}
+	}
+	// The hosts only in _meta are added after the hosts of the groups in the sorted order.
+	hasMeta := false
+	if node, ok := nodes["_meta"]; ok {
+		meta := struct {
+			HostVars map[string]map[string]any `yaml:"hostvars"`
+		}{}
+		err = node.Decode(&meta)
+		if err != nil {
+			return nil, false, fmt.Errorf("Invalid _meta: %w", err)
+		}
+		hasMeta = meta.HostVars != nil
+		hostNames := make([]string, 0, len(meta.HostVars))
+		for hostName := range meta.HostVars {
+			hostNames = append(hostNames, hostName)
+		}
+		sort.Strings(hostNames)
+		for _, hostName := range hostNames {
+			host := inventory.AddHost(hostName, "")
+			for key, value := range meta.HostVars[hostName] {
+				host.Vars[key] = value
+			}
+		}
+	}
+	inventory.reconcile()
+	return hosts, hasMeta, nil
+}
@@ -0,0 +1,141 @@
+package inventory
+
+import (
+	"fmt"
+	"goparse/defs"
+	"os"
+	fp "path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// Extensions of the files in group_vars and host_vars. The empty one is a file without an extension.
+	varsExtensions = []string{"", ".yml", ".yaml", ".json"}
+)
+
+// LoadVarsDir loads the group_vars and host_vars directories in the directory.
+// The vars in the files take precedence over the vars in the inventory files.
+// The vars of the groups and the hosts which are not in the inventory are ignored.
+// A directory is loaded only once.
+func (inventory *Inventory) LoadVarsDir(dir string) error {
+	dir = fp.Clean(dir)
+	if contains(inventory.varsDirs, dir) {
+		return nil
+	}
+	inventory.varsDirs = append(inventory.varsDirs, dir)
+	for _, name := range inventory.GroupNames() {
+		vars, err := loadVarsEntry(fp.Join(dir, "group_vars"), name)
+		if err != nil {
+			return err
+		}
+		for key, value := range vars {
+			inventory.groups[name].Vars[key] = value
+		}
+	}
+	hostNames := inventory.HostNames()
+	for _, name := range localhostNames {
+		if _, ok := inventory.hosts[name]; !ok {
+			hostNames = append(hostNames, name)
+		}
+	}
+	for _, name := range hostNames {
+		vars, err := loadVarsEntry(fp.Join(dir, "host_vars"), name)
+		if err != nil {
+			return err
+		}
+		if len(vars) == 0 {
+			continue
+		}
+		host, ok := inventory.hosts[name]
+		if !ok {
+			// The vars of the implicit localhost are kept separately.
+			host, ok = inventory.implicitHosts[name]
+			if !ok {
+				host = &Host{Name: name, Vars: defs.Config{}}
+				inventory.implicitHosts[name] = host
+			}
+		}
+		for key, value := range vars {
+			host.Vars[key] = value
+		}
+	}
+	return nil
+}
+
+// loadVarsEntry loads the vars of the group or the host from the file or the directory named
+// after it with an optional YAML or JSON extension. The files in a directory are loaded in the
+// lexical order.
+func loadVarsEntry(dir, name string) (map[string]any, error) {
+	vars := map[string]any{}
+	for _, ext := range varsExtensions {
+		path := fp.Join(dir, name+ext)
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if !info.IsDir() {
+			err = loadVarsFile(path, vars)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		files := []string{}
+		err = fp.WalkDir(path, func(file string, entry os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if file != path && strings.HasPrefix(entry.Name(), ".") {
+				if entry.IsDir() {
+					return fp.SkipDir
+				}
+				return nil
+			}
+			if !entry.IsDir() && isVarsFile(entry.Name()) {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+		for _, file := range files {
+			err = loadVarsFile(file, vars)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return vars, nil
+}
+
+func isVarsFile(name string) bool {
+	ext := strings.ToLower(fp.Ext(name))
+	for _, varsExt := range varsExtensions {
+		if ext == varsExt {
+			return true
+		}
+	}
+	return false
+}
+
+func loadVarsFile(path string, vars map[string]any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	// JSON is also parsed as YAML.
+	fileVars := map[string]any{}
+	err = yaml.Unmarshal(data, &fileVars)
+	if err != nil {
+		return fmt.Errorf("Failed to load vars file %s: %w", path, err)
+	}
+	for key, value := range fileVars {
+		vars[key] = value
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package inventory
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ParseYAML parses the inventory in the YAML format.
+// The order of the hosts is preserved.
+//
+//	all:
+//	  hosts:
+//	    host1:
+//	      ansible_host: 10.0.0.1
+//	  children:
+//	    web:
+//	      hosts:
+//	        node[01:03]:
+//	      vars:
+//	        http_port: 80
+func (inventory *Inventory) ParseYAML(data []byte) error {
+	root := yaml.Node{}
+	err := yaml.Unmarshal(data, &root)
+	if err != nil {
+		return err
+	}
+	if len(root.Content) == 0 {
+		return nil
+	}
+	err = forEachMappingEntry(root.Content[0], func(name string, node *yaml.Node) error {
+		return inventory.addYAMLGroup(name, node)
+	})
+	if err != nil {
+		return err
+	}
+	inventory.reconcile()
+	return nil
+}
+
+func (inventory *Inventory) addYAMLGroup(name string, node *yaml.Node) error {
+	group := inventory.AddGroup(name)
+	return forEachMappingEntry(node, func(key string, value *yaml.Node) error {
+		switch key {
+		case "vars":
+			vars := map[string]any{}
+			err := value.Decode(&vars)
+			if err != nil {
+				return err
+			}
+			for key, value := range vars {
+				group.Vars[key] = value
+			}
+		case "hosts":
+			return forEachMappingEntry(value, func(pattern string, hostNode *yaml.Node) error {
+				vars := map[string]any{}
+				err := hostNode.Decode(&vars)
+				if err != nil {
+					return err
+				}
+				return inventory.addHosts(pattern, name, vars)
+			})
+		case "children":
+			return forEachMappingEntry(value, func(childName string, childNode *yaml.Node) error {
+				err := inventory.AddChild(name, childName)
+				if err != nil {
+					return err
+				}
+				return inventory.addYAMLGroup(childName, childNode)
+			})
+		default:
+			return fmt.Errorf("Line %d: invalid key %s in group %s", value.Line, key, name)
+		}
+		return nil
+	})
+}
+
+// forEachMappingEntry calls the function for each entry of the mapping node in order.
+// A null node is an empty mapping.
+func forEachMappingEntry(node *yaml.Node, fn func(string, *yaml.Node) error) error {
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return nil
+	}
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("Line %d: mapping is expected", node.Line)
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		var key string
+		err := node.Content[i].Decode(&key)
+		if err != nil {
+			return err
+		}
+		err = fn(key, node.Content[i+1])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
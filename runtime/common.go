@@ -4,36 +4,231 @@ import (
 	"encoding/json"
 	"fmt"
 	"goparse/defs"
+	"goparse/inventory"
+	"regexp"
+)
+
+var (
+	variableNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+const (
+	// DefaultMaxIncludeDepth is the maximum depth of nested file includes if it is not configured.
+	DefaultMaxIncludeDepth = 64
+	// DefaultForks is the number of the hosts on which a task runs in parallel if it is not configured.
+	DefaultForks = 5
+	// DefaultStrategy is the strategy of the plays which do not set one if it is not configured.
+	DefaultStrategy = "linear"
+	// GatheringImplicit gathers the facts at the start of the plays unless gather_facts is disabled.
+	GatheringImplicit = "implicit"
+	// GatheringExplicit gathers the facts at the start of only the plays enabling gather_facts.
+	GatheringExplicit = "explicit"
+	// GatheringSmart gathers the facts like implicit, but the facts gathered earlier for a host are reused.
+	GatheringSmart = "smart"
+	// DefaultGathering is the gathering if it is not configured.
+	DefaultGathering = GatheringExplicit
+	// DefaultFactCaching is the backend of the fact cache if it is not configured.
+	DefaultFactCaching = "memory"
 )
 
 type PlaybookConfig struct {
-	YamlDir   string                 `json:"yaml_dir"`
-	ExtraVars map[string]interface{} `json:"extra_vars"`
+	YamlDir         string                 `json:"yaml_dir"`
+	ExtraVars       map[string]interface{} `json:"extra_vars"`
+	RolesPath       []string               `json:"roles_path"`
+	MaxIncludeDepth int                    `json:"max_include_depth"`
+	// StrictUndefined fails the templates and conditions referencing undefined variables.
+	StrictUndefined bool `json:"strict_undefined"`
+	// LenientConditions skips the task instead of failing if a when condition cannot be evaluated.
+	LenientConditions bool `json:"lenient_conditions"`
+	// StringTemplates always renders the templates to strings instead of native values.
+	StringTemplates bool `json:"string_templates"`
+	// Inventory provides the variables of the host. Any other variables take precedence over them.
+	Inventory *inventory.Inventory `json:"-"`
+	// Host is the inventory host to run for. It is localhost if it is empty.
+	Host string `json:"host"`
+	// Forks is the maximum number of the hosts on which the tasks of a play run in parallel.
+	Forks int `json:"forks"`
+	// Strategy is the strategy of the plays which do not set one.
+	Strategy string `json:"strategy"`
+	// Connection is the connection type of the hosts which do not set ansible_connection.
+	// It is local for localhost and ssh for the other hosts if it is empty.
+	Connection string `json:"connection"`
+	// Gathering is implicit, explicit or smart. It is explicit if it is empty.
+	Gathering string `json:"gathering"`
+	// FactCaching is the backend of the fact cache which is memory or jsonfile. It is memory if it is empty.
+	FactCaching string `json:"fact_caching"`
+	// FactCachingConnection is the directory of the jsonfile fact cache.
+	FactCachingConnection string `json:"fact_caching_connection"`
+	// FactCachingTimeout is the number of seconds after which the cached facts expire. They never expire if it is zero.
+	FactCachingTimeout int `json:"fact_caching_timeout"`
+	// FactCache keeps the facts of the hosts. It is created from the fact caching config if it is nil.
+	FactCache defs.FactCache `json:"-"`
 }
 
-func resolveVars[V any](input V, values defs.Config) (V, error) {
-	return defs.ResolveVars[V](input, defs.DefaultTemplateResolver(values))
+func (config *PlaybookConfig) templateOptions() defs.TemplateOptions {
+	return defs.TemplateOptions{
+		StrictUndefined: config.StrictUndefined,
+		Native:          !config.StringTemplates,
+		SearchPaths:     []string{config.YamlDir},
+	}
 }
 
-func resolveLoop(yamlLoop *defs.YamlLoop, values defs.Config) ([]any, error) {
+func resolveVars[V any](input V, values defs.Config, options defs.TemplateOptions) (V, error) {
+	return defs.ResolveVars[V](input, defs.NewTemplateResolver(values, options))
+}
+
+// resolveLoop returns the items of the loop keyword or a with_<lookup> keyword.
+func resolveLoop(yamlLoop *defs.YamlLoop, values defs.Config, options defs.TemplateOptions) ([]any, error) {
+	var terms []any
 	if yamlLoop.Var != nil {
-		str, err := resolveVars[string](*yamlLoop.Var, values)
+		value, err := resolveVars[any](*yamlLoop.Var, values, options)
 		if err != nil {
 			return nil, err
 		}
-		loop := []any{}
-		err = json.Unmarshal([]byte(str), &loop)
+		if value == nil {
+			// An undefined variable is nil if the templates are not strict.
+			return nil, fmt.Errorf("Loop must be a list, but found nothing in %s", *yamlLoop.Var)
+		}
+		if list, ok := value.([]any); ok {
+			terms = list
+		} else if str, ok := value.(string); ok {
+			// The value is a JSON string if it is not evaluated natively.
+			err = json.Unmarshal([]byte(str), &terms)
+			if err != nil {
+				if yamlLoop.Lookup == "" {
+					return nil, fmt.Errorf("Loop must be a list, but found %s", str)
+				}
+				// A string like start=1 end=5 of with_sequence is a single term.
+				terms = []any{str}
+			}
+		} else if yamlLoop.Lookup != "" {
+			// A scalar is a single term.
+			terms = []any{value}
+		} else {
+			return nil, fmt.Errorf("Loop must be a list, but found %T", value)
+		}
+	} else if yamlLoop.Items != nil {
+		slice, err := resolveVars[[]any](yamlLoop.Items, values, options)
 		if err != nil {
 			return nil, err
 		}
-		return loop, nil
+		terms = slice
+	} else {
+		return nil, fmt.Errorf("Unsupported loop type %+v", yamlLoop)
+	}
+	if yamlLoop.Lookup == "" {
+		return terms, nil
+	}
+	lookupContext := &defs.LookupContext{Variables: values, Options: options}
+	return lookupContext.Run(yamlLoop.Lookup, terms, defs.Config{})
+}
+
+// extendedLoopVar returns the ansible_loop variable for the iteration at the index.
+func extendedLoopVar(loop []any, index int) map[string]any {
+	length := len(loop)
+	loopVar := map[string]any{
+		"allitems":  loop,
+		"index":     index + 1,
+		"index0":    index,
+		"revindex":  length - index,
+		"revindex0": length - index - 1,
+		"first":     index == 0,
+		"last":      index == length-1,
+		"length":    length,
+	}
+	if index > 0 {
+		loopVar["previtem"] = loop[index-1]
+	}
+	if index < length-1 {
+		loopVar["nextitem"] = loop[index+1]
+	}
+	return loopVar
+}
+
+// itemResult returns the registered result of a loop item.
+// The result has the loop variables of the item and the output of the task.
+// A dictionary output is merged into the result.
+func itemResult(result map[string]any, out defs.Output, err error, skipped bool) map[string]any {
+	itemResult := map[string]any{"changed": false, "failed": false, "skipped": skipped}
+	if skipped {
+		itemResult["skip_reason"] = "Conditional result was False"
+	}
+	switch v := out.(type) {
+	case nil:
+	case map[string]any:
+		for key, value := range v {
+			itemResult[key] = value
+		}
+	case defs.Config:
+		for key, value := range v {
+			itemResult[key] = value
+		}
+	default:
+		itemResult["output"] = out
+	}
+	if err != nil {
+		itemResult["failed"] = true
+		itemResult["msg"] = err.Error()
+	}
+	for key, value := range result {
+		itemResult[key] = value
+	}
+	return itemResult
+}
+
+// loopResult returns the registered result of a loop with the results of the items.
+func loopResult(results []any) map[string]any {
+	changed, failed := false, false
+	skipped := len(results) > 0
+	for _, result := range results {
+		itemResult := result.(map[string]any)
+		changed = changed || itemResult["changed"] == true
+		failed = failed || itemResult["failed"] == true
+		skipped = skipped && itemResult["skipped"] == true
+	}
+	msg := "All items completed"
+	if failed {
+		msg = "One or more items failed"
+	}
+	return map[string]any{
+		"changed": changed,
+		"failed":  failed,
+		"skipped": skipped,
+		"msg":     msg,
+		"results": results,
+	}
+}
+
+// templateElement returns a copy of the element in which the task config and the keywords
+// used by the task are templated. The other keywords are templated when they are evaluated.
+func templateElement(yamlElement *defs.YamlElement, values defs.Config, options defs.TemplateOptions) (*defs.YamlElement, error) {
+	element, err := resolveVars[*defs.YamlElement](yamlElement, values, options)
+	if err != nil {
+		return nil, err
+	}
+	if yamlElement.Name != nil {
+		// The name is only informational, so the raw name is kept if it cannot be templated.
+		name, err := resolveVars[string](*yamlElement.Name, values, options)
+		if err != nil {
+			name = *yamlElement.Name
+		}
+		element.Name = &name
 	}
-	if yamlLoop.Items != nil {
-		slice, err := resolveVars[[]any](yamlLoop.Items, values)
+	if yamlElement.Register != nil {
+		register, err := resolveVars[string](*yamlElement.Register, values, options)
 		if err != nil {
 			return nil, err
 		}
-		return slice, nil
+		if !variableNamePattern.MatchString(register) {
+			return nil, fmt.Errorf("Invalid register variable name %s", register)
+		}
+		element.Register = &register
+	}
+	// The environment of the parents is templated in the scope of the task.
+	environ, err := resolveVars[defs.StrConfig](yamlElement.Environment(), values, options)
+	if err != nil {
+		return nil, err
 	}
-	return nil, fmt.Errorf("Unsupported loop type %+v", yamlLoop)
+	element.Environ = environ
+	return element, nil
 }
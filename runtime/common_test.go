@@ -0,0 +1,59 @@
+package runtime
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLoopResultChanged(t *testing.T) {
+	tests := []struct {
+		outputs []any
+		changed bool
+	}{
+		{[]any{"a", "b"}, false},
+		{[]any{"a", map[string]any{"changed": false}}, false},
+		{[]any{map[string]any{"changed": true}, map[string]any{"changed": false}}, true},
+		{[]any{map[string]any{"changed": false}, "b", map[string]any{"changed": true}}, true},
+	}
+	for _, test := range tests {
+		results := []any{}
+		for i, out := range test.outputs {
+			results = append(results, itemResult(map[string]any{"item": i}, out, nil, false))
+		}
+		if changed := loopResult(results)["changed"]; changed != test.changed {
+			t.Errorf("loopResult(%v) changed = %v, want %v", test.outputs, changed, test.changed)
+		}
+	}
+}
+
+func TestRegisterLoopResults(t *testing.T) {
+	pe, err := executeTasks(t, `
+- shell:
+    cmd: echo -n {{ item }}
+  loop: [a, b]
+  register: result
+- set_fact:
+    seen: "{{ result.changed }}-{{ result.results[1].changed }}-{{ result is changed }}"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := pe.CurrentConfig()["result"].(map[string]any)
+	if result["changed"] != false || result["failed"] != false || result["msg"] != "All items completed" {
+		t.Errorf("result = %v, want unchanged without a failure", result)
+	}
+	var outputs []any
+	for _, item := range result["results"].([]any) {
+		itemResult := item.(map[string]any)
+		if changed, ok := itemResult["changed"]; !ok || changed != false {
+			t.Errorf("item result %v is not unchanged", itemResult)
+		}
+		outputs = append(outputs, itemResult["output"])
+	}
+	if want := []any{"a", "b"}; !reflect.DeepEqual(outputs, want) {
+		t.Errorf("outputs = %v, want %v", outputs, want)
+	}
+	if seen := pe.CurrentConfig()["seen"]; seen != "False-False-False" {
+		t.Errorf("seen = %v, want False-False-False", seen)
+	}
+}
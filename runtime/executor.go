@@ -2,8 +2,16 @@ package runtime
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"goparse/defs"
+	"goparse/inventory"
+	"strings"
+	"time"
 
+	"goparse/defs/connections"
+	_ "goparse/defs/lookups"
 	_ "goparse/defs/modules"
 
 	fp "path/filepath"
@@ -12,6 +20,32 @@ import (
 type PlaybookExecutor struct {
 	inputConfig   *PlaybookConfig
 	currentConfig defs.Config
+	// Files being executed, the outermost first.
+	includeStack []string
+	// inventoryLoaded is set when the inventory variables are applied.
+	inventoryLoaded bool
+	// Connections opened by the running task.
+	connections []defs.Connection
+	// become is the become keywords of the running task. The tasks in an included file inherit them.
+	become defs.BecomeKeywords
+	// delegateTo is the host to which the running task is delegated. It is empty if the task is not delegated.
+	delegateTo string
+	// batch is the batch of the play running on the host. The run_once tasks run on every host without it.
+	batch *playRun
+	// batchTask is the index of the play task running on the host in the batch.
+	batchTask int
+	// onceCounts are the numbers of the occurrences of the run_once tasks by the positions in the play task.
+	onceCounts map[defs.Position]int
+	// shared collects the registered results and the facts while a run_once task runs.
+	shared defs.Config
+	// facts keeps the facts of the host. It is created when it is used first.
+	facts defs.FactCache
+	// factsLoaded is set when the cached facts are applied.
+	factsLoaded bool
+	// writes are the generations in which the variables were last set by the tasks.
+	// The scoped variables are not restored over them.
+	writes     map[string]int
+	generation int
 }
 
 func NewPlaybookExecutor(config *PlaybookConfig) *PlaybookExecutor {
@@ -24,10 +58,171 @@ func NewPlaybookExecutor(config *PlaybookConfig) *PlaybookExecutor {
 	return pe
 }
 
+// loadInventory applies the variables of the host from the inventory and the group_vars and
+// host_vars directories next to the playbook. They do not override the existing variables.
+func (pe *PlaybookExecutor) loadInventory(playbookDir string) error {
+	if pe.inventoryLoaded || pe.inputConfig.Inventory == nil {
+		return nil
+	}
+	pe.inventoryLoaded = true
+	err := pe.inputConfig.Inventory.LoadVarsDir(playbookDir)
+	if err != nil {
+		return err
+	}
+	for key, value := range pe.inputConfig.Inventory.Variables(pe.Host()) {
+		if _, ok := pe.currentConfig[key]; !ok {
+			pe.currentConfig[key] = value
+		}
+	}
+	return nil
+}
+
 func (pe *PlaybookExecutor) ApplyConfig(config defs.Config) error {
 	for key, value := range config {
+		pe.setVar(key, value)
+		if pe.shared != nil {
+			pe.shared[key] = value
+		}
+	}
+	return nil
+}
+
+// register sets the registered result of a task.
+func (pe *PlaybookExecutor) register(name string, out any) {
+	pe.setVar(name, out)
+	if pe.shared != nil {
+		pe.shared[name] = out
+	}
+}
+
+// setVar sets the variable written by a task, which outlives the scopes applied before.
+func (pe *PlaybookExecutor) setVar(key string, value any) {
+	if pe.writes == nil {
+		pe.writes = map[string]int{}
+	}
+	pe.generation++
+	pe.writes[key] = pe.generation
+	pe.currentConfig[key] = value
+}
+
+// ApplyScopedConfig applies the config only for the duration of fn.
+// The previous values are restored after fn returns.
+func (pe *PlaybookExecutor) ApplyScopedConfig(config defs.Config, fn func() error) error {
+	restore := pe.applyScopedConfig(config)
+	defer restore()
+	return fn()
+}
+
+// applyScopedConfig applies the config and returns the function restoring the previous values.
+// The variables set by the tasks in the scope, like set_fact and register, are kept.
+func (pe *PlaybookExecutor) applyScopedConfig(config defs.Config) func() {
+	saved := defs.Config{}
+	for key, value := range config {
+		if prev, ok := pe.currentConfig[key]; ok {
+			saved[key] = prev
+		}
 		pe.currentConfig[key] = value
 	}
+	start := pe.generation
+	return func() {
+		for key := range config {
+			if pe.writes[key] > start {
+				continue
+			}
+			if prev, ok := saved[key]; ok {
+				pe.currentConfig[key] = prev
+			} else {
+				delete(pe.currentConfig, key)
+			}
+		}
+	}
+}
+
+// Host returns the inventory host which the executor runs for.
+func (pe *PlaybookExecutor) Host() string {
+	if pe.inputConfig.Host == "" {
+		return "localhost"
+	}
+	return pe.inputConfig.Host
+}
+
+// CachedFacts returns the cached facts of the host if the gathering is smart.
+func (pe *PlaybookExecutor) CachedFacts() (defs.Config, bool, error) {
+	if pe.inputConfig.Gathering != GatheringSmart {
+		return nil, false, nil
+	}
+	cache, err := pe.factCache()
+	if err != nil {
+		return nil, false, err
+	}
+	return cache.Get(pe.Host())
+}
+
+func (pe *PlaybookExecutor) CacheFacts(facts defs.Config) error {
+	cache, err := pe.factCache()
+	if err != nil {
+		return err
+	}
+	cached, _, err := cache.Get(pe.Host())
+	if err != nil {
+		return err
+	}
+	if cached == nil {
+		cached = defs.Config{}
+	}
+	for key, value := range facts {
+		cached[key] = value
+	}
+	return cache.Set(pe.Host(), cached)
+}
+
+// factCache returns the fact cache of the config. It is created from the fact caching config if it is not set.
+func (pe *PlaybookExecutor) factCache() (defs.FactCache, error) {
+	if pe.facts != nil {
+		return pe.facts, nil
+	}
+	pe.facts = pe.inputConfig.FactCache
+	if pe.facts == nil {
+		backend := pe.inputConfig.FactCaching
+		if backend == "" {
+			backend = DefaultFactCaching
+		}
+		timeout := time.Duration(pe.inputConfig.FactCachingTimeout) * time.Second
+		cache, err := defs.NewFactCache(backend, pe.inputConfig.FactCachingConnection, timeout)
+		if err != nil {
+			return nil, err
+		}
+		pe.facts = cache
+	}
+	return pe.facts, nil
+}
+
+// loadCachedFacts applies the cached facts of the host as the variables and ansible_facts.
+// They take precedence over the inventory variables, but not over the extra variables.
+func (pe *PlaybookExecutor) loadCachedFacts() error {
+	if pe.factsLoaded {
+		return nil
+	}
+	pe.factsLoaded = true
+	cache, err := pe.factCache()
+	if err != nil {
+		return err
+	}
+	facts, ok, err := cache.Get(pe.Host())
+	if err != nil || !ok {
+		return err
+	}
+	allFacts := map[string]any{}
+	vars := defs.Config{"ansible_facts": allFacts}
+	for key, value := range facts {
+		allFacts[strings.TrimPrefix(key, "ansible_")] = value
+		vars[key] = value
+	}
+	for key, value := range vars {
+		if _, ok := pe.inputConfig.ExtraVars[key]; !ok {
+			pe.currentConfig[key] = value
+		}
+	}
 	return nil
 }
 
@@ -35,57 +230,278 @@ func (pe *PlaybookExecutor) CurrentConfig() defs.Config {
 	return pe.currentConfig
 }
 
-func (pe *PlaybookExecutor) shouldExecute(yamlElement *defs.YamlElement) bool {
-	if len(yamlElement.When) == 0 {
-		return true
+func (pe *PlaybookExecutor) ExtraVars() defs.Config {
+	return pe.inputConfig.ExtraVars
+}
+
+func (pe *PlaybookExecutor) TemplateOptions() defs.TemplateOptions {
+	return pe.inputConfig.templateOptions()
+}
+
+// Connection returns the connection of the type set by ansible_connection to the host.
+// The connection of a delegated task is to the delegated host with the connection variables of that host.
+// The connections are released when the task finishes.
+func (pe *PlaybookExecutor) Connection(ctx context.Context) (defs.Connection, error) {
+	host := pe.Host()
+	hostVars := pe.currentConfig
+	if pe.delegateTo != "" && pe.delegateTo != host {
+		host = pe.delegateTo
+		hostVars = pe.delegatedVars(host)
+	}
+	vars := defs.Config{}
+	for key, value := range hostVars {
+		if strings.HasPrefix(key, "ansible_") {
+			vars[key] = value
+		}
+	}
+	vars, err := resolveVars[defs.Config](vars, pe.CurrentConfig(), pe.TemplateOptions())
+	if err != nil {
+		return nil, err
+	}
+	connectionType, _ := vars["ansible_connection"].(string)
+	if connectionType == "" {
+		connectionType = pe.inputConfig.Connection
+	}
+	if connectionType == "" {
+		connectionType = "ssh"
+		if inventory.IsLocalhost(host) {
+			connectionType = "local"
+		}
+	}
+	conn, err := defs.Connect(ctx, connectionType, host, vars)
+	if err != nil {
+		return nil, err
+	}
+	pe.connections = append(pe.connections, conn)
+	options, ok, err := pe.becomeOptions(vars)
+	if err != nil || !ok {
+		return conn, err
+	}
+	return connections.Become(conn, options)
+}
+
+// delegatedVars returns the inventory variables of the host to which a task is delegated.
+func (pe *PlaybookExecutor) delegatedVars(host string) defs.Config {
+	hostInventory := pe.inputConfig.Inventory
+	if hostInventory == nil {
+		// Only the implicit localhost has variables.
+		hostInventory = inventory.New()
+	}
+	return hostInventory.HostVars(host)
+}
+
+// becomeOptions returns the become options of the running task. The keywords take precedence
+// over the ansible_become variables. It returns false if become is not enabled.
+func (pe *PlaybookExecutor) becomeOptions(vars defs.Config) (defs.BecomeOptions, bool, error) {
+	options := defs.BecomeOptions{}
+	var become defs.Bool
+	if pe.become.Become != nil {
+		become = *pe.become.Become
+	} else if value, ok := vars["ansible_become"]; ok && value != nil {
+		// The value is converted through JSON to accept the YAML style booleans.
+		data, _ := json.Marshal(value)
+		err := json.Unmarshal(data, &become)
+		if err != nil {
+			return options, false, err
+		}
+	}
+	if !become {
+		return options, false, nil
+	}
+	var err error
+	options.User, err = pe.becomeOption(pe.become.User, vars, "ansible_become_user")
+	if err != nil {
+		return options, false, err
+	}
+	options.Method, err = pe.becomeOption(pe.become.Method, vars, "ansible_become_method")
+	if err != nil {
+		return options, false, err
+	}
+	options.Flags, err = pe.becomeOption(pe.become.Flags, vars, "ansible_become_flags")
+	if err != nil {
+		return options, false, err
+	}
+	options.Password, _ = pe.becomeOption(nil, vars, "ansible_become_password", "ansible_become_pass")
+	return options, true, nil
+}
+
+// becomeOption returns the templated keyword if it is set. Otherwise, it returns the first variable which is set.
+func (pe *PlaybookExecutor) becomeOption(keyword *string, vars defs.Config, names ...string) (string, error) {
+	if keyword != nil {
+		return resolveVars[string](*keyword, pe.CurrentConfig(), pe.TemplateOptions())
+	}
+	for _, name := range names {
+		if value, ok := vars[name]; ok && value != nil {
+			return fmt.Sprint(value), nil
+		}
+	}
+	return "", nil
+}
+
+// releaseConnections releases the connections opened after the count of the connections was the size.
+// The connections of an outer task like include are kept while the inner tasks run.
+func (pe *PlaybookExecutor) releaseConnections(size int) {
+	for _, conn := range pe.connections[size:] {
+		conn.Close()
+	}
+	pe.connections = pe.connections[:size]
+}
+
+func (pe *PlaybookExecutor) FindRole(name string) (*defs.Role, error) {
+	searchPaths := pe.inputConfig.RolesPath
+	if len(searchPaths) == 0 {
+		searchPaths = []string{fp.Join(pe.inputConfig.YamlDir, "roles"), pe.inputConfig.YamlDir}
 	}
+	return defs.FindRole(name, searchPaths)
+}
+
+func (pe *PlaybookExecutor) shouldExecute(yamlElement *defs.YamlElement) (bool, error) {
 	for _, cond := range yamlElement.When {
-		output, err := resolveVars[string](cond, pe.CurrentConfig())
+		ok, err := defs.EvaluateCondition(cond, pe.CurrentConfig(), pe.inputConfig.templateOptions())
 		if err != nil {
-			return false
+			if pe.inputConfig.LenientConditions {
+				return false, nil
+			}
+			return false, &defs.ConditionError{Position: yamlElement.Pos, Condition: cond, Err: err}
 		}
-		//	fmt.Printf("\nCondition %s evaluated to %s with %+v\n", cond, output, pe.CurrentConfig())
-		if output == "false" {
-			return false
+		if !ok {
+			return false, nil
 		}
 	}
-	return true
+	return true, nil
 }
 
 func (pe *PlaybookExecutor) executeLoop(ctx context.Context, yamlElement *defs.YamlElement) error {
-	loop, err := resolveLoop(yamlElement.Loop, pe.CurrentConfig())
+	loop, err := resolveLoop(yamlElement.Loop, pe.CurrentConfig(), pe.inputConfig.templateOptions())
 	if err != nil {
 		return err
 	}
-	for _, item := range loop {
-		pe.currentConfig["item"] = item
-		err = pe.executeBlockOrTask(ctx, yamlElement)
-		if err != nil {
-			return err
+	loopControl := yamlElement.LoopControl
+	if loopControl == nil {
+		loopControl = &defs.YamlLoopControl{}
+	}
+	loopVar := loopControl.LoopVar
+	if loopVar == "" {
+		loopVar = "item"
+	}
+	// The loop variables are scoped so that the variables of an outer loop are restored.
+	loopVars := defs.Config{loopVar: nil, "ansible_loop_var": loopVar}
+	if loopControl.IndexVar != "" {
+		loopVars[loopControl.IndexVar] = nil
+		loopVars["ansible_index_var"] = loopControl.IndexVar
+	}
+	if loopControl.Extended {
+		loopVars["ansible_loop"] = nil
+	}
+	// A register template like result_{{ item }} registers each output separately.
+	aggregate := yamlElement.Register != nil && !strings.Contains(*yamlElement.Register, "{{")
+	results := []any{}
+	var loopErr error
+	err = pe.ApplyScopedConfig(loopVars, func() error {
+		for i, item := range loop {
+			if i > 0 && loopControl.Pause > 0 {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(time.Duration(loopControl.Pause * float64(time.Second))):
+				}
+			}
+			pe.currentConfig[loopVar] = item
+			result := map[string]any{loopVar: item, "ansible_loop_var": loopVar}
+			if loopControl.IndexVar != "" {
+				pe.currentConfig[loopControl.IndexVar] = i
+				result[loopControl.IndexVar] = i
+				result["ansible_index_var"] = loopControl.IndexVar
+			}
+			if loopControl.Extended {
+				pe.currentConfig["ansible_loop"] = extendedLoopVar(loop, i)
+				result["ansible_loop"] = pe.currentConfig["ansible_loop"]
+			}
+			// The conditions are evaluated for each item.
+			ok, err := pe.shouldExecute(yamlElement)
+			if err != nil {
+				return err
+			}
+			label := fmt.Sprint(item)
+			if loopControl.Label != "" {
+				label, err = resolveVars[string](loopControl.Label, pe.CurrentConfig(), pe.inputConfig.templateOptions())
+				if err != nil {
+					return err
+				}
+			}
+			fmt.Printf("\nLoop item %s\n", label)
+			if !ok {
+				results = append(results, itemResult(result, nil, nil, true))
+				continue
+			}
+			if len(yamlElement.Block) > 0 {
+				err = pe.executeBlockOrTask(ctx, yamlElement)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			element, out, err := pe.runTask(ctx, yamlElement)
+			results = append(results, itemResult(result, out, err, false))
+			if err != nil && !element.IgnoreErrors {
+				// The remaining items are still run as Ansible does.
+				if loopErr == nil {
+					loopErr = err
+				}
+				continue
+			}
+			if !aggregate && out != nil && element.Register != nil {
+				pe.register(*element.Register, out)
+			}
 		}
-		delete(pe.currentConfig, "item")
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-	return nil
+	if aggregate {
+		pe.register(*yamlElement.Register, loopResult(results))
+	}
+	return loopErr
 }
 
-func (pe *PlaybookExecutor) executeSingleTask(ctx context.Context, yamlElement *defs.YamlElement) error {
-	element, err := resolveVars[*defs.YamlElement](yamlElement, pe.CurrentConfig())
+// runTask runs the task of the element. The templated element is returned even on failure.
+func (pe *PlaybookExecutor) runTask(ctx context.Context, yamlElement *defs.YamlElement) (*defs.YamlElement, defs.Output, error) {
+	element, err := templateElement(yamlElement, pe.CurrentConfig(), pe.inputConfig.templateOptions())
 	if err != nil {
-		return err
+		return yamlElement, nil, err
 	}
 	task, err := element.MakeTask()
 	if err != nil {
-		return err
+		return element, nil, err
 	}
 	//raw, _ := json.Marshal(yamlElement.Loop)
 	//str, _ := json.Marshal(task)
 	//fmt.Printf("\nRunning task: %+v with config %+v -> %+v\n", string(str), pe.CurrentConfig(), string(raw))
+	defer pe.releaseConnections(len(pe.connections))
+	// The keywords of the tasks in an included file are inherited from the include task.
+	become := pe.become
+	pe.become = yamlElement.BecomeKeywords().Inherit(become)
+	defer func() { pe.become = become }()
+	delegateTo := pe.delegateTo
+	if delegation := yamlElement.Delegation(); delegation != nil {
+		pe.delegateTo, err = resolveVars[string](*delegation, pe.CurrentConfig(), pe.inputConfig.templateOptions())
+		if err != nil {
+			return element, nil, err
+		}
+	}
+	defer func() { pe.delegateTo = delegateTo }()
 	out, err := task.Run(ctx, pe)
-	if err != nil {
+	return element, out, err
+}
+
+func (pe *PlaybookExecutor) executeSingleTask(ctx context.Context, yamlElement *defs.YamlElement) error {
+	element, out, err := pe.runTask(ctx, yamlElement)
+	if err != nil && !element.IgnoreErrors {
 		return err
 	}
 	if out != nil && element.Register != nil {
-		pe.currentConfig[*element.Register] = out
+		pe.register(*element.Register, out)
 	}
 	return nil
 }
@@ -104,19 +520,113 @@ func (pe *PlaybookExecutor) executeBlockOrTask(ctx context.Context, yamlElement
 }
 
 func (pe *PlaybookExecutor) execute(ctx context.Context, yamlElement *defs.YamlElement) error {
-	if !pe.shouldExecute(yamlElement) {
+	err := pe.executeWithPosition(ctx, yamlElement)
+	if err == nil {
 		return nil
 	}
-	if yamlElement.Loop == nil {
-		return pe.executeBlockOrTask(ctx, yamlElement)
+	if pos, ok := defs.ErrorPosition(err); ok {
+		if pos.File == "" && pos.Line == 0 {
+			*pos = yamlElement.Pos
+		}
+		return err
+	}
+	name := "block"
+	if yamlElement.Task != nil {
+		name = yamlElement.Task.Name
+	}
+	return &defs.TaskRunError{Position: yamlElement.Pos, Task: name, Err: err}
+}
+
+func (pe *PlaybookExecutor) executeWithPosition(ctx context.Context, yamlElement *defs.YamlElement) error {
+	if len(yamlElement.Vars) == 0 {
+		return pe.executeWithVars(ctx, yamlElement)
+	}
+	vars, err := resolveVars[defs.Config](yamlElement.Vars, pe.CurrentConfig(), pe.inputConfig.templateOptions())
+	if err != nil {
+		return err
+	}
+	return pe.ApplyScopedConfig(vars, func() error {
+		return pe.executeWithVars(ctx, yamlElement)
+	})
+}
+
+func (pe *PlaybookExecutor) executeWithVars(ctx context.Context, yamlElement *defs.YamlElement) error {
+	// The tasks in a run_once task already run only once.
+	if len(yamlElement.Block) == 0 && pe.batch != nil && pe.shared == nil && yamlElement.IsRunOnce() {
+		return pe.executeOnce(ctx, yamlElement)
+	}
+	return pe.executeLoopOrTask(ctx, yamlElement)
+}
+
+// executeOnce runs the run_once task on the first host of the batch which may reach it.
+// The other hosts skip the task and get its registered results and facts.
+func (pe *PlaybookExecutor) executeOnce(ctx context.Context, yamlElement *defs.YamlElement) error {
+	key := onceKey{task: pe.batchTask, pos: yamlElement.Pos, count: pe.onceCounts[yamlElement.Pos]}
+	pe.onceCounts[yamlElement.Pos]++
+	shared, ran, err := pe.batch.runOnce(ctx, pe.Host(), key, func() (defs.Config, error) {
+		pe.shared = defs.Config{}
+		defer func() { pe.shared = nil }()
+		err := pe.executeLoopOrTask(ctx, yamlElement)
+		return pe.shared, err
+	})
+	if ran {
+		return err
+	}
+	for key, value := range shared {
+		pe.setVar(key, value)
+	}
+	return err
+}
+
+func (pe *PlaybookExecutor) executeLoopOrTask(ctx context.Context, yamlElement *defs.YamlElement) error {
+	if yamlElement.Loop != nil {
+		return pe.executeLoop(ctx, yamlElement)
+	}
+	ok, err := pe.shouldExecute(yamlElement)
+	if err != nil || !ok {
+		return err
 	}
-	return pe.executeLoop(ctx, yamlElement)
+	return pe.executeBlockOrTask(ctx, yamlElement)
 }
 
 func (pe *PlaybookExecutor) ExecuteFile(ctx context.Context, filepath string) error {
-	if yes := fp.IsAbs(filepath); !yes {
-		filepath = fp.Join(pe.inputConfig.YamlDir, filepath)
+	filepath, err := absPath(pe.inputConfig.YamlDir, filepath)
+	if err != nil {
+		return err
+	}
+	if len(pe.includeStack) == 0 {
+		err := pe.loadInventory(fp.Dir(filepath))
+		if err != nil {
+			return err
+		}
+		err = pe.loadCachedFacts()
+		if err != nil {
+			return err
+		}
+	}
+	return pe.inFile(filepath, func() error {
+		return pe.executeFile(ctx, filepath)
+	})
+}
+
+// inFile runs fn with the file on the include stack.
+func (pe *PlaybookExecutor) inFile(filepath string, fn func() error) error {
+	err := pe.pushInclude(filepath)
+	if err != nil {
+		return err
+	}
+	defer pe.popInclude()
+	err = fn()
+	var includeErr *defs.IncludeError
+	var cycleErr *defs.IncludeCycleError
+	if err != nil && !errors.As(err, &includeErr) && !errors.As(err, &cycleErr) {
+		// The innermost file wraps the error so that the chain is complete.
+		err = &defs.IncludeError{Chain: pe.includeChain(), Err: err}
 	}
+	return err
+}
+
+func (pe *PlaybookExecutor) executeFile(ctx context.Context, filepath string) error {
 	processor := defs.NewProcessor()
 	err := processor.ParseYaml(filepath)
 	if err != nil {
@@ -130,3 +640,60 @@ func (pe *PlaybookExecutor) ExecuteFile(ctx context.Context, filepath string) er
 	}
 	return nil
 }
+
+func (pe *PlaybookExecutor) pushInclude(filepath string) error {
+	for _, file := range pe.includeStack {
+		if file == filepath {
+			chain := append(pe.includeChain(), pe.displayPath(filepath))
+			return &defs.IncludeCycleError{Chain: chain}
+		}
+	}
+	maxDepth := pe.inputConfig.MaxIncludeDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxIncludeDepth
+	}
+	if len(pe.includeStack) >= maxDepth {
+		chain := append(pe.includeChain(), pe.displayPath(filepath))
+		return &defs.IncludeError{
+			Chain: chain,
+			Err:   fmt.Errorf("Maximum include depth %d is exceeded", maxDepth),
+		}
+	}
+	pe.includeStack = append(pe.includeStack, filepath)
+	return nil
+}
+
+func (pe *PlaybookExecutor) popInclude() {
+	pe.includeStack = pe.includeStack[:len(pe.includeStack)-1]
+}
+
+func (pe *PlaybookExecutor) includeChain() []string {
+	chain := make([]string, 0, len(pe.includeStack))
+	for _, file := range pe.includeStack {
+		chain = append(chain, pe.displayPath(file))
+	}
+	return chain
+}
+
+// absPath returns the clean absolute path of the file relative to the directory.
+// The files on the include stack are compared by these paths.
+func absPath(dir string, filepath string) (string, error) {
+	if !fp.IsAbs(filepath) {
+		filepath = fp.Join(dir, filepath)
+	}
+	return fp.Abs(filepath)
+}
+
+// displayPath returns the path relative to the YAML directory if possible.
+func (pe *PlaybookExecutor) displayPath(filepath string) string {
+	if pe.inputConfig.YamlDir != "" {
+		dir, err := fp.Abs(pe.inputConfig.YamlDir)
+		if err != nil {
+			return filepath
+		}
+		if rel, err := fp.Rel(dir, filepath); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return filepath
+}
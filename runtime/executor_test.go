@@ -0,0 +1,392 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goparse/defs"
+	"goparse/inventory"
+	"os"
+	fp "path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// executeTasks runs the tasks in a file of a temporary directory and returns the executor.
+func executeTasks(t *testing.T, tasks string) (*PlaybookExecutor, error) {
+	t.Helper()
+	dir := t.TempDir()
+	err := os.WriteFile(fp.Join(dir, "tasks.yaml"), []byte(tasks), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pe := NewPlaybookExecutor(&PlaybookConfig{YamlDir: dir})
+	return pe, pe.ExecuteFile(context.Background(), "tasks.yaml")
+}
+
+func TestSubelementsNumericAttributes(t *testing.T) {
+	pe, err := executeTasks(t, `
+- set_fact:
+    users:
+      - name: alice
+        groups: [wheel, docker]
+      - name: bob
+        groups: [users]
+    pairs: []
+- set_fact:
+    pairs: "{{ pairs + [item.0.name ~ ':' ~ item.1] }}"
+  with_subelements:
+    - "{{ users }}"
+    - groups
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []any{"alice:wheel", "alice:docker", "bob:users"}
+	if got := pe.CurrentConfig()["pairs"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("pairs = %#v, want %#v", got, want)
+	}
+}
+
+func TestNativeTemplateInStringField(t *testing.T) {
+	pe, err := executeTasks(t, `
+- set_fact:
+    succeed: true
+- shell:
+    cmd: "{{ succeed }}"
+  register: result
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The command is true, which succeeds without any output.
+	if result := pe.CurrentConfig()["result"]; result != "" {
+		t.Errorf("result = %#v, want no output", result)
+	}
+}
+
+func BenchmarkRenderLoop(b *testing.B) {
+	dir := b.TempDir()
+	tasks := `
+- set_fact:
+    total: 0
+- set_fact:
+    total: "{{ total + item }}"
+    label: "{{ 'item-%d' | format(item) | upper }}"
+  loop: "{{ range(5000) | list }}"
+`
+	err := os.WriteFile(fp.Join(dir, "tasks.yaml"), []byte(tasks), 0644)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, size := range []int{defs.DefaultTemplateCacheSize, 0} {
+		name := "cached"
+		if size == 0 {
+			name = "uncached"
+		}
+		b.Run(name, func(b *testing.B) {
+			defs.SetTemplateCacheSize(size)
+			defer defs.SetTemplateCacheSize(defs.DefaultTemplateCacheSize)
+			for i := 0; i < b.N; i++ {
+				pe := NewPlaybookExecutor(&PlaybookConfig{YamlDir: dir})
+				err := pe.ExecuteFile(context.Background(), "tasks.yaml")
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestTaskRunErrorExitCode(t *testing.T) {
+	_, err := executeTasks(t, `
+- shell:
+    cmd: exit 75
+`)
+	var runErr *defs.TaskRunError
+	if !errors.As(err, &runErr) {
+		t.Fatalf("error = %v, want a TaskRunError", err)
+	}
+	if code, ok := runErr.ExitCode(); !ok || code != 75 || runErr.Task != "shell" {
+		t.Errorf("task %s exit code = %d, %v, want shell with 75", runErr.Task, code, ok)
+	}
+}
+
+func TestTaskRunErrorTemplate(t *testing.T) {
+	_, err := executeTasks(t, `
+- template:
+    src: invalid.j2
+    dest: /dev/null
+`)
+	var runErr *defs.TaskRunError
+	var templateErr *defs.TemplateError
+	if !errors.As(err, &runErr) || !errors.As(err, &templateErr) {
+		t.Fatalf("error = %v, want a TaskRunError wrapping a TemplateError", err)
+	}
+	if runErr.Task != "template" || runErr.Line != 2 {
+		t.Errorf("task %s at %v, want template at line 2", runErr.Task, runErr.Position)
+	}
+	if _, ok := runErr.ExitCode(); ok {
+		t.Errorf("template error has an exit code")
+	}
+}
+
+func TestIncludeCycleNormalizedPaths(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"tasks.yaml":      "- include:\n    files: [sub/../first.yaml]\n",
+		"first.yaml":      "- include:\n    files: [sub/second.yaml]\n",
+		"sub/second.yaml": "- include:\n    files: [" + fp.Join(dir, "tasks.yaml") + "]\n",
+	}
+	for name, content := range files {
+		err := os.MkdirAll(fp.Dir(fp.Join(dir, name)), 0755)
+		if err == nil {
+			err = os.WriteFile(fp.Join(dir, name), []byte(content), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The relative and the absolute paths of the same file are the same on the include stack.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	relDir, err := fp.Rel(wd, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pe := NewPlaybookExecutor(&PlaybookConfig{YamlDir: relDir})
+	err = pe.ExecuteFile(context.Background(), "./tasks.yaml")
+	var cycleErr *defs.IncludeCycleError
+	if !errors.As(err, &cycleErr) {
+		t.Fatalf("error = %v, want an IncludeCycleError", err)
+	}
+	want := []string{"tasks.yaml", "first.yaml", "sub/second.yaml", "tasks.yaml"}
+	if !reflect.DeepEqual(cycleErr.Chain, want) {
+		t.Errorf("chain = %v, want %v", cycleErr.Chain, want)
+	}
+}
+
+// recordingConnection is the connection plugin named record. The output of a command is the host,
+// the port and the user of the connection followed by the command.
+type recordingConnection struct {
+	mu       sync.Mutex
+	commands []string
+	host     string
+	vars     defs.Config
+}
+
+var recorder = &recordingConnection{}
+
+func init() {
+	defs.MustRegisterConnection(recorder)
+}
+
+func (conn *recordingConnection) Name() string {
+	return "record"
+}
+
+func (conn *recordingConnection) Connect(ctx context.Context, host string, vars defs.Config) (defs.Connection, error) {
+	return &recordingConnection{host: host, vars: vars}, nil
+}
+
+func (conn *recordingConnection) Exec(ctx context.Context, command string, options defs.ExecOptions) (*defs.ExecResult, error) {
+	output := fmt.Sprintf("%s:%v:%v:%s", conn.host, conn.vars["ansible_port"], conn.vars["ansible_user"], command)
+	recorder.mu.Lock()
+	recorder.commands = append(recorder.commands, output)
+	recorder.mu.Unlock()
+	return &defs.ExecResult{Stdout: output}, nil
+}
+
+func (conn *recordingConnection) Put(ctx context.Context, content []byte, path string, mode os.FileMode) error {
+	return nil
+}
+
+func (conn *recordingConnection) Fetch(ctx context.Context, path string) ([]byte, error) {
+	return nil, os.ErrNotExist
+}
+
+func (conn *recordingConnection) Stat(ctx context.Context, path string) (*defs.FileStat, error) {
+	return &defs.FileStat{Path: path}, nil
+}
+
+func (conn *recordingConnection) Close() error {
+	return nil
+}
+
+func TestDelegateTo(t *testing.T) {
+	inv := inventory.New()
+	err := inv.ParseINI([]byte(`
+[nodes]
+h1 ansible_port=1001 ansible_user=admin
+h2 ansible_port=1002 ansible_user=admin
+[delegates]
+d1 ansible_port=2001 ansible_user=deploy
+d2 ansible_port=2002
+[all:vars]
+ansible_connection=record
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	playbook := `
+- hosts: nodes
+  tasks:
+    - shell:
+        cmd: "{{ inventory_hostname }}"
+      register: direct
+    - shell:
+        cmd: "{{ inventory_hostname }}"
+      delegate_to: d1
+      register: delegated
+    - shell:
+        cmd: "{{ inventory_hostname }}"
+      delegate_to: "{{ target }}"
+      vars:
+        target: d2
+      register: templated
+    - shell:
+        cmd: "once {{ inventory_hostname }}"
+      delegate_to: d1
+      run_once: true
+      register: once
+    - set_fact:
+        after: "{{ inventory_hostname }}"
+      delegate_to: d1
+`
+	recorder.mu.Lock()
+	recorder.commands = nil
+	recorder.mu.Unlock()
+	runner, err := executePlaybook(t, &PlaybookConfig{Inventory: inv}, playbook, map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range []string{"h1", "h2"} {
+		port := map[string]int{"h1": 1001, "h2": 1002}[host]
+		// The commands run on the delegated host with its connection vars,
+		// while inventory_hostname is the original host.
+		want := map[string]any{
+			"direct":    fmt.Sprintf("%s:%d:admin:%s", host, port, host),
+			"delegated": "d1:2001:deploy:" + host,
+			"templated": "d2:2002:<nil>:" + host,
+			"once":      "d1:2001:deploy:once h1",
+			"after":     host,
+		}
+		for name, value := range want {
+			if got := hostVar(t, runner, host, name); got != value {
+				t.Errorf("%s %s = %v, want %v", host, name, got, value)
+			}
+		}
+	}
+	onceCount := 0
+	for _, command := range recorder.commands {
+		if strings.Contains(command, ":once ") {
+			onceCount++
+		}
+	}
+	if onceCount != 1 {
+		t.Errorf("run_once delegated task ran %d times, want 1", onceCount)
+	}
+}
+
+// executeTaskFiles writes the files in a temporary directory and runs tasks.yaml.
+func executeTaskFiles(t *testing.T, config *PlaybookConfig, files map[string]string) (*PlaybookExecutor, error) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		err := os.WriteFile(fp.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	config.YamlDir = dir
+	pe := NewPlaybookExecutor(config)
+	return pe, pe.ExecuteFile(context.Background(), "tasks.yaml")
+}
+
+func TestConditionError(t *testing.T) {
+	files := map[string]string{
+		"tasks.yaml": `
+- include:
+    files: [inner.yaml]
+- set_fact:
+    after: true
+`,
+		"inner.yaml": `
+- set_fact:
+    skipped: false
+  when: count >
+- set_fact:
+    next: true
+`,
+	}
+	_, err := executeTaskFiles(t, &PlaybookConfig{}, files)
+	var condErr *defs.ConditionError
+	if !errors.As(err, &condErr) {
+		t.Fatalf("error = %v, want a ConditionError", err)
+	}
+	if fp.Base(condErr.File) != "inner.yaml" || condErr.Line != 2 || condErr.Column != 3 {
+		t.Errorf("position = %s:%d:%d, want inner.yaml:2:3", condErr.File, condErr.Line, condErr.Column)
+	}
+	if condErr.Condition != "count >" {
+		t.Errorf("condition = %q", condErr.Condition)
+	}
+	var includeErr *defs.IncludeError
+	if !errors.As(err, &includeErr) {
+		t.Fatalf("error = %v, want an IncludeError", err)
+	}
+	if want := []string{"tasks.yaml", "inner.yaml"}; !reflect.DeepEqual(includeErr.Chain, want) {
+		t.Errorf("chain = %v, want %v", includeErr.Chain, want)
+	}
+
+	// The task with the bad condition is skipped with the lenient conditions.
+	pe, err := executeTaskFiles(t, &PlaybookConfig{LenientConditions: true}, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := pe.CurrentConfig()
+	if _, ok := vars["skipped"]; ok {
+		t.Errorf("the task with the bad condition ran")
+	}
+	if vars["next"] != true || vars["after"] != true {
+		t.Errorf("the tasks after the bad condition did not run: %v", vars)
+	}
+}
+
+func TestKeywordsTemplatedLazily(t *testing.T) {
+	pe, err := executeTaskFiles(t, &PlaybookConfig{StrictUndefined: true}, map[string]string{"tasks.yaml": `
+- set_fact:
+    count: 0
+# The condition is evaluated for each item after the previous items set the count.
+- set_fact:
+    count: "{{ count + 1 }}"
+  loop: [a, b, c, d]
+  when: count < 2
+# The condition of the second item refers to the result registered by the first one.
+- shell:
+    cmd: "echo {{ item }}"
+  loop: [a, b]
+  register: "out_{{ item }}"
+  when: item == 'a' or out_a is defined
+# The name cannot be templated, but the task still runs.
+- name: "Set {{ missing.name }}"
+  set_fact:
+    named: true
+`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := pe.CurrentConfig()
+	if vars["count"] != 2 {
+		t.Errorf("count = %#v, want 2", vars["count"])
+	}
+	if vars["out_a"] != "a\n" || vars["out_b"] != "b\n" {
+		t.Errorf("out_a = %#v, out_b = %#v, want the outputs of both items", vars["out_a"], vars["out_b"])
+	}
+	if vars["named"] != true {
+		t.Errorf("the task with the name which cannot be templated did not run")
+	}
+}
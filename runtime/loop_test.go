@@ -0,0 +1,136 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"os"
+	fp "path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoopSyntax(t *testing.T) {
+	tests := []struct {
+		loop string
+		want []any
+	}{
+		{"loop: [a, b]", []any{"a", "b"}},
+		{"loop: \"{{ letters }}\"", []any{"x", "y"}},
+		{"loop: \"{{ letters | map('upper') | list }}\"", []any{"X", "Y"}},
+		{"loop: \"{{ range(2) | list }}\"", []any{0, 1}},
+		{"with_items: [a, [b, c]]", []any{"a", "b", "c"}},
+		{"with_items: \"{{ letters }}\"", []any{"x", "y"}},
+		{"with_list: [[a, b], c]", []any{[]any{"a", "b"}, "c"}},
+		{"with_dict: \"{{ ports }}\"", []any{map[string]any{"key": "http", "value": 80}}},
+		{"with_dict: {ssh: 22}", []any{map[string]any{"key": "ssh", "value": 22}}},
+		{"with_nested: [[a, b], [1, 2]]", []any{[]any{"a", 1}, []any{"a", 2}, []any{"b", 1}, []any{"b", 2}}},
+		{"with_nested: [\"{{ letters }}\", [1]]", []any{[]any{"x", 1}, []any{"y", 1}}},
+		{"with_sequence: start=1 end=3", []any{"1", "2", "3"}},
+		{"with_sequence: count=2 format=host%02d", []any{"host01", "host02"}},
+		{"with_subelements: [\"{{ users }}\", groups]", []any{
+			[]any{map[string]any{"name": "alice", "groups": []any{"wheel"}}, "wheel"},
+		}},
+	}
+	for _, test := range tests {
+		pe, err := executeTasks(t, fmt.Sprintf(`
+- set_fact:
+    letters: [x, y]
+    ports: {http: 80}
+    users: [{name: alice, groups: [wheel]}]
+    seen: []
+- set_fact:
+    seen: "{{ seen + [item] }}"
+  %s
+`, test.loop))
+		if err != nil {
+			t.Errorf("%s failed: %v", test.loop, err)
+			continue
+		}
+		if got := pe.CurrentConfig()["seen"]; !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: items = %#v, want %#v", test.loop, got, test.want)
+		}
+	}
+}
+
+func TestLoopFileglob(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"files/a.conf", "files/b.conf", "files/c.txt"} {
+		err := os.MkdirAll(fp.Dir(fp.Join(dir, name)), 0755)
+		if err == nil {
+			err = os.WriteFile(fp.Join(dir, name), nil, 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := os.WriteFile(fp.Join(dir, "tasks.yaml"), []byte(`
+- set_fact:
+    seen: "{{ (seen | default([])) + [item | basename] }}"
+  with_fileglob: "*.conf"
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pe := NewPlaybookExecutor(&PlaybookConfig{YamlDir: dir})
+	err = pe.ExecuteFile(context.Background(), "tasks.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := pe.CurrentConfig()["seen"], []any{"a.conf", "b.conf"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("items = %#v, want %#v", got, want)
+	}
+}
+
+func TestLoopControl(t *testing.T) {
+	pe, err := executeTasks(t, `
+- set_fact:
+    seen: []
+- set_fact:
+    seen: "{{ seen + [idx ~ ':' ~ name ~ ':' ~ ansible_loop.revindex ~ ':' ~ ansible_loop.last] }}"
+  loop: [a, b]
+  loop_control:
+    loop_var: name
+    index_var: idx
+    extended: true
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []any{"0:a:2:False", "1:b:1:True"}
+	if got := pe.CurrentConfig()["seen"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("items = %#v, want %#v", got, want)
+	}
+	// The loop variables are restored after the loop.
+	for _, name := range []string{"name", "idx", "ansible_loop"} {
+		if value, ok := pe.CurrentConfig()[name]; ok {
+			t.Errorf("%s = %v after the loop", name, value)
+		}
+	}
+}
+
+func TestLoopInvalid(t *testing.T) {
+	_, err := executeTasks(t, `
+- set_fact:
+    x: "{{ item }}"
+  loop: "{{ 'not a list' }}"
+`)
+	if err == nil {
+		t.Errorf("loop over a string succeeded")
+	}
+}
+
+func TestLoopUndefined(t *testing.T) {
+	for _, loop := range []string{"loop", "with_items", "with_list", "with_dict"} {
+		pe, err := executeTasks(t, fmt.Sprintf(`
+- set_fact:
+    ran: true
+  %s: "{{ undefined_list }}"
+`, loop))
+		if err == nil {
+			t.Errorf("%s over an undefined variable succeeded", loop)
+		}
+		if ran, ok := pe.CurrentConfig()["ran"]; ok {
+			t.Errorf("%s over an undefined variable ran with ran = %v", loop, ran)
+		}
+	}
+}
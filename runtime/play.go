@@ -0,0 +1,545 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"goparse/defs"
+	"goparse/inventory"
+	fp "path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	// strategies run the tasks of a play on the hosts.
+	strategies = map[string]func(context.Context, *playRun){
+		"linear": linearStrategy,
+		"free":   freeStrategy,
+	}
+)
+
+// PlaybookRunner runs the plays of a playbook on the hosts of the inventory.
+// Each host has its own PlaybookExecutor which keeps the variables of the host across the plays.
+type PlaybookRunner struct {
+	config    *PlaybookConfig
+	inventory *inventory.Inventory
+	executors map[string]*PlaybookExecutor
+	mutex     sync.Mutex
+	// failedHosts are the hosts which failed in a play. They are excluded from the later plays.
+	failedHosts map[string]error
+}
+
+// playRun is a play running on the hosts.
+type playRun struct {
+	runner   *PlaybookRunner
+	filepath string
+	tasks    defs.YamlElements
+	hosts    []string
+	// forks limits the number of the tasks running in parallel.
+	forks             chan struct{}
+	maxFailPercentage *float64
+	anyErrorsFatal    bool
+	hasNextBatch      bool
+	mutex             sync.Mutex
+	// abortReason is set when the failed hosts stop the play.
+	abortReason string
+	// onceResults are the results of the run_once tasks.
+	onceResults map[onceKey]*onceResult
+	// progress is the number of the tasks each host finished. The hosts which have not
+	// finished a task may still reach the run_once tasks in it.
+	progress map[string]int
+	// changed is closed and replaced when the progress or the run_once results change.
+	changed chan struct{}
+}
+
+// onceKey identifies an occurrence of a run_once task in a batch.
+type onceKey struct {
+	// task is the index of the play task in which the task runs.
+	task int
+	pos  defs.Position
+	// count is the number of the previous occurrences of the task in the play task on the host.
+	count int
+}
+
+// onceResult is the result of a run_once task shared with the hosts of the batch.
+type onceResult struct {
+	host   string
+	done   chan struct{}
+	shared defs.Config
+	err    error
+}
+
+func NewPlaybookRunner(config *PlaybookConfig) *PlaybookRunner {
+	runner := &PlaybookRunner{
+		config:      config,
+		inventory:   config.Inventory,
+		executors:   map[string]*PlaybookExecutor{},
+		failedHosts: map[string]error{},
+	}
+	if runner.inventory == nil {
+		// Only the implicit localhost is available.
+		runner.inventory = inventory.New()
+	}
+	return runner
+}
+
+// Executor returns the executor of the host.
+func (runner *PlaybookRunner) Executor(host string) (*PlaybookExecutor, bool) {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+	pe, ok := runner.executors[host]
+	return pe, ok
+}
+
+// FailedHosts returns the errors of the failed hosts by the host names.
+func (runner *PlaybookRunner) FailedHosts() map[string]error {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+	failedHosts := make(map[string]error, len(runner.failedHosts))
+	for host, err := range runner.failedHosts {
+		failedHosts[host] = err
+	}
+	return failedHosts
+}
+
+// ExecutePlaybook runs the plays in the playbook file. The failure of a host does not stop
+// the other hosts, and a HostsFailedError is returned at the end if any host failed.
+func (runner *PlaybookRunner) ExecutePlaybook(ctx context.Context, filepath string) error {
+	filepath, err := absPath(runner.config.YamlDir, filepath)
+	if err != nil {
+		return err
+	}
+	processor := defs.NewProcessor()
+	err = processor.ParsePlaybook(filepath)
+	if err != nil {
+		return err
+	}
+	for _, play := range processor.YamlPlays() {
+		err = runner.executePlay(ctx, filepath, play)
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	if failedHosts := runner.FailedHosts(); len(failedHosts) > 0 {
+		return &defs.HostsFailedError{Errors: failedHosts}
+	}
+	return nil
+}
+
+func (runner *PlaybookRunner) executePlay(ctx context.Context, filepath string, play *defs.YamlPlay) error {
+	matched, err := runner.inventory.MatchHosts(play.Hosts)
+	if err != nil {
+		return &defs.ParseError{Position: play.Pos, Err: err}
+	}
+	strategyName := play.Strategy
+	if strategyName == "" {
+		strategyName = runner.config.Strategy
+	}
+	if strategyName == "" {
+		strategyName = DefaultStrategy
+	}
+	strategy, ok := strategies[strategyName]
+	if !ok {
+		return &defs.ParseError{Position: play.Pos, Err: fmt.Errorf("Strategy %s is not supported", strategyName)}
+	}
+	failedHosts := runner.FailedHosts()
+	hosts := []string{}
+	for _, host := range matched {
+		if _, ok := failedHosts[host]; !ok {
+			hosts = append(hosts, host)
+		}
+	}
+	name := play.Name
+	if name == "" {
+		name = play.Hosts
+	}
+	fmt.Printf("\nRunning play %s on hosts %s\n", name, strings.Join(hosts, ", "))
+	if len(hosts) == 0 {
+		fmt.Printf("\nNo hosts matched\n")
+		return nil
+	}
+	batches, err := serialBatches(hosts, play.Serial)
+	if err != nil {
+		return &defs.ParseError{Position: play.Pos, Err: err}
+	}
+	tasks := runner.playTasks(play)
+	for i, batch := range batches {
+		if len(batches) > 1 {
+			fmt.Printf("\nRunning batch %s\n", strings.Join(batch, ", "))
+		}
+		run := &playRun{
+			runner:            runner,
+			filepath:          filepath,
+			tasks:             tasks,
+			hosts:             batch,
+			forks:             make(chan struct{}, runner.forks()),
+			maxFailPercentage: play.MaxFailPercentage,
+			anyErrorsFatal:    play.AnyErrorsFatal,
+			hasNextBatch:      i < len(batches)-1,
+			onceResults:       map[onceKey]*onceResult{},
+			progress:          map[string]int{},
+			changed:           make(chan struct{}),
+		}
+		err = runner.executeBatch(ctx, play, name, hosts, run, strategy)
+		if err != nil {
+			return err
+		}
+		if run.abortReason != "" {
+			failedHosts := runner.FailedHosts()
+			batchFailedHosts := []string{}
+			for _, host := range batch {
+				if _, ok := failedHosts[host]; ok {
+					batchFailedHosts = append(batchFailedHosts, host)
+				}
+			}
+			return &defs.PlayAbortedError{Position: play.Pos, Play: name, Reason: run.abortReason, Hosts: batchFailedHosts}
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// executeBatch runs the play on the batch of the hosts with the play variables.
+func (runner *PlaybookRunner) executeBatch(ctx context.Context, play *defs.YamlPlay, name string, hosts []string, run *playRun, strategy func(context.Context, *playRun)) error {
+	failedHosts := runner.FailedHosts()
+	playHosts := []string{}
+	for _, host := range hosts {
+		if _, ok := failedHosts[host]; !ok {
+			playHosts = append(playHosts, host)
+		}
+	}
+	// The executors are prepared sequentially since the inventory may load the vars of the playbook.
+	for _, host := range run.hosts {
+		pe, err := runner.executor(host, fp.Dir(run.filepath))
+		if err != nil {
+			return err
+		}
+		playVars := defs.Config{
+			"ansible_play_name":      name,
+			"ansible_play_hosts_all": toAnySlice(hosts),
+			"ansible_play_hosts":     toAnySlice(playHosts),
+			"ansible_play_batch":     toAnySlice(run.hosts),
+		}
+		restore := pe.applyScopedConfig(playVars)
+		defer restore()
+		pe.batch = run
+		defer func() { pe.batch = nil }()
+		// The tasks inherit the become keywords of the play.
+		pe.become = play.Become
+		defer func() { pe.become = defs.BecomeKeywords{} }()
+		if len(play.Vars) > 0 {
+			vars, err := resolveVars[defs.Config](play.Vars, pe.CurrentConfig(), pe.TemplateOptions())
+			if err != nil {
+				runner.fail(host, err)
+				continue
+			}
+			restore := pe.applyScopedConfig(vars)
+			defer restore()
+		}
+	}
+	if !run.checkFailures() {
+		strategy(ctx, run)
+	}
+	return nil
+}
+
+// playTasks returns the tasks of the play. The facts are gathered by the first task
+// if gather_facts is enabled or the gathering is not explicit.
+func (runner *PlaybookRunner) playTasks(play *defs.YamlPlay) defs.YamlElements {
+	gathering := runner.config.Gathering
+	if gathering == "" {
+		gathering = DefaultGathering
+	}
+	if play.GatherFacts != nil && !*play.GatherFacts || play.GatherFacts == nil && gathering == GatheringExplicit {
+		return play.Tasks
+	}
+	name := "Gathering Facts"
+	gatherFacts := &defs.YamlElement{
+		Name: &name,
+		Task: &defs.YamlTask{Name: "setup", Config: defs.Config{
+			"gather_subset": toAnySlice(play.GatherSubset),
+			// Only the implicit gathering uses the cached facts.
+			"cached": gathering == GatheringSmart,
+		}},
+		Pos: play.Pos,
+	}
+	return append(defs.YamlElements{gatherFacts}, play.Tasks...)
+}
+
+func (runner *PlaybookRunner) forks() int {
+	if runner.config.Forks <= 0 {
+		return DefaultForks
+	}
+	return runner.config.Forks
+}
+
+// serialBatches splits the hosts into the batches of the serial sizes.
+// All the hosts are in one batch if serial is not set.
+func serialBatches(hosts []string, serial []string) ([][]string, error) {
+	if len(serial) == 0 {
+		return [][]string{hosts}, nil
+	}
+	batches := [][]string{}
+	total := len(hosts)
+	for i := 0; len(hosts) > 0; i++ {
+		value, percent, err := defs.ParseBatchSize(serial[min(i, len(serial)-1)])
+		if err != nil {
+			return nil, err
+		}
+		size := int(value)
+		if percent {
+			// The percentage is of all the hosts and at least one host is in a batch.
+			size = max(int(value/100*float64(total)), 1)
+		}
+		if size <= 0 || size > len(hosts) {
+			size = len(hosts)
+		}
+		batches = append(batches, hosts[:size])
+		hosts = hosts[size:]
+	}
+	return batches, nil
+}
+
+// executor returns the executor of the host. It is created with the variables of the host
+// if it does not exist.
+func (runner *PlaybookRunner) executor(host string, playbookDir string) (*PlaybookExecutor, error) {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+	if pe, ok := runner.executors[host]; ok {
+		return pe, nil
+	}
+	hostConfig := *runner.config
+	hostConfig.Host = host
+	hostConfig.Inventory = runner.inventory
+	pe := NewPlaybookExecutor(&hostConfig)
+	err := pe.loadInventory(playbookDir)
+	if err != nil {
+		return nil, err
+	}
+	err = pe.loadCachedFacts()
+	if err != nil {
+		return nil, err
+	}
+	runner.executors[host] = pe
+	return pe, nil
+}
+
+func (runner *PlaybookRunner) fail(host string, err error) {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+	runner.failedHosts[host] = err
+	fmt.Printf("\nHost %s failed: %s\n", host, err)
+}
+
+// activeHosts returns the hosts of the batch which have not failed.
+func (play *playRun) activeHosts() []string {
+	failedHosts := play.runner.FailedHosts()
+	hosts := []string{}
+	for _, host := range play.hosts {
+		if _, ok := failedHosts[host]; !ok {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// checkFailures returns true if the failed hosts of the batch stop the play.
+// The play stops if any host fails with any_errors_fatal, the failed hosts exceed
+// max_fail_percentage, or all the hosts fail before the next batch.
+func (play *playRun) checkFailures() bool {
+	failedHosts := play.runner.FailedHosts()
+	failed := 0
+	for _, host := range play.hosts {
+		if _, ok := failedHosts[host]; ok {
+			failed++
+		}
+	}
+	reason := ""
+	switch {
+	case failed == 0:
+	case play.anyErrorsFatal:
+		reason = "Host failed with any_errors_fatal"
+	case play.maxFailPercentage != nil && float64(failed)*100/float64(len(play.hosts)) > *play.maxFailPercentage:
+		reason = fmt.Sprintf("%d of %d hosts failed exceeding max_fail_percentage %v", failed, len(play.hosts), *play.maxFailPercentage)
+	case failed == len(play.hosts) && play.hasNextBatch:
+		reason = "All hosts of the batch failed"
+	}
+	play.mutex.Lock()
+	defer play.mutex.Unlock()
+	if play.abortReason == "" {
+		play.abortReason = reason
+	}
+	return play.abortReason != ""
+}
+
+// runOnce runs fn if the host is the first one of the batch which has not failed and may reach the task.
+// The other hosts wait for its result without holding a fork. It returns true if fn ran on the host.
+func (play *playRun) runOnce(ctx context.Context, host string, key onceKey, fn func() (defs.Config, error)) (defs.Config, bool, error) {
+	play.mutex.Lock()
+	for {
+		if result, ok := play.onceResults[key]; ok {
+			play.mutex.Unlock()
+			return play.waitOnce(ctx, result)
+		}
+		if play.onceHost(key) == host {
+			result := &onceResult{host: host, done: make(chan struct{})}
+			play.onceResults[key] = result
+			play.broadcast()
+			play.mutex.Unlock()
+			result.shared, result.err = fn()
+			close(result.done)
+			return result.shared, true, result.err
+		}
+		changed := play.changed
+		play.mutex.Unlock()
+		err := play.wait(ctx, changed)
+		if err != nil {
+			return nil, false, err
+		}
+		play.mutex.Lock()
+	}
+}
+
+// waitOnce waits for the result of the run_once task running on another host.
+func (play *playRun) waitOnce(ctx context.Context, result *onceResult) (defs.Config, bool, error) {
+	err := play.wait(ctx, result.done)
+	if err != nil {
+		return nil, false, err
+	}
+	if result.err != nil {
+		return result.shared, false, fmt.Errorf("Task failed once on host %s: %w", result.host, result.err)
+	}
+	return result.shared, false, nil
+}
+
+// wait waits for the channel to be closed. The fork of the host is released while waiting.
+func (play *playRun) wait(ctx context.Context, ch <-chan struct{}) error {
+	<-play.forks
+	// The fork is taken again even if the context is done since the caller releases it.
+	defer func() { play.forks <- struct{}{} }()
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// onceHost returns the host which runs the run_once task. It is the first host of the batch
+// which has not failed and has not finished the play task of the run_once task.
+// The mutex must be locked.
+func (play *playRun) onceHost(key onceKey) string {
+	failedHosts := play.runner.FailedHosts()
+	for _, host := range play.hosts {
+		if _, ok := failedHosts[host]; ok {
+			continue
+		}
+		if play.progress[host] <= key.task {
+			return host
+		}
+	}
+	return ""
+}
+
+// finishTask records that the host finished or failed the play task of the index.
+func (play *playRun) finishTask(host string, index int) {
+	play.mutex.Lock()
+	defer play.mutex.Unlock()
+	play.progress[host] = index + 1
+	play.broadcast()
+}
+
+// broadcast wakes up the hosts waiting for a change. The mutex must be locked.
+func (play *playRun) broadcast() {
+	close(play.changed)
+	play.changed = make(chan struct{})
+}
+
+func (play *playRun) aborted() bool {
+	play.mutex.Lock()
+	defer play.mutex.Unlock()
+	return play.abortReason != ""
+}
+
+// execute runs the task of the index on the host when a fork is available.
+// It returns false if the host failed.
+func (play *playRun) execute(ctx context.Context, host string, index int) bool {
+	defer play.finishTask(host, index)
+	select {
+	case play.forks <- struct{}{}:
+	case <-ctx.Done():
+		return false
+	}
+	defer func() { <-play.forks }()
+	pe, _ := play.runner.Executor(host)
+	pe.batchTask = index
+	pe.onceCounts = map[defs.Position]int{}
+	err := pe.inFile(play.filepath, func() error {
+		return pe.execute(ctx, play.tasks[index])
+	})
+	if err != nil {
+		play.runner.fail(host, err)
+		return false
+	}
+	return true
+}
+
+// linearStrategy runs each task on all the hosts before the next task.
+// The failures are checked after each task.
+func linearStrategy(ctx context.Context, play *playRun) {
+	for index := range play.tasks {
+		hosts := play.activeHosts()
+		if len(hosts) == 0 || ctx.Err() != nil {
+			return
+		}
+		var wg sync.WaitGroup
+		for _, host := range hosts {
+			wg.Add(1)
+			go func(host string) {
+				defer wg.Done()
+				play.execute(ctx, host, index)
+			}(host)
+		}
+		wg.Wait()
+		if play.checkFailures() {
+			return
+		}
+	}
+}
+
+// freeStrategy runs the tasks on each host as fast as possible without waiting for the other hosts.
+// The failures are checked when a host fails.
+func freeStrategy(ctx context.Context, play *playRun) {
+	var wg sync.WaitGroup
+	for _, host := range play.activeHosts() {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			// The host does not reach the run_once tasks of the rest of the tasks.
+			defer play.finishTask(host, len(play.tasks)-1)
+			for index := range play.tasks {
+				if ctx.Err() != nil || play.aborted() {
+					return
+				}
+				if !play.execute(ctx, host, index) {
+					play.checkFailures()
+					return
+				}
+			}
+		}(host)
+	}
+	wg.Wait()
+}
+
+func toAnySlice(list []string) []any {
+	result := make([]any, 0, len(list))
+	for _, value := range list {
+		result = append(result, value)
+	}
+	return result
+}
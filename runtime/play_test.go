@@ -0,0 +1,327 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goparse/defs"
+	"goparse/inventory"
+	"os"
+	fp "path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// localInventory returns the inventory of the local hosts named h1, h2 and so on in the group nodes.
+func localInventory(t testing.TB, count int) *inventory.Inventory {
+	t.Helper()
+	var sb strings.Builder
+	sb.WriteString("[nodes]\n")
+	for i := 1; i <= count; i++ {
+		fmt.Fprintf(&sb, "h%d ansible_connection=local\n", i)
+	}
+	inv := inventory.New()
+	err := inv.ParseINI([]byte(sb.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return inv
+}
+
+// executePlaybook runs the playbook in a temporary directory with the other files.
+func executePlaybook(t testing.TB, config *PlaybookConfig, playbook string, files map[string]string) (*PlaybookRunner, error) {
+	t.Helper()
+	dir := t.TempDir()
+	files["playbook.yaml"] = playbook
+	for name, content := range files {
+		err := os.WriteFile(fp.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	config.YamlDir = dir
+	runner := NewPlaybookRunner(config)
+	return runner, runner.ExecutePlaybook(context.Background(), "playbook.yaml")
+}
+
+// hostVar returns the variable of the host after the playbook.
+func hostVar(t testing.TB, runner *PlaybookRunner, host string, name string) any {
+	t.Helper()
+	pe, ok := runner.Executor(host)
+	if !ok {
+		t.Fatalf("Host %s did not run", host)
+	}
+	return pe.CurrentConfig()[name]
+}
+
+func TestRunOnceDeterministic(t *testing.T) {
+	playbook := `
+- hosts: nodes
+  strategy: %s
+  tasks:
+    - include:
+        files: [first.yaml]
+      when: inventory_hostname != 'h1'
+    - set_fact:
+        leader: "{{ inventory_hostname }}"
+      run_once: true
+`
+	files := map[string]string{
+		"first.yaml": `
+- set_fact:
+    early: "{{ inventory_hostname }}"
+  run_once: true
+`,
+	}
+	for _, strategy := range []string{"linear", "free"} {
+		for _, forks := range []int{1, 2, 8} {
+			for i := 0; i < 5; i++ {
+				config := &PlaybookConfig{Inventory: localInventory(t, 6), Forks: forks}
+				runner, err := executePlaybook(t, config, fmt.Sprintf(playbook, strategy), files)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for host := 1; host <= 6; host++ {
+					name := fmt.Sprintf("h%d", host)
+					if leader := hostVar(t, runner, name, "leader"); leader != "h1" {
+						t.Errorf("%s forks %d: leader of %s = %v, want h1", strategy, forks, name, leader)
+					}
+					// h1 does not include the file, so h2 is the first host running it.
+					if early := hostVar(t, runner, name, "early"); host > 1 && early != "h2" {
+						t.Errorf("%s forks %d: early of %s = %v, want h2", strategy, forks, name, early)
+					}
+				}
+			}
+		}
+	}
+}
+
+// mapFactCache is a fact cache for the tests which never expires.
+type mapFactCache struct {
+	mutex sync.Mutex
+	facts map[string]defs.Config
+}
+
+func (cache *mapFactCache) Get(host string) (defs.Config, bool, error) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	facts, ok := cache.facts[host]
+	if !ok {
+		return nil, false, nil
+	}
+	copied := defs.Config{}
+	for key, value := range facts {
+		copied[key] = value
+	}
+	return copied, true, nil
+}
+
+func (cache *mapFactCache) Set(host string, facts defs.Config) error {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.facts[host] = facts
+	return nil
+}
+
+func TestSmartGatheringCache(t *testing.T) {
+	cache := &mapFactCache{facts: map[string]defs.Config{}}
+	config := &PlaybookConfig{Gathering: GatheringSmart, FactCache: cache}
+	// The filtered facts are not cached.
+	_, err := executePlaybook(t, config, `
+- hosts: localhost
+  gather_facts: false
+  tasks:
+    - setup:
+        filter: ansible_hostname
+`, map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := cache.Get("localhost"); ok {
+		t.Fatalf("Filtered facts are cached")
+	}
+	// The min facts do not cover the hardware facts, which are gathered again.
+	for _, test := range []struct {
+		subset   string
+		hardware bool
+	}{
+		{"min", false},
+		{"all", true},
+		{"min", true},
+	} {
+		runner, err := executePlaybook(t, config, fmt.Sprintf(`
+- hosts: localhost
+  gather_subset: [%s]
+  tasks: []
+`, test.subset), map[string]string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		facts, ok, _ := cache.Get("localhost")
+		if !ok || facts["module_setup"] != true {
+			t.Fatalf("gather_subset %s: facts are not cached", test.subset)
+		}
+		if _, ok := facts["ansible_memtotal_mb"]; ok != test.hardware {
+			t.Errorf("gather_subset %s: hardware facts cached = %v, want %v", test.subset, ok, test.hardware)
+		}
+		if _, ok := hostVar(t, runner, "localhost", "ansible_memtotal_mb").(int); ok != test.hardware {
+			t.Errorf("gather_subset %s: hardware facts set = %v, want %v", test.subset, ok, test.hardware)
+		}
+	}
+}
+
+func TestPlayVarsKeepTaskWrites(t *testing.T) {
+	runner, err := executePlaybook(t, &PlaybookConfig{Inventory: localInventory(t, 1)}, `
+- hosts: all
+  gather_facts: false
+  vars:
+    fact: play
+    result: play
+    scoped: play
+  tasks:
+    - set_fact:
+        fact: task
+    - shell:
+        cmd: echo -n task
+      register: result
+- hosts: all
+  gather_facts: false
+  tasks:
+    - set_fact:
+        seen: "{{ fact }}-{{ result }}-{{ scoped is defined }}"
+`, map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen := hostVar(t, runner, "h1", "seen"); seen != "task-task-False" {
+		t.Errorf("seen = %v, want task-task-False", seen)
+	}
+}
+
+func TestSerialBatches(t *testing.T) {
+	hosts := []string{"h1", "h2", "h3", "h4", "h5"}
+	tests := []struct {
+		serial []string
+		want   [][]string
+	}{
+		{nil, [][]string{hosts}},
+		{[]string{"2"}, [][]string{{"h1", "h2"}, {"h3", "h4"}, {"h5"}}},
+		{[]string{"0"}, [][]string{hosts}},
+		{[]string{"10"}, [][]string{hosts}},
+		{[]string{"40%"}, [][]string{{"h1", "h2"}, {"h3", "h4"}, {"h5"}}},
+		{[]string{"10%"}, [][]string{{"h1"}, {"h2"}, {"h3"}, {"h4"}, {"h5"}}},
+		{[]string{"1", "2"}, [][]string{{"h1"}, {"h2", "h3"}, {"h4", "h5"}}},
+		{[]string{"1", "50%", "100%"}, [][]string{{"h1"}, {"h2", "h3"}, {"h4", "h5"}}},
+	}
+	for _, test := range tests {
+		got, err := serialBatches(hosts, test.serial)
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("serialBatches(%v) = %v, %v, want %v", test.serial, got, err, test.want)
+		}
+	}
+	for _, serial := range []string{"x", "-1", "1.5", "%"} {
+		if _, err := serialBatches(hosts, []string{serial}); err == nil {
+			t.Errorf("serialBatches(%s) succeeded", serial)
+		}
+	}
+}
+
+func TestSerialFailures(t *testing.T) {
+	tests := []struct {
+		keywords string
+		ran      []string
+		aborted  []string
+	}{
+		// 1 of 2 hosts failing is 50%. The batch stops after the failed task.
+		{"max_fail_percentage: 49", []string{}, []string{"h1"}},
+		{"max_fail_percentage: 50", []string{"h2", "h3", "h4"}, nil},
+		{"any_errors_fatal: true", []string{}, []string{"h1"}},
+		{"", []string{"h2", "h3", "h4"}, nil},
+	}
+	for _, test := range tests {
+		runner, err := executePlaybook(t, &PlaybookConfig{Inventory: localInventory(t, 4)}, `
+- hosts: all
+  gather_facts: false
+  serial: 2
+  `+test.keywords+`
+  tasks:
+    - shell:
+        cmd: exit 1
+      when: inventory_hostname == 'h1'
+    - set_fact:
+        ran: true
+`, map[string]string{})
+		var abortedErr *defs.PlayAbortedError
+		if test.aborted != nil {
+			if !errors.As(err, &abortedErr) || !reflect.DeepEqual(abortedErr.Hosts, test.aborted) {
+				t.Errorf("%s: error = %v, want the play aborted for %v", test.keywords, err, test.aborted)
+			}
+		} else if errors.As(err, &abortedErr) {
+			t.Errorf("%s: play aborted: %v", test.keywords, err)
+		}
+		ran := []string{}
+		for _, host := range []string{"h1", "h2", "h3", "h4"} {
+			if pe, ok := runner.Executor(host); ok && pe.CurrentConfig()["ran"] == true {
+				ran = append(ran, host)
+			}
+		}
+		if !reflect.DeepEqual(ran, test.ran) {
+			t.Errorf("%s: ran on %v, want %v", test.keywords, ran, test.ran)
+		}
+	}
+}
+
+func TestPlayBecome(t *testing.T) {
+	inv := inventory.New()
+	err := inv.ParseINI([]byte("[nodes]\nh1 ansible_connection=record\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	playbook := `
+- hosts: nodes
+  become: yes
+  become_user: app
+  tasks:
+    - shell:
+        cmd: whoami
+      register: play_level
+    - shell:
+        cmd: whoami
+      become_user: other
+      register: task_level
+    - shell:
+        cmd: whoami
+      become: no
+      register: disabled
+- hosts: nodes
+  gather_facts: no
+  tasks:
+    - shell:
+        cmd: whoami
+      register: next_play
+`
+	runner, err := executePlaybook(t, &PlaybookConfig{Inventory: inv}, playbook, map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"play_level", "sudo -H -S -n -u 'app' -- "},
+		{"task_level", "sudo -H -S -n -u 'other' -- "},
+		{"disabled", ""},
+		{"next_play", ""},
+	}
+	for _, test := range tests {
+		output, _ := hostVar(t, runner, "h1", test.name).(string)
+		_, command, _ := strings.Cut(output, "<nil>:<nil>:")
+		if test.want == "" && strings.HasPrefix(command, "sudo") {
+			t.Errorf("%s command = %q, want no become", test.name, command)
+		} else if !strings.HasPrefix(command, test.want) {
+			t.Errorf("%s command = %q, want the prefix %q", test.name, command, test.want)
+		}
+	}
+}